@@ -153,13 +153,13 @@ for (i, exp) in enumerate(exps_to_run):
     log("data generated")
     
     log("starting helper...")
-    cloud = system.run_helper(cmd="helper", sources=sources_id_list, n_rows=set_size)
+    cloud = system.run_helper(cmd="mppj helper serve", sources=sources_id_list, n_rows=set_size)
     time.sleep(3)   # wait for helper to start
     log("running receiver and sources")
     timestart = time.time()
 
-    rec = system.run_receiver("receiver", sources=sources_id_list)
-    all = system.run_all_players_with_helper_addr("cat data.csv | source", n_cpu=N_CPU_PER_SOURCE)
+    rec = system.run_receiver("mppj receiver pull", sources=sources_id_list)
+    all = system.run_all_players_with_helper_addr("cat data.csv | mppj source push", n_cpu=N_CPU_PER_SOURCE)
     for l in cloud.logs(stderr=True, stdout=True, stream=True):
         log("helper%s" % l.decode('utf-8').strip("\n"))
     
@@ -1,10 +1,22 @@
 package api
 
 import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"errors"
 	"fmt"
 	"mppj"
+	"mppj/api/pb"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/stats"
 	"google.golang.org/protobuf/proto"
 )
 
@@ -63,3 +75,294 @@ func TestSerializeMessages(t *testing.T) {
 		t.Fatalf("GetEncRowWithHintFromMsg failed: %v", err)
 	}
 }
+
+func TestSerializeBatchMessages(t *testing.T) {
+
+	sourceIDs := []mppj.SourceID{"ds1", "ds2"}
+
+	sid := mppj.NewSessionID(2, "helper", "receiver", sourceIDs)
+
+	receiver := mppj.NewReceiver(sid, sourceIDs)
+	source := mppj.NewDataSource(sid, receiver.GetPK())
+
+	encRows := make([]mppj.EncRow, 3)
+	for i := range encRows {
+		cuid, cval, err := source.ProcessRow(fmt.Sprintf("user%d", i), "value")
+		if err != nil {
+			t.Fatalf("ProcessRow failed: %v", err)
+		}
+		encRows[i] = mppj.EncRow{Cuid: cuid, Cval: cval}
+	}
+
+	batchMsg, err := GetEncRowBatchMsg(encRows)
+	if err != nil {
+		t.Fatalf("GetEncRowBatchMsg failed: %v", err)
+	}
+
+	fmt.Println("Size of EncRowBatch message:", proto.Size(batchMsg))
+
+	got, err := GetEncRowsFromBatchMsg(batchMsg)
+	if err != nil {
+		t.Fatalf("GetEncRowsFromBatchMsg failed: %v", err)
+	}
+	if len(got) != len(encRows) {
+		t.Fatalf("expected %d rows, got %d", len(encRows), len(got))
+	}
+	for i := range got {
+		if !got[i].Cuid.Equals(encRows[i].Cuid) {
+			t.Errorf("row %d differs after deserialization", i)
+		}
+	}
+}
+
+func TestMalformedMessages(t *testing.T) {
+
+	sourceIDs := []mppj.SourceID{"ds1", "ds2"}
+
+	sid := mppj.NewSessionID(2, "helper", "receiver", sourceIDs)
+
+	receiver := mppj.NewReceiver(sid, sourceIDs)
+	source := mppj.NewDataSource(sid, receiver.GetPK())
+
+	// a value which spans over several ciphertexts
+	cuid, cval, err := source.ProcessRow("user1", "a value which is longer than a single ciphertext")
+	if err != nil {
+		t.Fatalf("ProcessRow failed: %v", err)
+	}
+	encRowMsg, err := GetEncRowMsg(mppj.EncRow{Cuid: cuid, Cval: cval})
+	if err != nil {
+		t.Fatalf("GetEncRowMsg failed: %v", err)
+	}
+	encRow, err := GetEncRowFromMsg(encRowMsg)
+	if err != nil {
+		t.Fatalf("GetEncRowFromMsg failed: %v", err)
+	}
+	if len(encRow.Cval) != len(cval) || len(cval) < 2 {
+		t.Fatalf("expected %d value ciphertexts, got %d", len(cval), len(encRow.Cval))
+	}
+
+	tests := map[string]struct {
+		modify func(msg *pb.EncRow)
+		err    error
+	}{
+		"version":   {func(msg *pb.EncRow) { msg.Version = pb.Version_VERSION_UNSPECIFIED }, ErrUnsupportedVersion},
+		"group":     {func(msg *pb.EncRow) { msg.Group = pb.Group_GROUP_UNSPECIFIED }, ErrUnsupportedVersion},
+		"no cuid":   {func(msg *pb.EncRow) { msg.Cuid = nil }, ErrMalformedMessage},
+		"short c0":  {func(msg *pb.EncRow) { msg.Cuid.C0 = msg.Cuid.C0[:10] }, ErrMalformedMessage},
+		"bad point": {func(msg *pb.EncRow) { msg.Cuid.C1 = make([]byte, len(msg.Cuid.C1)) }, ErrMalformedMessage},
+		"no cval":   {func(msg *pb.EncRow) { msg.Cval = nil }, ErrMalformedMessage},
+		"nil cval":  {func(msg *pb.EncRow) { msg.Cval[1] = nil }, ErrMalformedMessage},
+	}
+	for name, test := range tests {
+		msg, err := GetEncRowMsg(mppj.EncRow{Cuid: cuid, Cval: cval})
+		if err != nil {
+			t.Fatalf("GetEncRowMsg failed: %v", err)
+		}
+		test.modify(msg)
+		if _, err := GetEncRowFromMsg(msg); !errors.Is(err, test.err) {
+			t.Errorf("%s: expected error %v, got %v", name, test.err, err)
+		}
+	}
+
+	if _, err := GetEncRowWithHintFromMsg(&pb.EncRowWithHint{Version: ProtocolVersion, Group: Group}); !errors.Is(err, ErrMalformedMessage) {
+		t.Errorf("expected error %v, got %v", ErrMalformedMessage, err)
+	}
+}
+
+func TestStatsHandlerMetrics(t *testing.T) {
+	h := NewStatsHandler("ds1", "ds2")
+	incoming := metadata.NewIncomingContext(context.Background(), metadata.Pairs("source-id", "ds1"))
+	ctx := h.TagRPC(incoming, &stats.RPCTagInfo{FullMethodName: "/mppj.MPPJHelper/PushRows"})
+	begin := time.Now()
+	h.HandleRPC(ctx, &stats.Begin{BeginTime: begin})
+	h.HandleRPC(ctx, &stats.OutPayload{WireLength: 10})
+	h.HandleRPC(ctx, &stats.InPayload{WireLength: 3})
+	h.HandleRPC(ctx, &stats.OutPayload{WireLength: 5})
+
+	// an RPC without source ID
+	other := h.TagRPC(context.Background(), &stats.RPCTagInfo{FullMethodName: "/mppj.MPPJHelper/PullRows"})
+	h.HandleRPC(other, &stats.OutPayload{WireLength: 7})
+
+	// RPCs of sources which are not the handler's
+	for _, id := range []string{"ds3", "ds4"} {
+		unknown := metadata.NewIncomingContext(context.Background(), metadata.Pairs("source-id", id))
+		h.HandleRPC(h.TagRPC(unknown, &stats.RPCTagInfo{FullMethodName: "/mppj.MPPJHelper/PushRows"}), &stats.InPayload{WireLength: 2})
+	}
+
+	expectedSource := NetStats{DataSent: 15, DataRecv: 3, MsgsSent: 2, MsgsRecv: 1}
+	expectedUnknown := NetStats{DataRecv: 4, MsgsRecv: 2}
+	st := h.GetStats()
+	if st.NetStats != (NetStats{DataSent: 22, DataRecv: 7, MsgsSent: 3, MsgsRecv: 3}) {
+		t.Fatalf("unexpected total stats: %+v", st.NetStats)
+	}
+	if len(st.BySource) != 2 || st.BySource["ds1"] != expectedSource || st.BySource[UnknownSource] != expectedUnknown {
+		t.Fatalf("unexpected stats per source: %+v", st.BySource)
+	}
+	if len(st.ByMethod) != 2 || st.ByMethod["/mppj.MPPJHelper/PushRows"] != (NetStats{DataSent: 15, DataRecv: 7, MsgsSent: 2, MsgsRecv: 3}) {
+		t.Fatalf("unexpected stats per method: %+v", st.ByMethod)
+	}
+
+	expected := `
+# HELP mppj_rpc_bytes_total The bytes sent and received on the wire, per RPC method.
+# TYPE mppj_rpc_bytes_total counter
+mppj_rpc_bytes_total{direction="received",method="/mppj.MPPJHelper/PullRows"} 0
+mppj_rpc_bytes_total{direction="received",method="/mppj.MPPJHelper/PushRows"} 7
+mppj_rpc_bytes_total{direction="sent",method="/mppj.MPPJHelper/PullRows"} 7
+mppj_rpc_bytes_total{direction="sent",method="/mppj.MPPJHelper/PushRows"} 15
+# HELP mppj_source_bytes_total The bytes sent and received on the wire, per source.
+# TYPE mppj_source_bytes_total counter
+mppj_source_bytes_total{direction="received",source="ds1"} 3
+mppj_source_bytes_total{direction="received",source="unknown"} 4
+mppj_source_bytes_total{direction="sent",source="ds1"} 15
+mppj_source_bytes_total{direction="sent",source="unknown"} 0
+`
+	if err := testutil.CollectAndCompare(h, strings.NewReader(expected), "mppj_rpc_bytes_total", "mppj_source_bytes_total"); err != nil {
+		t.Fatalf("unexpected metrics: %v", err)
+	}
+
+	h.HandleRPC(ctx, &stats.End{BeginTime: begin, EndTime: begin.Add(time.Second)})
+	if ss := h.GetStats().BySource["ds1"]; ss.RPCs != 1 || ss.StreamTime != time.Second {
+		t.Fatalf("unexpected stats of the completed RPC: %+v", ss)
+	}
+	expected = `
+# HELP mppj_rpc_active The number of RPCs in progress, per method.
+# TYPE mppj_rpc_active gauge
+mppj_rpc_active{method="/mppj.MPPJHelper/PullRows"} 0
+mppj_rpc_active{method="/mppj.MPPJHelper/PushRows"} 0
+`
+	if err := testutil.CollectAndCompare(h, strings.NewReader(expected), "mppj_rpc_active"); err != nil {
+		t.Fatalf("unexpected metrics after the end of the RPC: %v", err)
+	}
+}
+
+func TestFileTransport(t *testing.T) {
+
+	sourceIDs := []mppj.SourceID{"ds1", "ds2"}
+
+	sid := mppj.NewSessionID(2, "helper", "receiver", sourceIDs)
+
+	receiver := mppj.NewReceiver(sid, sourceIDs)
+	source := mppj.NewDataSource(sid, receiver.GetPK())
+
+	encRows := make([]mppj.EncRow, 3)
+	for i := range encRows {
+		cuid, cval, err := source.ProcessRow(fmt.Sprintf("user%d", i), "value")
+		if err != nil {
+			t.Fatalf("ProcessRow failed: %v", err)
+		}
+		encRows[i] = mppj.EncRow{Cuid: cuid, Cval: cval}
+	}
+
+	pk, sk, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := func(FileHeader) (ed25519.PublicKey, error) { return pk, nil }
+	header := FileHeader{Kind: SourceFile, SessionID: sid, Party: "ds1", NumRows: len(encRows)}
+
+	path := filepath.Join(t.TempDir(), "ds1.mppj")
+	fw, err := CreateFile(path, header, sk)
+	if err != nil {
+		t.Fatalf("CreateFile failed: %v", err)
+	}
+	if err := fw.WriteEncRowsWithHint(make([]mppj.EncRowWithHint, 1)); err == nil {
+		t.Fatal("expected an error for the rows of another kind")
+	}
+	if err := fw.WriteEncRows(encRows); err != nil {
+		t.Fatalf("WriteEncRows failed: %v", err)
+	}
+	if err := fw.WriteEncRows(encRows[:1]); !errors.Is(err, mppj.ErrTooManyRows) {
+		t.Fatalf("expected error %v, got %v", mppj.ErrTooManyRows, err)
+	}
+	if err := fw.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	fr, err := OpenFile(path, key)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	if h := fr.Header(); h.Kind != SourceFile || !bytes.Equal(h.SessionID, sid) || h.Party != "ds1" || h.NumRows != len(encRows) {
+		t.Fatalf("unexpected header: %+v", h)
+	}
+	var i int
+	for msg, err := range fr.EncRowMsgs() {
+		if err != nil {
+			t.Fatalf("failed to read row %d: %v", i, err)
+		}
+		encRow, err := GetEncRowFromMsg(msg)
+		if err != nil {
+			t.Fatalf("GetEncRowFromMsg failed: %v", err)
+		}
+		if !encRow.Cuid.Equals(encRows[i].Cuid) {
+			t.Errorf("row %d differs after reading", i)
+		}
+		i++
+	}
+	if i != len(encRows) {
+		t.Fatalf("expected %d rows, got %d", len(encRows), i)
+	}
+	for _, err := range fr.EncRowWithHintMsgs() {
+		if !errors.Is(err, ErrInvalidFile) {
+			t.Fatalf("expected error %v for the rows of another kind, got %v", ErrInvalidFile, err)
+		}
+	}
+	fr.Close()
+
+	// a tampered file or another key are rejected
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)/2] ^= 1
+	tampered := filepath.Join(t.TempDir(), "tampered.mppj")
+	if err := os.WriteFile(tampered, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenFile(tampered, key); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected error %v, got %v", ErrInvalidSignature, err)
+	}
+	otherPK, _, _ := ed25519.GenerateKey(nil)
+	if _, err := OpenFile(path, func(FileHeader) (ed25519.PublicKey, error) { return otherPK, nil }); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected error %v, got %v", ErrInvalidSignature, err)
+	}
+
+	// a file modified once opened is rejected at the end of the rows
+	fr, err = OpenFile(path, key)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	defer fr.Close()
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := len(data) - ed25519.SignatureSize - 1 // in the bytes of the last row
+	if _, err := f.WriteAt([]byte{data[last] ^ 1}, int64(last)); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	i, err = 0, nil
+	for _, rerr := range fr.EncRowMsgs() {
+		if err = rerr; err != nil {
+			break
+		}
+		i++
+	}
+	if i != len(encRows)-1 || !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected error %v in place of the last row, got %v after %d rows", ErrInvalidSignature, err, i)
+	}
+
+	// an incomplete file is not signed
+	incomplete := filepath.Join(t.TempDir(), "incomplete.mppj")
+	fw, err = CreateFile(incomplete, header, sk)
+	if err != nil {
+		t.Fatalf("CreateFile failed: %v", err)
+	}
+	if err := fw.Close(); !errors.Is(err, mppj.ErrTooFewRows) {
+		t.Fatalf("expected error %v, got %v", mppj.ErrTooFewRows, err)
+	}
+	if _, err := os.Stat(incomplete); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected the incomplete file to be removed, got %v", err)
+	}
+}
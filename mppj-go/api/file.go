@@ -0,0 +1,429 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"iter"
+	"mppj"
+	"mppj/api/pb"
+	"os"
+
+	"google.golang.org/protobuf/encoding/protodelim"
+	"google.golang.org/protobuf/proto"
+)
+
+// The files of the file transport, which carries the rows between the parties when they cannot connect to each
+// other (e.g., on removable media). A file has a header, the rows as length-delimited messages, and the
+// Ed25519ph signature of the header and the rows by the party which wrote it.
+
+// FileKind is the kind of rows in a file.
+type FileKind byte
+
+const (
+	// SourceFile holds the rows of a source, as EncRow messages.
+	SourceFile FileKind = 1
+	// HelperFile holds the rows converted by the helper, as EncRowWithHint messages.
+	HelperFile FileKind = 2
+	// SetupFile holds the setup message of the receiver, as a single Setup message.
+	SetupFile FileKind = 3
+)
+
+func (k FileKind) String() string {
+	switch k {
+	case SourceFile:
+		return "source file"
+	case HelperFile:
+		return "helper file"
+	case SetupFile:
+		return "setup file"
+	}
+	return fmt.Sprintf("file kind %d", byte(k))
+}
+
+const (
+	fileMagic   = "MPPJFILE"
+	fileVersion = 1
+)
+
+var (
+	// ErrInvalidFile is returned for files which cannot be decoded.
+	ErrInvalidFile = errors.New("invalid file")
+	// ErrInvalidSignature is returned for files whose signature does not verify.
+	ErrInvalidSignature = errors.New("invalid file signature")
+)
+
+// fileSignatureOptions are the options of the Ed25519ph signatures, whose context separates them from the
+// signatures of other applications.
+var fileSignatureOptions = &ed25519.Options{Hash: crypto.SHA512, Context: "mppj file"}
+
+// FileHeader describes the rows of a file.
+type FileHeader struct {
+	Kind      FileKind
+	SessionID []byte
+	Party     string // the id of the party which wrote the file
+	NumRows   int
+}
+
+func (h FileHeader) marshal() ([]byte, error) {
+	if len(h.SessionID) > 0xff || len(h.Party) > 0xff {
+		return nil, errors.New("session ID or party id too long")
+	}
+	b := append([]byte(fileMagic), fileVersion, byte(h.Kind), byte(len(h.SessionID)))
+	b = append(b, h.SessionID...)
+	b = append(b, byte(len(h.Party)))
+	b = append(b, h.Party...)
+	return binary.BigEndian.AppendUint64(b, uint64(h.NumRows)), nil
+}
+
+// ReadFileHeader reads the header of a file, without verifying its signature.
+func ReadFileHeader(r io.Reader) (FileHeader, error) {
+	var h FileHeader
+	fixed := make([]byte, len(fileMagic)+3)
+	if _, err := io.ReadFull(r, fixed); err != nil {
+		return h, fmt.Errorf("%w: %v", ErrInvalidFile, err)
+	}
+	if !bytes.HasPrefix(fixed, []byte(fileMagic)) {
+		return h, fmt.Errorf("%w: bad magic", ErrInvalidFile)
+	}
+	f := fixed[len(fileMagic):]
+	if f[0] != fileVersion {
+		return h, fmt.Errorf("%w: version %d", ErrUnsupportedVersion, f[0])
+	}
+	h.Kind = FileKind(f[1])
+	h.SessionID = make([]byte, f[2])
+	var partyLen [1]byte
+	if _, err := io.ReadFull(r, h.SessionID); err != nil {
+		return h, fmt.Errorf("%w: %v", ErrInvalidFile, err)
+	}
+	if _, err := io.ReadFull(r, partyLen[:]); err != nil {
+		return h, fmt.Errorf("%w: %v", ErrInvalidFile, err)
+	}
+	rest := make([]byte, int(partyLen[0])+8)
+	if _, err := io.ReadFull(r, rest); err != nil {
+		return h, fmt.Errorf("%w: %v", ErrInvalidFile, err)
+	}
+	h.Party = string(rest[:partyLen[0]])
+	h.NumRows = int(binary.BigEndian.Uint64(rest[partyLen[0]:]))
+	return h, nil
+}
+
+// FileWriter writes the rows of a party to a signed file.
+type FileWriter struct {
+	f      *os.File
+	w      *bufio.Writer
+	digest hash.Hash // of everything written so far
+	key    ed25519.PrivateKey
+	header FileHeader
+	n      int
+	closed bool
+}
+
+// CreateFile creates the file at path for the rows described by header, which are signed with key. It fails
+// if the file already exists.
+func CreateFile(path string, header FileHeader, key ed25519.PrivateKey) (*FileWriter, error) {
+	h, err := header.marshal()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return nil, err
+	}
+	fw := &FileWriter{f: f, digest: sha512.New(), key: key, header: header}
+	fw.w = bufio.NewWriter(io.MultiWriter(f, fw.digest))
+	if _, err := fw.w.Write(h); err != nil {
+		fw.Abort()
+		return nil, err
+	}
+	return fw, nil
+}
+
+// check checks that n more rows of the kind can be written to the file.
+func (fw *FileWriter) check(kind FileKind, n int) error {
+	if fw.header.Kind != kind {
+		return fmt.Errorf("cannot write the rows of a %s to a %s", kind, fw.header.Kind)
+	}
+	if fw.n+n > fw.header.NumRows {
+		return fmt.Errorf("%w: the file is for %d rows", mppj.ErrTooManyRows, fw.header.NumRows)
+	}
+	return nil
+}
+
+func (fw *FileWriter) writeMsg(msg proto.Message) error {
+	_, err := protodelim.MarshalTo(fw.w, msg)
+	if err == nil {
+		fw.n++
+	}
+	return err
+}
+
+// writeMsgs writes the messages, which must be of the kind of the file.
+func writeMsgs[M proto.Message](fw *FileWriter, kind FileKind, msgs []M) error {
+	if err := fw.check(kind, len(msgs)); err != nil {
+		return err
+	}
+	for _, msg := range msgs {
+		if err := fw.writeMsg(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteEncRows writes rows of a source file.
+func (fw *FileWriter) WriteEncRows(rows []mppj.EncRow) error {
+	if err := fw.check(SourceFile, len(rows)); err != nil {
+		return err
+	}
+	msgs := make([]*pb.EncRow, len(rows))
+	for i, row := range rows {
+		msg, err := GetEncRowMsg(row)
+		if err != nil {
+			return err
+		}
+		msgs[i] = msg
+	}
+	return fw.WriteEncRowMsgs(msgs)
+}
+
+// WriteEncRowMsgs writes the messages of rows of a source file.
+func (fw *FileWriter) WriteEncRowMsgs(msgs []*pb.EncRow) error {
+	return writeMsgs(fw, SourceFile, msgs)
+}
+
+// WriteEncRowsWithHint writes rows of a helper file.
+func (fw *FileWriter) WriteEncRowsWithHint(rows []mppj.EncRowWithHint) error {
+	if err := fw.check(HelperFile, len(rows)); err != nil {
+		return err
+	}
+	msgs := make([]*pb.EncRowWithHint, len(rows))
+	for i, row := range rows {
+		msg, err := GetEncRowWithHintMsg(row)
+		if err != nil {
+			return err
+		}
+		msgs[i] = msg
+	}
+	return fw.WriteEncRowWithHintMsgs(msgs)
+}
+
+// WriteEncRowWithHintMsgs writes the messages of rows of a helper file.
+func (fw *FileWriter) WriteEncRowWithHintMsgs(msgs []*pb.EncRowWithHint) error {
+	return writeMsgs(fw, HelperFile, msgs)
+}
+
+// WriteSetup writes the message of a setup file.
+func (fw *FileWriter) WriteSetup(setup Setup) error {
+	msg, err := GetSetupMsg(setup)
+	if err != nil {
+		return err
+	}
+	return writeMsgs(fw, SetupFile, []*pb.Setup{msg})
+}
+
+// Close signs the file once all its rows are written, and closes it.
+func (fw *FileWriter) Close() error {
+	if fw.n != fw.header.NumRows {
+		fw.Abort()
+		return fmt.Errorf("%w: wrote %d of the %d rows of the file", mppj.ErrTooFewRows, fw.n, fw.header.NumRows)
+	}
+	if err := fw.w.Flush(); err != nil {
+		fw.Abort()
+		return err
+	}
+	sig, err := fw.key.Sign(nil, fw.digest.Sum(nil), fileSignatureOptions)
+	if err != nil {
+		fw.Abort()
+		return err
+	}
+	if _, err := fw.f.Write(sig); err != nil {
+		fw.Abort()
+		return err
+	}
+	if err := fw.f.Sync(); err != nil {
+		fw.Abort()
+		return err
+	}
+	fw.closed = true
+	return fw.f.Close()
+}
+
+// Abort closes and removes the file, unless it was closed.
+func (fw *FileWriter) Abort() {
+	if fw.closed {
+		return
+	}
+	fw.closed = true
+	fw.f.Close()
+	os.Remove(fw.f.Name())
+}
+
+// FileReader reads the rows of a file whose signature is verified.
+type FileReader struct {
+	f      *os.File
+	header FileHeader
+	rows   int64  // the offset of the rows
+	end    int64  // the offset of the signature
+	digest []byte // the digest of the header and the rows, whose signature is verified
+}
+
+// OpenFile opens the file at path and verifies its signature with the public key returned by key for its
+// header, before any row is read. As the rows are read again from the file, they are digested again, and the
+// iterations over the rows end with ErrInvalidSignature, in place of the last row, if the file was modified
+// since it was opened. The rows before are then already yielded, so that the consumers must discard the rows
+// of an iteration which ends with an error.
+func OpenFile(path string, key func(FileHeader) (ed25519.PublicKey, error)) (*FileReader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	fr, err := openFile(f, key)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return fr, nil
+}
+
+func openFile(f *os.File, key func(FileHeader) (ed25519.PublicKey, error)) (*FileReader, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	digest := sha512.New()
+	header, err := ReadFileHeader(io.TeeReader(f, digest))
+	if err != nil {
+		return nil, err
+	}
+	pk, err := key(header)
+	if err != nil {
+		return nil, err
+	}
+	if len(pk) != ed25519.PublicKeySize {
+		return nil, errors.New("invalid public key")
+	}
+	fr := &FileReader{f: f, header: header, end: info.Size() - ed25519.SignatureSize}
+	if fr.rows, err = f.Seek(0, io.SeekCurrent); err != nil {
+		return nil, err
+	}
+	if fr.end < fr.rows {
+		return nil, fmt.Errorf("%w: missing signature", ErrInvalidFile)
+	}
+	if _, err := io.CopyN(digest, f, fr.end-fr.rows); err != nil {
+		return nil, err
+	}
+	sig := make([]byte, ed25519.SignatureSize)
+	if _, err := io.ReadFull(f, sig); err != nil {
+		return nil, err
+	}
+	fr.digest = digest.Sum(nil)
+	if err := ed25519.VerifyWithOptions(pk, fr.digest, sig, fileSignatureOptions); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	return fr, nil
+}
+
+// Header returns the header of the file.
+func (fr *FileReader) Header() FileHeader {
+	return fr.header
+}
+
+// readMsgs returns an iterator over the messages of the file, which must be of the given kind. The iteration
+// stops at the first error, which is yielded along with a nil message. The header and the messages are digested
+// as they are read, and the last message is only yielded once the end of the file is reached with the verified
+// digest (otherwise, ErrInvalidSignature is yielded instead).
+func readMsgs[M proto.Message](fr *FileReader, kind FileKind, newMsg func() M) iter.Seq2[M, error] {
+	return func(yield func(M, error) bool) {
+		var zero M
+		if fr.header.Kind != kind {
+			yield(zero, fmt.Errorf("%w: expected a %s, got a %s", ErrInvalidFile, kind, fr.header.Kind))
+			return
+		}
+		digest := sha512.New()
+		if _, err := io.Copy(digest, io.NewSectionReader(fr.f, 0, fr.rows)); err != nil {
+			yield(zero, err)
+			return
+		}
+		r := bufio.NewReader(io.TeeReader(io.NewSectionReader(fr.f, fr.rows, fr.end-fr.rows), digest))
+
+		// checkEnd checks that all the rows were read, and that the file was not modified since it was opened
+		checkEnd := func() error {
+			if _, err := r.Peek(1); err == nil {
+				return fmt.Errorf("%w: the file is for %d rows", mppj.ErrTooManyRows, fr.header.NumRows)
+			} else if err != io.EOF {
+				return err
+			}
+			if !bytes.Equal(digest.Sum(nil), fr.digest) {
+				return fmt.Errorf("%w: the file was modified since it was opened", ErrInvalidSignature)
+			}
+			return nil
+		}
+		if fr.header.NumRows == 0 {
+			if err := checkEnd(); err != nil {
+				yield(zero, err)
+			}
+			return
+		}
+		for i := range fr.header.NumRows {
+			msg := newMsg()
+			err := protodelim.UnmarshalFrom(r, msg)
+			switch {
+			case err == io.EOF:
+				err = fmt.Errorf("%w: %d of the %d rows", mppj.ErrTooFewRows, i, fr.header.NumRows)
+			case err != nil:
+				err = fmt.Errorf("%w: %v", ErrMalformedMessage, err)
+			case i == fr.header.NumRows-1:
+				err = checkEnd()
+			}
+			if err != nil {
+				yield(zero, err)
+				return
+			}
+			if !yield(msg, nil) {
+				return
+			}
+		}
+	}
+}
+
+// EncRowMsgs returns an iterator over the messages of a source file, which are decoded with GetEncRowFromMsg.
+func (fr *FileReader) EncRowMsgs() iter.Seq2[*pb.EncRow, error] {
+	return readMsgs(fr, SourceFile, func() *pb.EncRow { return new(pb.EncRow) })
+}
+
+// EncRowWithHintMsgs returns an iterator over the messages of a helper file, which are decoded with
+// GetEncRowWithHintFromMsg.
+func (fr *FileReader) EncRowWithHintMsgs() iter.Seq2[*pb.EncRowWithHint, error] {
+	return readMsgs(fr, HelperFile, func() *pb.EncRowWithHint { return new(pb.EncRowWithHint) })
+}
+
+// ReadSetup reads the message of a setup file.
+func (fr *FileReader) ReadSetup() (Setup, error) {
+	if fr.header.Kind == SetupFile && fr.header.NumRows != 1 {
+		return Setup{}, fmt.Errorf("%w: setup file of %d messages", ErrInvalidFile, fr.header.NumRows)
+	}
+	var setup *pb.Setup
+	for msg, err := range readMsgs(fr, SetupFile, func() *pb.Setup { return new(pb.Setup) }) {
+		if err != nil {
+			return Setup{}, err
+		}
+		setup = msg // read up to the end of the file, whose digest is then checked
+	}
+	if setup == nil {
+		return Setup{}, fmt.Errorf("%w: missing setup message", ErrInvalidFile)
+	}
+	return GetSetupFromMsg(setup)
+}
+
+// Close closes the file.
+func (fr *FileReader) Close() error {
+	return fr.f.Close()
+}
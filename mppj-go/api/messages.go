@@ -1,87 +1,219 @@
 package api
 
 import (
+	"errors"
+	"fmt"
 	"mppj"
 	"mppj/api/pb"
 )
 
 const (
-	pointLen = 33
-	ctLen    = 2 * pointLen
+	// ProtocolVersion is the version of the messages, the messages of other versions are rejected.
+	ProtocolVersion = pb.Version_VERSION_1
+	// Group is the group of the messages' ciphertexts.
+	Group = pb.Group_GROUP_P256
 )
 
-func GetEncRowMsg(er mppj.EncRow) (*pb.EncRow, error) {
-	CuidBytes, err := er.Cuid.Serialize()
+var (
+	// ErrMalformedMessage is returned for messages which cannot be decoded.
+	ErrMalformedMessage = errors.New("malformed message")
+	// ErrUnsupportedVersion is returned for messages of another protocol version or group.
+	ErrUnsupportedVersion = errors.New("unsupported message version")
+)
+
+// checkHeader checks the version and group of a message.
+func checkHeader(version pb.Version, group pb.Group) error {
+	if version != ProtocolVersion {
+		return fmt.Errorf("%w: version %v, expected %v", ErrUnsupportedVersion, version, ProtocolVersion)
+	}
+	if group != Group {
+		return fmt.Errorf("%w: group %v, expected %v", ErrUnsupportedVersion, group, Group)
+	}
+	return nil
+}
+
+func getCiphertextMsg(ct *mppj.Ciphertext) (*pb.Ciphertext, error) {
+	c0, c1, err := ct.SerializePoints()
 	if err != nil {
 		return nil, err
 	}
-	CvalBytes, err := er.Cval[0].Serialize()
+	return &pb.Ciphertext{C0: c0, C1: c1}, nil
+}
+
+func getCiphertextFromMsg(msg *pb.Ciphertext, field string) (*mppj.Ciphertext, error) {
+	if msg == nil {
+		return nil, fmt.Errorf("%w: missing %s", ErrMalformedMessage, field)
+	}
+	ct, err := mppj.DeserializeCiphertextPoints(msg.C0, msg.C1)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid %s: %v", ErrMalformedMessage, field, err)
+	}
+	return ct, nil
+}
+
+func GetEncRowMsg(er mppj.EncRow) (*pb.EncRow, error) {
+	cuid, err := getCiphertextMsg(er.Cuid)
 	if err != nil {
 		return nil, err
 	}
-	data := make([]byte, 2*ctLen)
-	copy(data[0:ctLen], CuidBytes)
-	copy(data[ctLen:2*ctLen], CvalBytes)
+	cval := make([]*pb.Ciphertext, len(er.Cval))
+	for i, ct := range er.Cval {
+		if cval[i], err = getCiphertextMsg(ct); err != nil {
+			return nil, err
+		}
+	}
 	return &pb.EncRow{
-		Data: data,
+		Version: ProtocolVersion,
+		Group:   Group,
+		Cuid:    cuid,
+		Cval:    cval,
 	}, nil
 }
 
 func GetEncRowFromMsg(msg *pb.EncRow) (mppj.EncRow, error) {
-	cuid, err := mppj.DeserializeCiphertext(msg.Data[:ctLen])
-	if err != nil {
+	if err := checkHeader(msg.Version, msg.Group); err != nil {
 		return mppj.EncRow{}, err
 	}
-	cval, err := mppj.DeserializeCiphertext(msg.Data[ctLen : 2*ctLen])
+	cuid, err := getCiphertextFromMsg(msg.Cuid, "Cuid")
 	if err != nil {
 		return mppj.EncRow{}, err
 	}
+	if len(msg.Cval) == 0 {
+		return mppj.EncRow{}, fmt.Errorf("%w: missing Cval", ErrMalformedMessage)
+	}
+	cval := make([]*mppj.Ciphertext, len(msg.Cval))
+	for i, ct := range msg.Cval {
+		if cval[i], err = getCiphertextFromMsg(ct, fmt.Sprintf("Cval[%d]", i)); err != nil {
+			return mppj.EncRow{}, err
+		}
+	}
 	return mppj.EncRow{
 		Cuid: cuid,
-		Cval: []*mppj.Ciphertext{cval},
+		Cval: cval,
 	}, nil
 }
 
 func GetEncRowWithHintMsg(er mppj.EncRowWithHint) (*pb.EncRowWithHint, error) {
-	cnymBytes, err := er.Cnyme.Serialize()
+	cnym, err := getCiphertextMsg(&er.Cnyme)
 	if err != nil {
 		return nil, err
 	}
-	cvalKeyBytes, err := er.CValKey.Serialize()
+	cvalKey, err := getCiphertextMsg(&er.CValKey)
 	if err != nil {
 		return nil, err
 	}
-	chintBytes, err := er.CHint.Serialize()
+	chint, err := getCiphertextMsg(&er.CHint)
 	if err != nil {
 		return nil, err
 	}
-	data := make([]byte, 3*ctLen+len(er.CVal))
-	copy(data[0:ctLen], cnymBytes)
-	copy(data[ctLen:2*ctLen], cvalKeyBytes)
-	copy(data[2*ctLen:3*ctLen], chintBytes)
-	copy(data[3*ctLen:], er.CVal)
 	return &pb.EncRowWithHint{
-		Data: data,
+		Version: ProtocolVersion,
+		Group:   Group,
+		Cnyme:   cnym,
+		CValKey: cvalKey,
+		CHint:   chint,
+		CVal:    er.CVal,
 	}, nil
 }
 
 func GetEncRowWithHintFromMsg(msg *pb.EncRowWithHint) (mppj.EncRowWithHint, error) {
-	cnym, err := mppj.DeserializeCiphertext(msg.Data[:ctLen])
+	if err := checkHeader(msg.Version, msg.Group); err != nil {
+		return mppj.EncRowWithHint{}, err
+	}
+	cnym, err := getCiphertextFromMsg(msg.Cnyme, "Cnyme")
 	if err != nil {
 		return mppj.EncRowWithHint{}, err
 	}
-	cvalKey, err := mppj.DeserializeCiphertext(msg.Data[ctLen : 2*ctLen])
+	cvalKey, err := getCiphertextFromMsg(msg.CValKey, "CValKey")
 	if err != nil {
 		return mppj.EncRowWithHint{}, err
 	}
-	chint, err := mppj.DeserializeCiphertext(msg.Data[2*ctLen : 3*ctLen])
+	chint, err := getCiphertextFromMsg(msg.CHint, "CHint")
 	if err != nil {
 		return mppj.EncRowWithHint{}, err
 	}
+	if len(msg.CVal) == 0 {
+		return mppj.EncRowWithHint{}, fmt.Errorf("%w: missing CVal", ErrMalformedMessage)
+	}
 	return mppj.EncRowWithHint{
 		Cnyme:   *cnym,
-		CVal:    msg.Data[3*ctLen:],
+		CVal:    msg.CVal,
 		CValKey: *cvalKey,
 		CHint:   *chint,
 	}, nil
 }
+
+// GetEncRowBatchMsg converts the rows into a batch message.
+func GetEncRowBatchMsg(ers []mppj.EncRow) (*pb.EncRowBatch, error) {
+	batch := &pb.EncRowBatch{Rows: make([]*pb.EncRow, len(ers))}
+	for i, er := range ers {
+		msg, err := GetEncRowMsg(er)
+		if err != nil {
+			return nil, err
+		}
+		batch.Rows[i] = msg
+	}
+	return batch, nil
+}
+
+// GetEncRowsFromBatchMsg converts a batch message into rows.
+func GetEncRowsFromBatchMsg(batch *pb.EncRowBatch) ([]mppj.EncRow, error) {
+	ers := make([]mppj.EncRow, len(batch.Rows))
+	for i, msg := range batch.Rows {
+		er, err := GetEncRowFromMsg(msg)
+		if err != nil {
+			return nil, err
+		}
+		ers[i] = er
+	}
+	return ers, nil
+}
+
+// GetEncRowWithHintBatchMsg converts the rows into a batch message.
+func GetEncRowWithHintBatchMsg(ers []mppj.EncRowWithHint) (*pb.EncRowWithHintBatch, error) {
+	batch := &pb.EncRowWithHintBatch{Rows: make([]*pb.EncRowWithHint, len(ers))}
+	for i, er := range ers {
+		msg, err := GetEncRowWithHintMsg(er)
+		if err != nil {
+			return nil, err
+		}
+		batch.Rows[i] = msg
+	}
+	return batch, nil
+}
+
+// Setup is the setup message of a session, which the receiver sends to the other parties. It is not
+// authenticated by the messages: the parties check it against the session's parameters (e.g., its manifest).
+type Setup struct {
+	SessionID  []byte
+	ReceiverPK mppj.PublicKeyTuple
+}
+
+// GetSetupMsg converts the setup into a message.
+func GetSetupMsg(setup Setup) (*pb.Setup, error) {
+	rpk, err := setup.ReceiverPK.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return &pb.Setup{
+		Version:    ProtocolVersion,
+		Group:      Group,
+		SessionID:  setup.SessionID,
+		ReceiverPK: rpk,
+	}, nil
+}
+
+// GetSetupFromMsg converts a message into a setup.
+func GetSetupFromMsg(msg *pb.Setup) (Setup, error) {
+	if err := checkHeader(msg.Version, msg.Group); err != nil {
+		return Setup{}, err
+	}
+	if len(msg.SessionID) == 0 {
+		return Setup{}, fmt.Errorf("%w: missing SessionID", ErrMalformedMessage)
+	}
+	var rpk mppj.PublicKeyTuple
+	if err := rpk.UnmarshalBinary(msg.ReceiverPK); err != nil {
+		return Setup{}, fmt.Errorf("%w: invalid ReceiverPK: %v", ErrMalformedMessage, err)
+	}
+	return Setup{SessionID: msg.SessionID, ReceiverPK: rpk}, nil
+}
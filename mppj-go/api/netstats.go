@@ -2,15 +2,23 @@ package api
 
 import (
 	"fmt"
+	"mppj"
 	"sync"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc/stats"
 )
 
-// NetStats contains the network statistics of a connection.
+// NetStats contains the network statistics of a connection, or of a subset of its RPCs.
 type NetStats struct {
-	DataSent, DataRecv uint64
+	DataSent   uint64        `json:"data_sent"` // the bytes of the messages sent on the wire
+	DataRecv   uint64        `json:"data_recv"` // the bytes of the messages received on the wire
+	MsgsSent   uint64        `json:"msgs_sent"`
+	MsgsRecv   uint64        `json:"msgs_recv"`
+	RPCs       uint64        `json:"rpcs"`        // the number of completed RPCs
+	StreamTime time.Duration `json:"stream_time"` // the total duration of the completed RPCs
 }
 
 // String returns a string representation of the network statistics.
@@ -18,32 +26,132 @@ func (s NetStats) String() string {
 	return fmt.Sprintf("Sent: %s, Received: %s", byteCountSI(s.DataSent), byteCountSI(s.DataRecv))
 }
 
+// add accounts for the RPC event sta.
+func (s *NetStats) add(sta stats.RPCStats) {
+	switch sta := sta.(type) {
+	case *stats.End:
+		s.RPCs++
+		s.StreamTime += sta.EndTime.Sub(sta.BeginTime)
+	case *stats.InPayload:
+		s.DataRecv += uint64(sta.WireLength)
+		s.MsgsRecv++
+	case *stats.OutPayload:
+		s.DataSent += uint64(sta.WireLength)
+		s.MsgsSent++
+	}
+}
+
+// Stats contains the network statistics of all the RPCs, and per source and per method. The RPCs without a
+// source ID (e.g., the receiver's) only count in the total and per method, and those with the ID of a source
+// which is not one of the handler's count under UnknownSource.
+type Stats struct {
+	NetStats
+	BySource map[mppj.SourceID]NetStats
+	ByMethod map[string]NetStats
+}
+
+// statsHandler records the network statistics of the RPCs, in total, per source and per method. It is also a
+// prometheus.Collector for the statistics per source and per method.
 type statsHandler struct {
-	mu sync.Mutex
-	ns NetStats
+	sources  map[mppj.SourceID]bool // the sources which are labelled by their ID
+	mu       sync.Mutex
+	ns       NetStats
+	bySource map[mppj.SourceID]*NetStats
+	byMethod map[string]*methodStats
 }
 
-func NewStatsHandler() *statsHandler {
-	return new(statsHandler)
+type methodStats struct {
+	NetStats
+	active int // the number of RPCs in progress
+}
+
+// rpcTag identifies the method and source of an RPC, in its context.
+type rpcTag struct {
+	method string
+	source mppj.SourceID // empty if the RPC has no source ID
+}
+
+type rpcTagKey struct{}
+
+var (
+	rpcBytesDesc = prometheus.NewDesc("mppj_rpc_bytes_total",
+		"The bytes sent and received on the wire, per RPC method.", []string{"method", "direction"}, nil)
+	rpcMessagesDesc = prometheus.NewDesc("mppj_rpc_messages_total",
+		"The messages sent and received, per RPC method.", []string{"method", "direction"}, nil)
+	rpcActiveDesc = prometheus.NewDesc("mppj_rpc_active",
+		"The number of RPCs in progress, per method.", []string{"method"}, nil)
+	sourceBytesDesc = prometheus.NewDesc("mppj_source_bytes_total",
+		"The bytes sent and received on the wire, per source.", []string{"source", "direction"}, nil)
+)
+
+// UnknownSource is the source label of the RPCs with the ID of a source which is not one of the stats handler's.
+const UnknownSource mppj.SourceID = "unknown"
+
+// NewStatsHandler returns a stats handler which records the statistics of the sources by their ID. As the
+// source IDs of the RPCs are not authenticated, any other source counts under UnknownSource, so that the
+// number of labels is bounded.
+func NewStatsHandler(sources ...mppj.SourceID) *statsHandler {
+	s := &statsHandler{
+		sources:  make(map[mppj.SourceID]bool, len(sources)),
+		bySource: make(map[mppj.SourceID]*NetStats),
+		byMethod: make(map[string]*methodStats),
+	}
+	for _, id := range sources {
+		s.sources[id] = true
+	}
+	return s
 }
 
 // TagRPC can attach some information to the given context.
 // The context used for the rest lifetime of the RPC will be derived from
-// the returned context.
-func (s *statsHandler) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
-	return ctx
+// the returned context. It tags the RPC with its method, and with the source
+// ID of its metadata (incoming on the helper, outgoing on the sources), or
+// UnknownSource if it is not one of the handler's.
+func (s *statsHandler) TagRPC(ctx context.Context, info *stats.RPCTagInfo) context.Context {
+	tag := &rpcTag{method: info.FullMethodName}
+	if id, ok := mppj.SourceIDFromIncomingContext(ctx); ok {
+		tag.source = id
+	} else if id, ok := mppj.SourceIDFromOutgoingContext(ctx); ok {
+		tag.source = id
+	}
+	if tag.source != "" && !s.sources[tag.source] {
+		tag.source = UnknownSource
+	}
+	return context.WithValue(ctx, rpcTagKey{}, tag)
 }
 
 // HandleRPC processes the RPC stats.
 func (s *statsHandler) HandleRPC(ctx context.Context, sta stats.RPCStats) {
 
+	tag, ok := ctx.Value(rpcTagKey{}).(*rpcTag)
+	if !ok {
+		tag = new(rpcTag)
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	switch sta := sta.(type) {
-	case *stats.InPayload:
-		s.ns.DataRecv += uint64(sta.WireLength)
-	case *stats.OutPayload:
-		s.ns.DataSent += uint64(sta.WireLength)
+	s.ns.add(sta)
+
+	ms, ok := s.byMethod[tag.method]
+	if !ok {
+		ms = new(methodStats)
+		s.byMethod[tag.method] = ms
+	}
+	ms.add(sta)
+	switch sta.(type) {
+	case *stats.Begin:
+		ms.active++
+	case *stats.End:
+		ms.active--
+	}
+
+	if tag.source != "" {
+		ss, ok := s.bySource[tag.source]
+		if !ok {
+			ss = new(NetStats)
+			s.bySource[tag.source] = ss
+		}
+		ss.add(sta)
 	}
 }
 
@@ -62,10 +170,47 @@ func (s *statsHandler) TagConn(ctx context.Context, _ *stats.ConnTagInfo) contex
 // HandleConn processes the Conn stats.
 func (s *statsHandler) HandleConn(_ context.Context, sta stats.ConnStats) {}
 
-func (s *statsHandler) GetStats() NetStats {
+// GetStats returns a copy of the statistics so far.
+func (s *statsHandler) GetStats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := Stats{
+		NetStats: s.ns,
+		BySource: make(map[mppj.SourceID]NetStats, len(s.bySource)),
+		ByMethod: make(map[string]NetStats, len(s.byMethod)),
+	}
+	for source, ss := range s.bySource {
+		st.BySource[source] = *ss
+	}
+	for method, ms := range s.byMethod {
+		st.ByMethod[method] = ms.NetStats
+	}
+	return st
+}
+
+// Describe implements prometheus.Collector.
+func (s *statsHandler) Describe(ch chan<- *prometheus.Desc) {
+	ch <- rpcBytesDesc
+	ch <- rpcMessagesDesc
+	ch <- rpcActiveDesc
+	ch <- sourceBytesDesc
+}
+
+// Collect implements prometheus.Collector.
+func (s *statsHandler) Collect(ch chan<- prometheus.Metric) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	return s.ns
+	for method, ms := range s.byMethod {
+		ch <- prometheus.MustNewConstMetric(rpcBytesDesc, prometheus.CounterValue, float64(ms.DataSent), method, "sent")
+		ch <- prometheus.MustNewConstMetric(rpcBytesDesc, prometheus.CounterValue, float64(ms.DataRecv), method, "received")
+		ch <- prometheus.MustNewConstMetric(rpcMessagesDesc, prometheus.CounterValue, float64(ms.MsgsSent), method, "sent")
+		ch <- prometheus.MustNewConstMetric(rpcMessagesDesc, prometheus.CounterValue, float64(ms.MsgsRecv), method, "received")
+		ch <- prometheus.MustNewConstMetric(rpcActiveDesc, prometheus.GaugeValue, float64(ms.active), method)
+	}
+	for source, ss := range s.bySource {
+		ch <- prometheus.MustNewConstMetric(sourceBytesDesc, prometheus.CounterValue, float64(ss.DataSent), string(source), "sent")
+		ch <- prometheus.MustNewConstMetric(sourceBytesDesc, prometheus.CounterValue, float64(ss.DataRecv), string(source), "received")
+	}
 }
 
 // byteCountSI returns a string representation of a byte count b,
@@ -20,6 +20,100 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
+// The version of the messages, which is incremented on incompatible changes to the protocol or the messages.
+type Version int32
+
+const (
+	Version_VERSION_UNSPECIFIED Version = 0
+	Version_VERSION_1           Version = 1
+)
+
+// Enum value maps for Version.
+var (
+	Version_name = map[int32]string{
+		0: "VERSION_UNSPECIFIED",
+		1: "VERSION_1",
+	}
+	Version_value = map[string]int32{
+		"VERSION_UNSPECIFIED": 0,
+		"VERSION_1":           1,
+	}
+)
+
+func (x Version) Enum() *Version {
+	p := new(Version)
+	*p = x
+	return p
+}
+
+func (x Version) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Version) Descriptor() protoreflect.EnumDescriptor {
+	return file_mppj_proto_enumTypes[0].Descriptor()
+}
+
+func (Version) Type() protoreflect.EnumType {
+	return &file_mppj_proto_enumTypes[0]
+}
+
+func (x Version) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Version.Descriptor instead.
+func (Version) EnumDescriptor() ([]byte, []int) {
+	return file_mppj_proto_rawDescGZIP(), []int{0}
+}
+
+// The group over which the ciphertexts are computed.
+type Group int32
+
+const (
+	Group_GROUP_UNSPECIFIED Group = 0
+	Group_GROUP_P256        Group = 1 // the points are compressed
+)
+
+// Enum value maps for Group.
+var (
+	Group_name = map[int32]string{
+		0: "GROUP_UNSPECIFIED",
+		1: "GROUP_P256",
+	}
+	Group_value = map[string]int32{
+		"GROUP_UNSPECIFIED": 0,
+		"GROUP_P256":        1,
+	}
+)
+
+func (x Group) Enum() *Group {
+	p := new(Group)
+	*p = x
+	return p
+}
+
+func (x Group) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Group) Descriptor() protoreflect.EnumDescriptor {
+	return file_mppj_proto_enumTypes[1].Descriptor()
+}
+
+func (Group) Type() protoreflect.EnumType {
+	return &file_mppj_proto_enumTypes[1]
+}
+
+func (x Group) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Group.Descriptor instead.
+func (Group) EnumDescriptor() ([]byte, []int) {
+	return file_mppj_proto_rawDescGZIP(), []int{1}
+}
+
 type Void struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -56,17 +150,74 @@ func (*Void) Descriptor() ([]byte, []int) {
 	return file_mppj_proto_rawDescGZIP(), []int{0}
 }
 
+// An ElGamal ciphertext (c0, c1).
+type Ciphertext struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	C0 []byte `protobuf:"bytes,1,opt,name=C0,proto3" json:"C0,omitempty"`
+	C1 []byte `protobuf:"bytes,2,opt,name=C1,proto3" json:"C1,omitempty"`
+}
+
+func (x *Ciphertext) Reset() {
+	*x = Ciphertext{}
+	mi := &file_mppj_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Ciphertext) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Ciphertext) ProtoMessage() {}
+
+func (x *Ciphertext) ProtoReflect() protoreflect.Message {
+	mi := &file_mppj_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Ciphertext.ProtoReflect.Descriptor instead.
+func (*Ciphertext) Descriptor() ([]byte, []int) {
+	return file_mppj_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Ciphertext) GetC0() []byte {
+	if x != nil {
+		return x.C0
+	}
+	return nil
+}
+
+func (x *Ciphertext) GetC1() []byte {
+	if x != nil {
+		return x.C1
+	}
+	return nil
+}
+
 type EncRow struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	Data []byte `protobuf:"bytes,1,opt,name=Data,proto3" json:"Data,omitempty"`
+	Version Version       `protobuf:"varint,2,opt,name=Version,proto3,enum=mppj_proto.Version" json:"Version,omitempty"`
+	Group   Group         `protobuf:"varint,3,opt,name=Group,proto3,enum=mppj_proto.Group" json:"Group,omitempty"`
+	Cuid    *Ciphertext   `protobuf:"bytes,4,opt,name=Cuid,proto3" json:"Cuid,omitempty"` // the blinded join key
+	Cval    []*Ciphertext `protobuf:"bytes,5,rep,name=Cval,proto3" json:"Cval,omitempty"` // the encrypted value, PAYLOADSIZE bytes per ciphertext
 }
 
 func (x *EncRow) Reset() {
 	*x = EncRow{}
-	mi := &file_mppj_proto_msgTypes[1]
+	mi := &file_mppj_proto_msgTypes[2]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -78,7 +229,7 @@ func (x *EncRow) String() string {
 func (*EncRow) ProtoMessage() {}
 
 func (x *EncRow) ProtoReflect() protoreflect.Message {
-	mi := &file_mppj_proto_msgTypes[1]
+	mi := &file_mppj_proto_msgTypes[2]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -91,12 +242,33 @@ func (x *EncRow) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use EncRow.ProtoReflect.Descriptor instead.
 func (*EncRow) Descriptor() ([]byte, []int) {
-	return file_mppj_proto_rawDescGZIP(), []int{1}
+	return file_mppj_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *EncRow) GetVersion() Version {
+	if x != nil {
+		return x.Version
+	}
+	return Version_VERSION_UNSPECIFIED
+}
+
+func (x *EncRow) GetGroup() Group {
+	if x != nil {
+		return x.Group
+	}
+	return Group_GROUP_UNSPECIFIED
+}
+
+func (x *EncRow) GetCuid() *Ciphertext {
+	if x != nil {
+		return x.Cuid
+	}
+	return nil
 }
 
-func (x *EncRow) GetData() []byte {
+func (x *EncRow) GetCval() []*Ciphertext {
 	if x != nil {
-		return x.Data
+		return x.Cval
 	}
 	return nil
 }
@@ -106,12 +278,17 @@ type EncRowWithHint struct {
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	Data []byte `protobuf:"bytes,1,opt,name=Data,proto3" json:"Data,omitempty"`
+	Version Version     `protobuf:"varint,2,opt,name=Version,proto3,enum=mppj_proto.Version" json:"Version,omitempty"`
+	Group   Group       `protobuf:"varint,3,opt,name=Group,proto3,enum=mppj_proto.Group" json:"Group,omitempty"`
+	Cnyme   *Ciphertext `protobuf:"bytes,4,opt,name=Cnyme,proto3" json:"Cnyme,omitempty"`     // the encrypted pseudonym
+	CValKey *Ciphertext `protobuf:"bytes,5,opt,name=CValKey,proto3" json:"CValKey,omitempty"` // the encrypted key of the value
+	CHint   *Ciphertext `protobuf:"bytes,6,opt,name=CHint,proto3" json:"CHint,omitempty"`     // the encrypted hint
+	CVal    []byte      `protobuf:"bytes,7,opt,name=CVal,proto3" json:"CVal,omitempty"`       // the symmetrically encrypted value
 }
 
 func (x *EncRowWithHint) Reset() {
 	*x = EncRowWithHint{}
-	mi := &file_mppj_proto_msgTypes[2]
+	mi := &file_mppj_proto_msgTypes[3]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -123,7 +300,7 @@ func (x *EncRowWithHint) String() string {
 func (*EncRowWithHint) ProtoMessage() {}
 
 func (x *EncRowWithHint) ProtoReflect() protoreflect.Message {
-	mi := &file_mppj_proto_msgTypes[2]
+	mi := &file_mppj_proto_msgTypes[3]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -136,12 +313,252 @@ func (x *EncRowWithHint) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use EncRowWithHint.ProtoReflect.Descriptor instead.
 func (*EncRowWithHint) Descriptor() ([]byte, []int) {
-	return file_mppj_proto_rawDescGZIP(), []int{2}
+	return file_mppj_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *EncRowWithHint) GetVersion() Version {
+	if x != nil {
+		return x.Version
+	}
+	return Version_VERSION_UNSPECIFIED
 }
 
-func (x *EncRowWithHint) GetData() []byte {
+func (x *EncRowWithHint) GetGroup() Group {
 	if x != nil {
-		return x.Data
+		return x.Group
+	}
+	return Group_GROUP_UNSPECIFIED
+}
+
+func (x *EncRowWithHint) GetCnyme() *Ciphertext {
+	if x != nil {
+		return x.Cnyme
+	}
+	return nil
+}
+
+func (x *EncRowWithHint) GetCValKey() *Ciphertext {
+	if x != nil {
+		return x.CValKey
+	}
+	return nil
+}
+
+func (x *EncRowWithHint) GetCHint() *Ciphertext {
+	if x != nil {
+		return x.CHint
+	}
+	return nil
+}
+
+func (x *EncRowWithHint) GetCVal() []byte {
+	if x != nil {
+		return x.CVal
+	}
+	return nil
+}
+
+type EncRowBatch struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Rows []*EncRow `protobuf:"bytes,1,rep,name=Rows,proto3" json:"Rows,omitempty"`
+}
+
+func (x *EncRowBatch) Reset() {
+	*x = EncRowBatch{}
+	mi := &file_mppj_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EncRowBatch) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EncRowBatch) ProtoMessage() {}
+
+func (x *EncRowBatch) ProtoReflect() protoreflect.Message {
+	mi := &file_mppj_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EncRowBatch.ProtoReflect.Descriptor instead.
+func (*EncRowBatch) Descriptor() ([]byte, []int) {
+	return file_mppj_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *EncRowBatch) GetRows() []*EncRow {
+	if x != nil {
+		return x.Rows
+	}
+	return nil
+}
+
+type EncRowWithHintBatch struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Rows []*EncRowWithHint `protobuf:"bytes,1,rep,name=Rows,proto3" json:"Rows,omitempty"`
+}
+
+func (x *EncRowWithHintBatch) Reset() {
+	*x = EncRowWithHintBatch{}
+	mi := &file_mppj_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EncRowWithHintBatch) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EncRowWithHintBatch) ProtoMessage() {}
+
+func (x *EncRowWithHintBatch) ProtoReflect() protoreflect.Message {
+	mi := &file_mppj_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EncRowWithHintBatch.ProtoReflect.Descriptor instead.
+func (*EncRowWithHintBatch) Descriptor() ([]byte, []int) {
+	return file_mppj_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *EncRowWithHintBatch) GetRows() []*EncRowWithHint {
+	if x != nil {
+		return x.Rows
+	}
+	return nil
+}
+
+type BatchRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	BatchSize uint32 `protobuf:"varint,1,opt,name=BatchSize,proto3" json:"BatchSize,omitempty"` // the maximum number of rows per message
+}
+
+func (x *BatchRequest) Reset() {
+	*x = BatchRequest{}
+	mi := &file_mppj_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BatchRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchRequest) ProtoMessage() {}
+
+func (x *BatchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_mppj_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchRequest.ProtoReflect.Descriptor instead.
+func (*BatchRequest) Descriptor() ([]byte, []int) {
+	return file_mppj_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *BatchRequest) GetBatchSize() uint32 {
+	if x != nil {
+		return x.BatchSize
+	}
+	return 0
+}
+
+// The setup message of a session, with the parameters which the receiver announces to the other parties.
+type Setup struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Version    Version `protobuf:"varint,1,opt,name=Version,proto3,enum=mppj_proto.Version" json:"Version,omitempty"`
+	Group      Group   `protobuf:"varint,2,opt,name=Group,proto3,enum=mppj_proto.Group" json:"Group,omitempty"`
+	SessionID  []byte  `protobuf:"bytes,3,opt,name=SessionID,proto3" json:"SessionID,omitempty"`
+	ReceiverPK []byte  `protobuf:"bytes,4,opt,name=ReceiverPK,proto3" json:"ReceiverPK,omitempty"` // the marshalled public key tuple of the receiver
+}
+
+func (x *Setup) Reset() {
+	*x = Setup{}
+	mi := &file_mppj_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Setup) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Setup) ProtoMessage() {}
+
+func (x *Setup) ProtoReflect() protoreflect.Message {
+	mi := &file_mppj_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Setup.ProtoReflect.Descriptor instead.
+func (*Setup) Descriptor() ([]byte, []int) {
+	return file_mppj_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *Setup) GetVersion() Version {
+	if x != nil {
+		return x.Version
+	}
+	return Version_VERSION_UNSPECIFIED
+}
+
+func (x *Setup) GetGroup() Group {
+	if x != nil {
+		return x.Group
+	}
+	return Group_GROUP_UNSPECIFIED
+}
+
+func (x *Setup) GetSessionID() []byte {
+	if x != nil {
+		return x.SessionID
+	}
+	return nil
+}
+
+func (x *Setup) GetReceiverPK() []byte {
+	if x != nil {
+		return x.ReceiverPK
 	}
 	return nil
 }
@@ -151,20 +568,90 @@ var File_mppj_proto protoreflect.FileDescriptor
 var file_mppj_proto_rawDesc = []byte{
 	0x0a, 0x0a, 0x6d, 0x70, 0x70, 0x6a, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x0a, 0x6d, 0x70,
 	0x70, 0x6a, 0x5f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0x06, 0x0a, 0x04, 0x56, 0x6f, 0x69, 0x64,
-	0x22, 0x1c, 0x0a, 0x06, 0x45, 0x6e, 0x63, 0x52, 0x6f, 0x77, 0x12, 0x12, 0x0a, 0x04, 0x44, 0x61,
-	0x74, 0x61, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x04, 0x44, 0x61, 0x74, 0x61, 0x22, 0x24,
-	0x0a, 0x0e, 0x45, 0x6e, 0x63, 0x52, 0x6f, 0x77, 0x57, 0x69, 0x74, 0x68, 0x48, 0x69, 0x6e, 0x74,
-	0x12, 0x12, 0x0a, 0x04, 0x44, 0x61, 0x74, 0x61, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x04,
-	0x44, 0x61, 0x74, 0x61, 0x32, 0x7c, 0x0a, 0x0a, 0x4d, 0x50, 0x50, 0x4a, 0x48, 0x65, 0x6c, 0x70,
-	0x65, 0x72, 0x12, 0x32, 0x0a, 0x08, 0x50, 0x75, 0x73, 0x68, 0x52, 0x6f, 0x77, 0x73, 0x12, 0x12,
+	0x22, 0x2c, 0x0a, 0x0a, 0x43, 0x69, 0x70, 0x68, 0x65, 0x72, 0x74, 0x65, 0x78, 0x74, 0x12, 0x0e,
+	0x0a, 0x02, 0x43, 0x30, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x02, 0x43, 0x30, 0x12, 0x0e,
+	0x0a, 0x02, 0x43, 0x31, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x02, 0x43, 0x31, 0x22, 0xc4,
+	0x01, 0x0a, 0x06, 0x45, 0x6e, 0x63, 0x52, 0x6f, 0x77, 0x12, 0x2d, 0x0a, 0x07, 0x56, 0x65, 0x72,
+	0x73, 0x69, 0x6f, 0x6e, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x13, 0x2e, 0x6d, 0x70, 0x70,
+	0x6a, 0x5f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x52,
+	0x07, 0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x27, 0x0a, 0x05, 0x47, 0x72, 0x6f, 0x75,
+	0x70, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x11, 0x2e, 0x6d, 0x70, 0x70, 0x6a, 0x5f, 0x70,
+	0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x47, 0x72, 0x6f, 0x75, 0x70, 0x52, 0x05, 0x47, 0x72, 0x6f, 0x75,
+	0x70, 0x12, 0x2a, 0x0a, 0x04, 0x43, 0x75, 0x69, 0x64, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0b, 0x32,
+	0x16, 0x2e, 0x6d, 0x70, 0x70, 0x6a, 0x5f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x43, 0x69, 0x70,
+	0x68, 0x65, 0x72, 0x74, 0x65, 0x78, 0x74, 0x52, 0x04, 0x43, 0x75, 0x69, 0x64, 0x12, 0x2a, 0x0a,
+	0x04, 0x43, 0x76, 0x61, 0x6c, 0x18, 0x05, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x16, 0x2e, 0x6d, 0x70,
+	0x70, 0x6a, 0x5f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x43, 0x69, 0x70, 0x68, 0x65, 0x72, 0x74,
+	0x65, 0x78, 0x74, 0x52, 0x04, 0x43, 0x76, 0x61, 0x6c, 0x4a, 0x04, 0x08, 0x01, 0x10, 0x02, 0x52,
+	0x04, 0x44, 0x61, 0x74, 0x61, 0x22, 0x96, 0x02, 0x0a, 0x0e, 0x45, 0x6e, 0x63, 0x52, 0x6f, 0x77,
+	0x57, 0x69, 0x74, 0x68, 0x48, 0x69, 0x6e, 0x74, 0x12, 0x2d, 0x0a, 0x07, 0x56, 0x65, 0x72, 0x73,
+	0x69, 0x6f, 0x6e, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x13, 0x2e, 0x6d, 0x70, 0x70, 0x6a,
+	0x5f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x52, 0x07,
+	0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x27, 0x0a, 0x05, 0x47, 0x72, 0x6f, 0x75, 0x70,
+	0x18, 0x03, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x11, 0x2e, 0x6d, 0x70, 0x70, 0x6a, 0x5f, 0x70, 0x72,
+	0x6f, 0x74, 0x6f, 0x2e, 0x47, 0x72, 0x6f, 0x75, 0x70, 0x52, 0x05, 0x47, 0x72, 0x6f, 0x75, 0x70,
+	0x12, 0x2c, 0x0a, 0x05, 0x43, 0x6e, 0x79, 0x6d, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0b, 0x32,
+	0x16, 0x2e, 0x6d, 0x70, 0x70, 0x6a, 0x5f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x43, 0x69, 0x70,
+	0x68, 0x65, 0x72, 0x74, 0x65, 0x78, 0x74, 0x52, 0x05, 0x43, 0x6e, 0x79, 0x6d, 0x65, 0x12, 0x30,
+	0x0a, 0x07, 0x43, 0x56, 0x61, 0x6c, 0x4b, 0x65, 0x79, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0b, 0x32,
+	0x16, 0x2e, 0x6d, 0x70, 0x70, 0x6a, 0x5f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x43, 0x69, 0x70,
+	0x68, 0x65, 0x72, 0x74, 0x65, 0x78, 0x74, 0x52, 0x07, 0x43, 0x56, 0x61, 0x6c, 0x4b, 0x65, 0x79,
+	0x12, 0x2c, 0x0a, 0x05, 0x43, 0x48, 0x69, 0x6e, 0x74, 0x18, 0x06, 0x20, 0x01, 0x28, 0x0b, 0x32,
+	0x16, 0x2e, 0x6d, 0x70, 0x70, 0x6a, 0x5f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x43, 0x69, 0x70,
+	0x68, 0x65, 0x72, 0x74, 0x65, 0x78, 0x74, 0x52, 0x05, 0x43, 0x48, 0x69, 0x6e, 0x74, 0x12, 0x12,
+	0x0a, 0x04, 0x43, 0x56, 0x61, 0x6c, 0x18, 0x07, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x04, 0x43, 0x56,
+	0x61, 0x6c, 0x4a, 0x04, 0x08, 0x01, 0x10, 0x02, 0x52, 0x04, 0x44, 0x61, 0x74, 0x61, 0x22, 0x35,
+	0x0a, 0x0b, 0x45, 0x6e, 0x63, 0x52, 0x6f, 0x77, 0x42, 0x61, 0x74, 0x63, 0x68, 0x12, 0x26, 0x0a,
+	0x04, 0x52, 0x6f, 0x77, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x12, 0x2e, 0x6d, 0x70,
+	0x70, 0x6a, 0x5f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x45, 0x6e, 0x63, 0x52, 0x6f, 0x77, 0x52,
+	0x04, 0x52, 0x6f, 0x77, 0x73, 0x22, 0x45, 0x0a, 0x13, 0x45, 0x6e, 0x63, 0x52, 0x6f, 0x77, 0x57,
+	0x69, 0x74, 0x68, 0x48, 0x69, 0x6e, 0x74, 0x42, 0x61, 0x74, 0x63, 0x68, 0x12, 0x2e, 0x0a, 0x04,
+	0x52, 0x6f, 0x77, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x6d, 0x70, 0x70,
+	0x6a, 0x5f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x45, 0x6e, 0x63, 0x52, 0x6f, 0x77, 0x57, 0x69,
+	0x74, 0x68, 0x48, 0x69, 0x6e, 0x74, 0x52, 0x04, 0x52, 0x6f, 0x77, 0x73, 0x22, 0x2c, 0x0a, 0x0c,
+	0x42, 0x61, 0x74, 0x63, 0x68, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x1c, 0x0a, 0x09,
+	0x42, 0x61, 0x74, 0x63, 0x68, 0x53, 0x69, 0x7a, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0d, 0x52,
+	0x09, 0x42, 0x61, 0x74, 0x63, 0x68, 0x53, 0x69, 0x7a, 0x65, 0x22, 0x9d, 0x01, 0x0a, 0x05, 0x53,
+	0x65, 0x74, 0x75, 0x70, 0x12, 0x2d, 0x0a, 0x07, 0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x18,
+	0x01, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x13, 0x2e, 0x6d, 0x70, 0x70, 0x6a, 0x5f, 0x70, 0x72, 0x6f,
+	0x74, 0x6f, 0x2e, 0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x52, 0x07, 0x56, 0x65, 0x72, 0x73,
+	0x69, 0x6f, 0x6e, 0x12, 0x27, 0x0a, 0x05, 0x47, 0x72, 0x6f, 0x75, 0x70, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x0e, 0x32, 0x11, 0x2e, 0x6d, 0x70, 0x70, 0x6a, 0x5f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e,
+	0x47, 0x72, 0x6f, 0x75, 0x70, 0x52, 0x05, 0x47, 0x72, 0x6f, 0x75, 0x70, 0x12, 0x1c, 0x0a, 0x09,
+	0x53, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x49, 0x44, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0c, 0x52,
+	0x09, 0x53, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x49, 0x44, 0x12, 0x1e, 0x0a, 0x0a, 0x52, 0x65,
+	0x63, 0x65, 0x69, 0x76, 0x65, 0x72, 0x50, 0x4b, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x0a,
+	0x52, 0x65, 0x63, 0x65, 0x69, 0x76, 0x65, 0x72, 0x50, 0x4b, 0x2a, 0x31, 0x0a, 0x07, 0x56, 0x65,
+	0x72, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x17, 0x0a, 0x13, 0x56, 0x45, 0x52, 0x53, 0x49, 0x4f, 0x4e,
+	0x5f, 0x55, 0x4e, 0x53, 0x50, 0x45, 0x43, 0x49, 0x46, 0x49, 0x45, 0x44, 0x10, 0x00, 0x12, 0x0d,
+	0x0a, 0x09, 0x56, 0x45, 0x52, 0x53, 0x49, 0x4f, 0x4e, 0x5f, 0x31, 0x10, 0x01, 0x2a, 0x2e, 0x0a,
+	0x05, 0x47, 0x72, 0x6f, 0x75, 0x70, 0x12, 0x15, 0x0a, 0x11, 0x47, 0x52, 0x4f, 0x55, 0x50, 0x5f,
+	0x55, 0x4e, 0x53, 0x50, 0x45, 0x43, 0x49, 0x46, 0x49, 0x45, 0x44, 0x10, 0x00, 0x12, 0x0e, 0x0a,
+	0x0a, 0x47, 0x52, 0x4f, 0x55, 0x50, 0x5f, 0x50, 0x32, 0x35, 0x36, 0x10, 0x01, 0x32, 0xed, 0x02,
+	0x0a, 0x0a, 0x4d, 0x50, 0x50, 0x4a, 0x48, 0x65, 0x6c, 0x70, 0x65, 0x72, 0x12, 0x32, 0x0a, 0x08,
+	0x50, 0x75, 0x73, 0x68, 0x52, 0x6f, 0x77, 0x73, 0x12, 0x12, 0x2e, 0x6d, 0x70, 0x70, 0x6a, 0x5f,
+	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x45, 0x6e, 0x63, 0x52, 0x6f, 0x77, 0x1a, 0x10, 0x2e, 0x6d,
+	0x70, 0x70, 0x6a, 0x5f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x56, 0x6f, 0x69, 0x64, 0x28, 0x01,
+	0x12, 0x3a, 0x0a, 0x08, 0x50, 0x75, 0x6c, 0x6c, 0x52, 0x6f, 0x77, 0x73, 0x12, 0x10, 0x2e, 0x6d,
+	0x70, 0x70, 0x6a, 0x5f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x56, 0x6f, 0x69, 0x64, 0x1a, 0x1a,
+	0x2e, 0x6d, 0x70, 0x70, 0x6a, 0x5f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x45, 0x6e, 0x63, 0x52,
+	0x6f, 0x77, 0x57, 0x69, 0x74, 0x68, 0x48, 0x69, 0x6e, 0x74, 0x30, 0x01, 0x12, 0x3d, 0x0a, 0x0e,
+	0x50, 0x75, 0x73, 0x68, 0x52, 0x6f, 0x77, 0x42, 0x61, 0x74, 0x63, 0x68, 0x65, 0x73, 0x12, 0x17,
 	0x2e, 0x6d, 0x70, 0x70, 0x6a, 0x5f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x45, 0x6e, 0x63, 0x52,
-	0x6f, 0x77, 0x1a, 0x10, 0x2e, 0x6d, 0x70, 0x70, 0x6a, 0x5f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e,
-	0x56, 0x6f, 0x69, 0x64, 0x28, 0x01, 0x12, 0x3a, 0x0a, 0x08, 0x50, 0x75, 0x6c, 0x6c, 0x52, 0x6f,
-	0x77, 0x73, 0x12, 0x10, 0x2e, 0x6d, 0x70, 0x70, 0x6a, 0x5f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e,
-	0x56, 0x6f, 0x69, 0x64, 0x1a, 0x1a, 0x2e, 0x6d, 0x70, 0x70, 0x6a, 0x5f, 0x70, 0x72, 0x6f, 0x74,
-	0x6f, 0x2e, 0x45, 0x6e, 0x63, 0x52, 0x6f, 0x77, 0x57, 0x69, 0x74, 0x68, 0x48, 0x69, 0x6e, 0x74,
-	0x30, 0x01, 0x42, 0x09, 0x5a, 0x07, 0x6d, 0x70, 0x70, 0x6a, 0x2f, 0x70, 0x62, 0x62, 0x06, 0x70,
-	0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x6f, 0x77, 0x42, 0x61, 0x74, 0x63, 0x68, 0x1a, 0x10, 0x2e, 0x6d, 0x70, 0x70, 0x6a, 0x5f, 0x70,
+	0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x56, 0x6f, 0x69, 0x64, 0x28, 0x01, 0x12, 0x4d, 0x0a, 0x0e, 0x50,
+	0x75, 0x6c, 0x6c, 0x52, 0x6f, 0x77, 0x42, 0x61, 0x74, 0x63, 0x68, 0x65, 0x73, 0x12, 0x18, 0x2e,
+	0x6d, 0x70, 0x70, 0x6a, 0x5f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x42, 0x61, 0x74, 0x63, 0x68,
+	0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x1f, 0x2e, 0x6d, 0x70, 0x70, 0x6a, 0x5f, 0x70,
+	0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x45, 0x6e, 0x63, 0x52, 0x6f, 0x77, 0x57, 0x69, 0x74, 0x68, 0x48,
+	0x69, 0x6e, 0x74, 0x42, 0x61, 0x74, 0x63, 0x68, 0x30, 0x01, 0x12, 0x30, 0x0a, 0x09, 0x53, 0x65,
+	0x6e, 0x64, 0x53, 0x65, 0x74, 0x75, 0x70, 0x12, 0x11, 0x2e, 0x6d, 0x70, 0x70, 0x6a, 0x5f, 0x70,
+	0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x53, 0x65, 0x74, 0x75, 0x70, 0x1a, 0x10, 0x2e, 0x6d, 0x70, 0x70,
+	0x6a, 0x5f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x56, 0x6f, 0x69, 0x64, 0x12, 0x2f, 0x0a, 0x08,
+	0x47, 0x65, 0x74, 0x53, 0x65, 0x74, 0x75, 0x70, 0x12, 0x10, 0x2e, 0x6d, 0x70, 0x70, 0x6a, 0x5f,
+	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x56, 0x6f, 0x69, 0x64, 0x1a, 0x11, 0x2e, 0x6d, 0x70, 0x70,
+	0x6a, 0x5f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2e, 0x53, 0x65, 0x74, 0x75, 0x70, 0x42, 0x09, 0x5a,
+	0x07, 0x6d, 0x70, 0x70, 0x6a, 0x2f, 0x70, 0x62, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -179,22 +666,51 @@ func file_mppj_proto_rawDescGZIP() []byte {
 	return file_mppj_proto_rawDescData
 }
 
-var file_mppj_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
+var file_mppj_proto_enumTypes = make([]protoimpl.EnumInfo, 2)
+var file_mppj_proto_msgTypes = make([]protoimpl.MessageInfo, 8)
 var file_mppj_proto_goTypes = []any{
-	(*Void)(nil),           // 0: mppj_proto.Void
-	(*EncRow)(nil),         // 1: mppj_proto.EncRow
-	(*EncRowWithHint)(nil), // 2: mppj_proto.EncRowWithHint
+	(Version)(0),                // 0: mppj_proto.Version
+	(Group)(0),                  // 1: mppj_proto.Group
+	(*Void)(nil),                // 2: mppj_proto.Void
+	(*Ciphertext)(nil),          // 3: mppj_proto.Ciphertext
+	(*EncRow)(nil),              // 4: mppj_proto.EncRow
+	(*EncRowWithHint)(nil),      // 5: mppj_proto.EncRowWithHint
+	(*EncRowBatch)(nil),         // 6: mppj_proto.EncRowBatch
+	(*EncRowWithHintBatch)(nil), // 7: mppj_proto.EncRowWithHintBatch
+	(*BatchRequest)(nil),        // 8: mppj_proto.BatchRequest
+	(*Setup)(nil),               // 9: mppj_proto.Setup
 }
 var file_mppj_proto_depIdxs = []int32{
-	1, // 0: mppj_proto.MPPJHelper.PushRows:input_type -> mppj_proto.EncRow
-	0, // 1: mppj_proto.MPPJHelper.PullRows:input_type -> mppj_proto.Void
-	0, // 2: mppj_proto.MPPJHelper.PushRows:output_type -> mppj_proto.Void
-	2, // 3: mppj_proto.MPPJHelper.PullRows:output_type -> mppj_proto.EncRowWithHint
-	2, // [2:4] is the sub-list for method output_type
-	0, // [0:2] is the sub-list for method input_type
-	0, // [0:0] is the sub-list for extension type_name
-	0, // [0:0] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
+	0,  // 0: mppj_proto.EncRow.Version:type_name -> mppj_proto.Version
+	1,  // 1: mppj_proto.EncRow.Group:type_name -> mppj_proto.Group
+	3,  // 2: mppj_proto.EncRow.Cuid:type_name -> mppj_proto.Ciphertext
+	3,  // 3: mppj_proto.EncRow.Cval:type_name -> mppj_proto.Ciphertext
+	0,  // 4: mppj_proto.EncRowWithHint.Version:type_name -> mppj_proto.Version
+	1,  // 5: mppj_proto.EncRowWithHint.Group:type_name -> mppj_proto.Group
+	3,  // 6: mppj_proto.EncRowWithHint.Cnyme:type_name -> mppj_proto.Ciphertext
+	3,  // 7: mppj_proto.EncRowWithHint.CValKey:type_name -> mppj_proto.Ciphertext
+	3,  // 8: mppj_proto.EncRowWithHint.CHint:type_name -> mppj_proto.Ciphertext
+	4,  // 9: mppj_proto.EncRowBatch.Rows:type_name -> mppj_proto.EncRow
+	5,  // 10: mppj_proto.EncRowWithHintBatch.Rows:type_name -> mppj_proto.EncRowWithHint
+	0,  // 11: mppj_proto.Setup.Version:type_name -> mppj_proto.Version
+	1,  // 12: mppj_proto.Setup.Group:type_name -> mppj_proto.Group
+	4,  // 13: mppj_proto.MPPJHelper.PushRows:input_type -> mppj_proto.EncRow
+	2,  // 14: mppj_proto.MPPJHelper.PullRows:input_type -> mppj_proto.Void
+	6,  // 15: mppj_proto.MPPJHelper.PushRowBatches:input_type -> mppj_proto.EncRowBatch
+	8,  // 16: mppj_proto.MPPJHelper.PullRowBatches:input_type -> mppj_proto.BatchRequest
+	9,  // 17: mppj_proto.MPPJHelper.SendSetup:input_type -> mppj_proto.Setup
+	2,  // 18: mppj_proto.MPPJHelper.GetSetup:input_type -> mppj_proto.Void
+	2,  // 19: mppj_proto.MPPJHelper.PushRows:output_type -> mppj_proto.Void
+	5,  // 20: mppj_proto.MPPJHelper.PullRows:output_type -> mppj_proto.EncRowWithHint
+	2,  // 21: mppj_proto.MPPJHelper.PushRowBatches:output_type -> mppj_proto.Void
+	7,  // 22: mppj_proto.MPPJHelper.PullRowBatches:output_type -> mppj_proto.EncRowWithHintBatch
+	2,  // 23: mppj_proto.MPPJHelper.SendSetup:output_type -> mppj_proto.Void
+	9,  // 24: mppj_proto.MPPJHelper.GetSetup:output_type -> mppj_proto.Setup
+	19, // [19:25] is the sub-list for method output_type
+	13, // [13:19] is the sub-list for method input_type
+	13, // [13:13] is the sub-list for extension type_name
+	13, // [13:13] is the sub-list for extension extendee
+	0,  // [0:13] is the sub-list for field type_name
 }
 
 func init() { file_mppj_proto_init() }
@@ -207,13 +723,14 @@ func file_mppj_proto_init() {
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_mppj_proto_rawDesc,
-			NumEnums:      0,
-			NumMessages:   3,
+			NumEnums:      2,
+			NumMessages:   8,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
 		GoTypes:           file_mppj_proto_goTypes,
 		DependencyIndexes: file_mppj_proto_depIdxs,
+		EnumInfos:         file_mppj_proto_enumTypes,
 		MessageInfos:      file_mppj_proto_msgTypes,
 	}.Build()
 	File_mppj_proto = out.File
@@ -19,8 +19,12 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	MPPJHelper_PushRows_FullMethodName = "/mppj_proto.MPPJHelper/PushRows"
-	MPPJHelper_PullRows_FullMethodName = "/mppj_proto.MPPJHelper/PullRows"
+	MPPJHelper_PushRows_FullMethodName       = "/mppj_proto.MPPJHelper/PushRows"
+	MPPJHelper_PullRows_FullMethodName       = "/mppj_proto.MPPJHelper/PullRows"
+	MPPJHelper_PushRowBatches_FullMethodName = "/mppj_proto.MPPJHelper/PushRowBatches"
+	MPPJHelper_PullRowBatches_FullMethodName = "/mppj_proto.MPPJHelper/PullRowBatches"
+	MPPJHelper_SendSetup_FullMethodName      = "/mppj_proto.MPPJHelper/SendSetup"
+	MPPJHelper_GetSetup_FullMethodName       = "/mppj_proto.MPPJHelper/GetSetup"
 )
 
 // MPPJHelperClient is the client API for MPPJHelper service.
@@ -29,6 +33,12 @@ const (
 type MPPJHelperClient interface {
 	PushRows(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[EncRow, Void], error)
 	PullRows(ctx context.Context, in *Void, opts ...grpc.CallOption) (grpc.ServerStreamingClient[EncRowWithHint], error)
+	// batched variants of PushRows and PullRows, with several rows per message
+	PushRowBatches(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[EncRowBatch, Void], error)
+	PullRowBatches(ctx context.Context, in *BatchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[EncRowWithHintBatch], error)
+	// the setup message of the session, which the receiver sends to the helper and the sources get from it
+	SendSetup(ctx context.Context, in *Setup, opts ...grpc.CallOption) (*Void, error)
+	GetSetup(ctx context.Context, in *Void, opts ...grpc.CallOption) (*Setup, error)
 }
 
 type mPPJHelperClient struct {
@@ -71,12 +81,70 @@ func (c *mPPJHelperClient) PullRows(ctx context.Context, in *Void, opts ...grpc.
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
 type MPPJHelper_PullRowsClient = grpc.ServerStreamingClient[EncRowWithHint]
 
+func (c *mPPJHelperClient) PushRowBatches(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[EncRowBatch, Void], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &MPPJHelper_ServiceDesc.Streams[2], MPPJHelper_PushRowBatches_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[EncRowBatch, Void]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MPPJHelper_PushRowBatchesClient = grpc.ClientStreamingClient[EncRowBatch, Void]
+
+func (c *mPPJHelperClient) PullRowBatches(ctx context.Context, in *BatchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[EncRowWithHintBatch], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &MPPJHelper_ServiceDesc.Streams[3], MPPJHelper_PullRowBatches_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[BatchRequest, EncRowWithHintBatch]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MPPJHelper_PullRowBatchesClient = grpc.ServerStreamingClient[EncRowWithHintBatch]
+
+func (c *mPPJHelperClient) SendSetup(ctx context.Context, in *Setup, opts ...grpc.CallOption) (*Void, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Void)
+	err := c.cc.Invoke(ctx, MPPJHelper_SendSetup_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *mPPJHelperClient) GetSetup(ctx context.Context, in *Void, opts ...grpc.CallOption) (*Setup, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Setup)
+	err := c.cc.Invoke(ctx, MPPJHelper_GetSetup_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // MPPJHelperServer is the server API for MPPJHelper service.
 // All implementations must embed UnimplementedMPPJHelperServer
 // for forward compatibility.
 type MPPJHelperServer interface {
 	PushRows(grpc.ClientStreamingServer[EncRow, Void]) error
 	PullRows(*Void, grpc.ServerStreamingServer[EncRowWithHint]) error
+	// batched variants of PushRows and PullRows, with several rows per message
+	PushRowBatches(grpc.ClientStreamingServer[EncRowBatch, Void]) error
+	PullRowBatches(*BatchRequest, grpc.ServerStreamingServer[EncRowWithHintBatch]) error
+	// the setup message of the session, which the receiver sends to the helper and the sources get from it
+	SendSetup(context.Context, *Setup) (*Void, error)
+	GetSetup(context.Context, *Void) (*Setup, error)
 	mustEmbedUnimplementedMPPJHelperServer()
 }
 
@@ -93,6 +161,18 @@ func (UnimplementedMPPJHelperServer) PushRows(grpc.ClientStreamingServer[EncRow,
 func (UnimplementedMPPJHelperServer) PullRows(*Void, grpc.ServerStreamingServer[EncRowWithHint]) error {
 	return status.Errorf(codes.Unimplemented, "method PullRows not implemented")
 }
+func (UnimplementedMPPJHelperServer) PushRowBatches(grpc.ClientStreamingServer[EncRowBatch, Void]) error {
+	return status.Errorf(codes.Unimplemented, "method PushRowBatches not implemented")
+}
+func (UnimplementedMPPJHelperServer) PullRowBatches(*BatchRequest, grpc.ServerStreamingServer[EncRowWithHintBatch]) error {
+	return status.Errorf(codes.Unimplemented, "method PullRowBatches not implemented")
+}
+func (UnimplementedMPPJHelperServer) SendSetup(context.Context, *Setup) (*Void, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SendSetup not implemented")
+}
+func (UnimplementedMPPJHelperServer) GetSetup(context.Context, *Void) (*Setup, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetSetup not implemented")
+}
 func (UnimplementedMPPJHelperServer) mustEmbedUnimplementedMPPJHelperServer() {}
 func (UnimplementedMPPJHelperServer) testEmbeddedByValue()                    {}
 
@@ -132,13 +212,76 @@ func _MPPJHelper_PullRows_Handler(srv interface{}, stream grpc.ServerStream) err
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
 type MPPJHelper_PullRowsServer = grpc.ServerStreamingServer[EncRowWithHint]
 
+func _MPPJHelper_PushRowBatches_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(MPPJHelperServer).PushRowBatches(&grpc.GenericServerStream[EncRowBatch, Void]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MPPJHelper_PushRowBatchesServer = grpc.ClientStreamingServer[EncRowBatch, Void]
+
+func _MPPJHelper_PullRowBatches_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(BatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(MPPJHelperServer).PullRowBatches(m, &grpc.GenericServerStream[BatchRequest, EncRowWithHintBatch]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MPPJHelper_PullRowBatchesServer = grpc.ServerStreamingServer[EncRowWithHintBatch]
+
+func _MPPJHelper_SendSetup_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Setup)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MPPJHelperServer).SendSetup(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MPPJHelper_SendSetup_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MPPJHelperServer).SendSetup(ctx, req.(*Setup))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MPPJHelper_GetSetup_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Void)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MPPJHelperServer).GetSetup(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MPPJHelper_GetSetup_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MPPJHelperServer).GetSetup(ctx, req.(*Void))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // MPPJHelper_ServiceDesc is the grpc.ServiceDesc for MPPJHelper service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
 var MPPJHelper_ServiceDesc = grpc.ServiceDesc{
 	ServiceName: "mppj_proto.MPPJHelper",
 	HandlerType: (*MPPJHelperServer)(nil),
-	Methods:     []grpc.MethodDesc{},
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "SendSetup",
+			Handler:    _MPPJHelper_SendSetup_Handler,
+		},
+		{
+			MethodName: "GetSetup",
+			Handler:    _MPPJHelper_GetSetup_Handler,
+		},
+	},
 	Streams: []grpc.StreamDesc{
 		{
 			StreamName:    "PushRows",
@@ -150,6 +293,16 @@ var MPPJHelper_ServiceDesc = grpc.ServiceDesc{
 			Handler:       _MPPJHelper_PullRows_Handler,
 			ServerStreams: true,
 		},
+		{
+			StreamName:    "PushRowBatches",
+			Handler:       _MPPJHelper_PushRowBatches_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "PullRowBatches",
+			Handler:       _MPPJHelper_PullRowBatches_Handler,
+			ServerStreams: true,
+		},
 	},
 	Metadata: "mppj.proto",
 }
@@ -1,7 +1,9 @@
 package mppj
 
 import (
+	"context"
 	"fmt"
+	"path/filepath"
 	"strconv"
 	"testing"
 )
@@ -26,6 +28,34 @@ func BenchmarkSourceProcessRow(b *testing.B) {
 	}
 }
 
+func BenchmarkSourceProcessRowPrecomputed(b *testing.B) {
+	sourceIDs := []SourceID{"source1", "source2"}
+	sid := NewSessionID(2, "helper", "receiver", sourceIDs)
+	receiver := NewReceiver(sid, sourceIDs)
+	source := NewDataSource(sid, receiver.GetPK())
+
+	path := filepath.Join(b.TempDir(), "source.pool")
+	if err := source.Precompute(path, b.N, len("value1")); err != nil {
+		b.Fatalf("Precompute failed: %v", err)
+	}
+	pool, err := OpenEncryptionPool(path)
+	if err != nil {
+		b.Fatalf("OpenEncryptionPool failed: %v", err)
+	}
+	defer pool.Close()
+	if err := source.UsePool(pool); err != nil {
+		b.Fatalf("UsePool failed: %v", err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _, err := source.ProcessRow("user1", "value1")
+		if err != nil {
+			b.Fatalf("ProcessRow failed: %v", err)
+		}
+	}
+}
+
 func BenchmarkHelperConvertRow(b *testing.B) {
 	sourceIDs := []SourceID{"source1", "source2"}
 	sid := NewSessionID(2, "helper", "receiver", sourceIDs)
@@ -70,10 +100,83 @@ func BenchmarkOps(b *testing.B) {
 
 	b.Run("PrepareStream", func(b *testing.B) {
 		for b.Loop() {
-			ds.PrepareStream(pk, table)
+			encRows, wait, err := ds.PrepareStream(context.Background(), pk, table)
+			if err != nil {
+				b.Fatalf("PrepareStream failed: %v", err)
+			}
+			for range encRows {
+			}
+			if err := wait(); err != nil {
+				b.Fatalf("PrepareStream failed: %v", err)
+			}
+		}
+	})
+
+}
+
+func BenchmarkFixedBase(b *testing.B) {
+	base := RandomPoint()
+	precomputed := &Point{p: base.p}
+	if err := precomputed.Precompute(); err != nil {
+		b.Fatalf("Precompute failed: %v", err)
+	}
+	s := RandomScalar()
+
+	b.Run("ScalarExp", func(b *testing.B) {
+		for b.Loop() {
+			base.ScalarExp(s)
 		}
 	})
 
+	b.Run("ScalarExpPrecomputed", func(b *testing.B) {
+		for b.Loop() {
+			precomputed.ScalarExp(s)
+		}
+	})
+
+	b.Run("BaseExp", func(b *testing.B) {
+		for b.Loop() {
+			BaseExp(s)
+		}
+	})
+
+	b.Run("Precompute", func(b *testing.B) {
+		for b.Loop() {
+			(&Point{p: base.p}).Precompute()
+		}
+	})
+
+	msg, err := RandomMsg()
+	if err != nil {
+		b.Fatalf("RandomMsg failed: %v", err)
+	}
+	pk := (*PublicKey)(&Point{p: base.p})
+	pkPrecomputed := (*PublicKey)(precomputed)
+	ct := PKEEncrypt(pk, msg)
+
+	b.Run("PKEEncrypt", func(b *testing.B) {
+		for b.Loop() {
+			PKEEncrypt(pk, msg)
+		}
+	})
+
+	b.Run("PKEEncryptPrecomputed", func(b *testing.B) {
+		for b.Loop() {
+			PKEEncrypt(pkPrecomputed, msg)
+		}
+	})
+
+	b.Run("ReRand", func(b *testing.B) {
+		for b.Loop() {
+			ReRand(pk, ct)
+		}
+	})
+
+	b.Run("ReRandPrecomputed", func(b *testing.B) {
+		for b.Loop() {
+			ReRand(pkPrecomputed, ct)
+		}
+	})
 }
 
 var benchParams = []benchParam{
@@ -1,12 +1,21 @@
 package common
 
 import (
+	"context"
+	"crypto/ed25519"
+	"crypto/hkdf"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"log"
+	"maps"
 	"mppj"
 	"mppj/api"
 	"mppj/cmd/config"
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
 	"time"
 )
 
@@ -16,24 +25,56 @@ func GetRPK(sid []byte) mppj.PublicKeyTuple {
 	return rpk
 }
 
-func PrintStats(s api.NetStats, total, active time.Duration) {
+// GetTestSigningKey returns the signing key of the party's files in the test session, which is derived from
+// the session ID and the party's id like the receiver's test keys.
+func GetTestSigningKey(sid []byte, party string) ed25519.PrivateKey {
+	seed, err := hkdf.Key(sha256.New, sid, nil, "test signing key|"+party, ed25519.SeedSize)
+	if err != nil {
+		panic(err)
+	}
+	return ed25519.NewKeyFromSeed(seed)
+}
+
+// SignalContext returns a context which is cancelled on SIGINT or SIGTERM, and once timeout elapses if it is
+// positive, so that the parties can stop their workers and clean up before exiting. A second signal exits
+// immediately.
+func SignalContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop() // restores the default behavior, so that a second signal kills a party that does not stop
+	}()
+	if timeout <= 0 {
+		return ctx, stop
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	return ctx, func() { cancel(); stop() }
+}
+
+// PrintStats logs the network statistics, in total and per source and RPC method, and the durations.
+func PrintStats(s api.Stats, total, active time.Duration) {
 	var stats string
 	switch config.LogNetworkStats {
 	case config.None:
 		// do nothing
 	case config.StringFormat:
-		stats = fmt.Sprintf("%s, total time: %v, active time: %v", s, total, active)
+		stats = fmt.Sprintf("%s, total time: %v, active time: %v", s.NetStats, total, active)
+		for _, source := range slices.Sorted(maps.Keys(s.BySource)) {
+			stats += fmt.Sprintf(", %s: {%s}", source, s.BySource[source])
+		}
 	case config.JsonFormat:
 		json, err := json.Marshal(struct {
-			Sent   uint64        `json:"data_sent"`
-			Recv   uint64        `json:"data_recv"`
-			Total  time.Duration `json:"time_total"`
-			Active time.Duration `json:"time_active"`
+			api.NetStats
+			Total    time.Duration                  `json:"time_total"`
+			Active   time.Duration                  `json:"time_active"`
+			BySource map[mppj.SourceID]api.NetStats `json:"by_source,omitempty"`
+			ByMethod map[string]api.NetStats        `json:"by_method,omitempty"`
 		}{
-			Sent:   s.DataSent,
-			Recv:   s.DataRecv,
-			Total:  total,
-			Active: active,
+			NetStats: s.NetStats,
+			Total:    total,
+			Active:   active,
+			BySource: s.BySource,
+			ByMethod: s.ByMethod,
 		})
 		if err != nil {
 			log.Printf("Failed to marshal stats to json: %v", err)
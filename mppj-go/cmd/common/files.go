@@ -0,0 +1,114 @@
+package common
+
+import (
+	"crypto/ed25519"
+	"encoding/pem"
+	"fmt"
+	"mppj"
+	"os"
+)
+
+// The PEM block types of the files written by the mppj command.
+const (
+	PublicKeyBlock = "MPPJ RECEIVER PUBLIC KEY"
+	SecretKeyBlock = "MPPJ RECEIVER SECRET KEY"
+	// the keys of the signatures of the file transport
+	VerifyingKeyBlock = "MPPJ VERIFYING KEY"
+	SigningKeyBlock   = "MPPJ SIGNING KEY"
+)
+
+// WritePEM writes data in a PEM block of the given type to a new file at path, which is only readable by its
+// owner if private is set. It fails if the file already exists.
+func WritePEM(path, blockType string, data []byte, private bool) error {
+	perm := os.FileMode(0o644)
+	if private {
+		perm = 0o600
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if err := pem.Encode(f, &pem.Block{Type: blockType, Bytes: data}); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ReadPEM reads the data of the PEM block of the given type in the file at path.
+func ReadPEM(path, blockType string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != blockType {
+		return nil, fmt.Errorf("%s: not a %s file", path, blockType)
+	}
+	return block.Bytes, nil
+}
+
+// ReadPublicKey reads the receiver's public keys written by 'mppj keygen'.
+func ReadPublicKey(path string) (mppj.PublicKeyTuple, error) {
+	var rpk mppj.PublicKeyTuple
+	data, err := ReadPEM(path, PublicKeyBlock)
+	if err != nil {
+		return rpk, err
+	}
+	if err := rpk.UnmarshalBinary(data); err != nil {
+		return rpk, fmt.Errorf("%s: %w", path, err)
+	}
+	return rpk, nil
+}
+
+// ReadSecretKey reads the receiver's secret keys written by 'mppj keygen'.
+func ReadSecretKey(path string) (mppj.SecretKeyTuple, error) {
+	var rsk mppj.SecretKeyTuple
+	data, err := ReadPEM(path, SecretKeyBlock)
+	if err != nil {
+		return rsk, err
+	}
+	if err := rsk.UnmarshalBinary(data); err != nil {
+		return rsk, fmt.Errorf("%s: %w", path, err)
+	}
+	return rsk, nil
+}
+
+// ReadVerifyingKey reads the public key of a party's signatures written by 'mppj keygen -type signing'.
+func ReadVerifyingKey(path string) (ed25519.PublicKey, error) {
+	data, err := ReadPEM(path, VerifyingKeyBlock)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("%s: invalid verifying key", path)
+	}
+	return ed25519.PublicKey(data), nil
+}
+
+// ReadSigningKey reads the secret key of a party's signatures written by 'mppj keygen -type signing', which
+// is stored as its seed.
+func ReadSigningKey(path string) (ed25519.PrivateKey, error) {
+	data, err := ReadPEM(path, SigningKeyBlock)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != ed25519.SeedSize {
+		return nil, fmt.Errorf("%s: invalid signing key", path)
+	}
+	return ed25519.NewKeyFromSeed(data), nil
+}
+
+// ReadManifest reads the session manifest written by 'mppj session create'.
+func ReadManifest(path string) (*mppj.Manifest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	m, err := mppj.ReadManifest(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return m, nil
+}
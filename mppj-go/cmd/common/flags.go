@@ -0,0 +1,343 @@
+package common
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+	"flag"
+	"fmt"
+	"mppj"
+	"mppj/cmd/config"
+	"mppj/transport"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ErrUsage is returned by Flags.Parse for invalid arguments, once it has printed the error and the usage.
+var ErrUsage = errors.New("invalid usage")
+
+// Flags is the flag set of a subcommand. The flags shared by several subcommands are registered with its
+// methods, so that they have the same name, usage and validation everywhere. The values are validated by
+// Parse, in the order in which the flags are registered.
+type Flags struct {
+	*flag.FlagSet
+	checks []func() error
+
+	argsUsage string // the usage of the positional arguments, if they are allowed
+	minArgs   int
+}
+
+// NewFlags creates the flag set of the subcommand with the given name (e.g., "source push") and summary.
+func NewFlags(name, summary string) *Flags {
+	f := &Flags{FlagSet: flag.NewFlagSet(name, flag.ContinueOnError)}
+	f.Usage = func() {
+		usage := "mppj " + name + " [flags]"
+		if f.argsUsage != "" {
+			usage += " " + f.argsUsage
+		}
+		fmt.Fprintf(f.Output(), "Usage: %s\n\n%s\n\nFlags:\n", usage, summary)
+		f.PrintDefaults()
+	}
+	return f
+}
+
+// Positional allows at least min positional arguments after the flags, described by usage (e.g., "FILE...").
+func (f *Flags) Positional(usage string, min int) {
+	f.argsUsage, f.minArgs = usage, min
+}
+
+// Check adds a validation of the flag values, which is run by Parse.
+func (f *Flags) Check(check func() error) {
+	f.checks = append(f.checks, check)
+}
+
+// Parse parses the arguments, which must not contain positional arguments unless they are allowed, and
+// validates the flag values. It returns flag.ErrHelp if the help was requested.
+func (f *Flags) Parse(args []string) error {
+	if err := f.FlagSet.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return fmt.Errorf("%w: %w", ErrUsage, err) // already printed by the flag set
+	}
+	switch {
+	case f.argsUsage == "" && f.NArg() > 0:
+		return f.usageError(fmt.Errorf("unexpected arguments: %s", strings.Join(f.Args(), " ")))
+	case f.NArg() < f.minArgs:
+		return f.usageError(fmt.Errorf("expected at least %d arguments", f.minArgs))
+	}
+	for _, check := range f.checks {
+		if err := check(); err != nil {
+			return fmt.Errorf("invalid flags: %w", err)
+		}
+	}
+	return nil
+}
+
+// usageError prints err and the usage, and returns it as an ErrUsage.
+func (f *Flags) usageError(err error) error {
+	fmt.Fprintln(f.Output(), err)
+	f.Usage()
+	return fmt.Errorf("%w: %w", ErrUsage, err)
+}
+
+// Session registers the -session flag, whose session is available once the flags are parsed. It must be
+// registered first, as the values of the flags declared by the manifest are taken from it.
+func (f *Flags) Session() *Session {
+	path := f.String("session", "", "the session manifest created with 'mppj session create' (default is the fixed test session)")
+	s := new(Session)
+	f.Check(func() error {
+		if *path == "" {
+			s.ID = config.SessionID
+			return nil
+		}
+		m, err := ReadManifest(*path)
+		if err != nil {
+			return err
+		}
+		s.ID, s.Manifest = m.SessionID(), m
+		return nil
+	})
+	return s
+}
+
+// Declared returns whether the value of the flag is declared by the session's manifest, in which case the flag
+// must not be set: the parameters of the session cannot differ between the parties.
+func (f *Flags) Declared(s *Session, name string) (bool, error) {
+	if s == nil || s.Manifest == nil {
+		return false, nil
+	}
+	if f.isSet(name) {
+		return true, fmt.Errorf("-%s cannot be set, as it is declared by the session manifest", name)
+	}
+	return true, nil
+}
+
+// isSet returns whether the flag was set by the arguments.
+func (f *Flags) isSet(name string) bool {
+	set := false
+	f.Visit(func(fl *flag.Flag) { set = set || fl.Name == name })
+	return set
+}
+
+// ID registers the -id flag of the party. With a manifest, the id must be one of a party with the role, and
+// defaults to the manifest's helper or receiver. Otherwise, it is required if def is empty.
+func (f *Flags) ID(s *Session, role mppj.Role, def string) *string {
+	id := f.String("id", def, fmt.Sprintf("the id of the %s", role))
+	f.Check(func() error {
+		if s.Manifest != nil {
+			switch {
+			case f.isSet("id"):
+			case role == mppj.RoleHelper:
+				*id = s.Manifest.Helper().ID
+			case role == mppj.RoleReceiver:
+				*id = s.Manifest.Receiver().ID
+			}
+			if !slices.ContainsFunc(s.Manifest.Parties, func(p mppj.Party) bool { return p.ID == *id && p.Role == role }) {
+				return fmt.Errorf("%q is not a %s of the session", *id, role)
+			}
+		}
+		if *id == "" {
+			return fmt.Errorf("the id of the %s is required", role)
+		}
+		return nil
+	})
+	return id
+}
+
+// Sources registers the -sources flag, which must have at least two distinct, non-empty ids. It is declared by
+// the manifest of s, if any.
+func (f *Flags) Sources(s *Session) *mppj.SourceList {
+	sources := new(mppj.SourceList)
+	f.Var(sources, "sources", "the sources' ids as a comma-separated list")
+	f.Check(func() error {
+		if declared, err := f.Declared(s, "sources"); declared {
+			*sources = s.Manifest.Sources()
+			return err
+		}
+		return CheckSources(*sources)
+	})
+	return sources
+}
+
+// CheckSources checks that there are at least two sources, and that their ids are distinct and non-empty.
+func CheckSources(sources []mppj.SourceID) error {
+	if len(sources) < 2 {
+		return errors.New("at least two sources ids must be provided")
+	}
+	for i, id := range sources {
+		if id == "" {
+			return errors.New("the sources ids must not be empty")
+		}
+		if slices.Contains(sources[:i], id) {
+			return fmt.Errorf("duplicate source id: %s", id)
+		}
+	}
+	return nil
+}
+
+// HelperAddress registers the -helper_address flag. With a manifest, it defaults to the helper's address, which
+// the flag can override (e.g., when the helper is reached through a proxy).
+func (f *Flags) HelperAddress(s *Session) *string {
+	addr := f.String("helper_address", fmt.Sprintf(":%d", config.DEFAULT_PORT), "the address of the helper node")
+	f.Check(func() error {
+		if s != nil && s.Manifest != nil && !f.isSet("helper_address") {
+			*addr = s.Manifest.Helper().Address
+		}
+		return nil
+	})
+	return addr
+}
+
+// Normalization registers the -normalize flag, with the given usage. It is declared by the manifest of s, if
+// any.
+func (f *Flags) Normalization(s *Session, usage string) *mppj.Normalization {
+	norm := new(mppj.Normalization)
+	f.Func("normalize", usage, func(spec string) (err error) {
+		*norm, err = mppj.ParseNormalization(spec)
+		return err
+	})
+	f.Check(func() (err error) {
+		if declared, err := f.Declared(s, "normalize"); declared {
+			if err != nil {
+				return err
+			}
+			*norm, err = s.Manifest.Normalization()
+			return err
+		}
+		return nil
+	})
+	return norm
+}
+
+// NumRows registers the -n_rows flag, which must be positive. It is declared by the manifest of s, if any.
+func (f *Flags) NumRows(s *Session) *int {
+	nRows := f.Int("n_rows", 0, "the number of rows per source")
+	f.Check(func() error {
+		if declared, err := f.Declared(s, "n_rows"); declared {
+			*nRows = s.Manifest.Limits.RowsPerSource
+			return err
+		}
+		if *nRows <= 0 {
+			return errors.New("the number of rows per source must be positive")
+		}
+		return nil
+	})
+	return nRows
+}
+
+// BatchSize registers the -batch_size flag, which must be between 1 and transport.MaxBatchSize.
+func (f *Flags) BatchSize(usage string) *int {
+	batchSize := f.Int("batch_size", 1, fmt.Sprintf("%s (at most %d)", usage, transport.MaxBatchSize))
+	f.Check(func() error {
+		if *batchSize <= 0 || *batchSize > transport.MaxBatchSize {
+			return fmt.Errorf("the batch size must be between 1 and %d", transport.MaxBatchSize)
+		}
+		return nil
+	})
+	return batchSize
+}
+
+// ReceiverPK registers the -receiver_pk flag, whose public keys are available once the flags are parsed. They
+// are declared by the manifest of s, if any, and default to the test keys of the session otherwise.
+func (f *Flags) ReceiverPK(s *Session) *mppj.PublicKeyTuple {
+	path := f.String("receiver_pk", "", "the receiver's public key file created with 'mppj keygen' (default is the test key of the session)")
+	rpk := new(mppj.PublicKeyTuple)
+	f.Check(func() (err error) {
+		if declared, err := f.Declared(s, "receiver_pk"); declared {
+			if err != nil {
+				return err
+			}
+			*rpk, err = s.Manifest.ReceiverPK()
+			return err
+		}
+		if *path == "" {
+			*rpk = GetRPK(s.ID)
+			return nil
+		}
+		*rpk, err = ReadPublicKey(*path)
+		return err
+	})
+	return rpk
+}
+
+// ReceiverKeys registers the -receiver_sk flag, whose keys are available once the flags are parsed. The flag is
+// required with a manifest, whose public keys must match, and defaults to the test keys of the session
+// otherwise.
+func (f *Flags) ReceiverKeys(s *Session) (*mppj.SecretKeyTuple, *mppj.PublicKeyTuple) {
+	path := f.String("receiver_sk", "", "the receiver's secret key file created with 'mppj keygen' (default is the test key of the session)")
+	rsk, rpk := new(mppj.SecretKeyTuple), new(mppj.PublicKeyTuple)
+	f.Check(func() (err error) {
+		if *path == "" {
+			if s.Manifest != nil {
+				return errors.New("the receiver's secret key is required with a session manifest")
+			}
+			*rsk, *rpk = mppj.GetTestKeys(s.ID)
+			return nil
+		}
+		if *rsk, err = ReadSecretKey(*path); err != nil {
+			return err
+		}
+		*rpk = rsk.PublicKey()
+		if s.Manifest != nil {
+			pk, err := rpk.MarshalBinary()
+			if err != nil {
+				return err
+			}
+			if !bytes.Equal(pk, s.Manifest.Receiver().PublicKey) {
+				return errors.New("the receiver's secret key does not match the public key of the session manifest")
+			}
+		}
+		return nil
+	})
+	return rsk, rpk
+}
+
+// SigningKey registers the -signing_key flag of the party with the given id, whose key signs its files of the
+// file transport. The key must match the one declared by the manifest of s, if any, and defaults to the test
+// key of the session otherwise. It is nil if there is a manifest and the flag is not set.
+func (f *Flags) SigningKey(s *Session, id *string) *ed25519.PrivateKey {
+	path := f.String("signing_key", "", "the key file created with 'mppj keygen -type signing' which signs the files of the file transport (default is the test key of the session)")
+	key := new(ed25519.PrivateKey)
+	f.Check(func() (err error) {
+		if *path == "" {
+			if s.Manifest == nil {
+				*key = GetTestSigningKey(s.ID, *id)
+			}
+			return nil
+		}
+		if *key, err = ReadSigningKey(*path); err != nil {
+			return err
+		}
+		pk, err := s.VerifyingKey(*id)
+		if err != nil {
+			return err
+		}
+		if !pk.Equal(key.Public()) {
+			return fmt.Errorf("the signing key does not match the verifying key of %s", *id)
+		}
+		return nil
+	})
+	return key
+}
+
+// Timeout registers the -timeout flag.
+func (f *Flags) Timeout(usage string) *time.Duration {
+	return f.Duration("timeout", 0, usage)
+}
+
+// MetricsAddress registers the -metrics_address flag.
+func (f *Flags) MetricsAddress() *string {
+	return f.String("metrics_address", "", "if set, serves the Prometheus metrics at http://<metrics_address>/metrics")
+}
+
+// Trace registers the -trace flag.
+func (f *Flags) Trace() *string {
+	return f.String("trace", "", "if set, writes the trace of the protocol's phases to this file, as OpenTelemetry spans in JSON")
+}
+
+// DebugSeed registers the -debug_seed flag of the party.
+func (f *Flags) DebugSeed(role string) *string {
+	return f.String("debug_seed", "", fmt.Sprintf("if set, derives the randomness from this seed and the %s's id, which makes the run reproducible but insecure (for debugging only)", role))
+}
@@ -0,0 +1,88 @@
+package common
+
+import (
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics is the Prometheus registry of a party, with the metrics common to all parties. The parties add
+// their own metrics with promauto.With(m.Registry).
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	mu     sync.Mutex
+	phases map[string]*phase
+}
+
+type phase struct {
+	start, end time.Time
+}
+
+var phaseDesc = prometheus.NewDesc("mppj_phase_duration_seconds",
+	"The duration of the phases of the protocol, so far for the running phases.", []string{"phase"}, nil)
+
+// NewMetrics creates the registry of a party, with the network statistics of statsHandler (see
+// api.NewStatsHandler), the durations of the phases and the Go runtime metrics.
+func NewMetrics(statsHandler prometheus.Collector) *Metrics {
+	m := &Metrics{Registry: prometheus.NewRegistry(), phases: make(map[string]*phase)}
+	m.Registry.MustRegister(statsHandler, m, collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	return m
+}
+
+// StartPhase starts measuring the duration of a phase, and returns the function that ends it.
+func (m *Metrics) StartPhase(name string) (end func()) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p := &phase{start: time.Now()}
+	m.phases[name] = p
+	return func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if p.end.IsZero() {
+			p.end = time.Now()
+		}
+	}
+}
+
+// Describe implements prometheus.Collector for the durations of the phases.
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	ch <- phaseDesc
+}
+
+// Collect implements prometheus.Collector for the durations of the phases.
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for name, p := range m.phases {
+		end := p.end
+		if end.IsZero() {
+			end = time.Now()
+		}
+		ch <- prometheus.MustNewConstMetric(phaseDesc, prometheus.GaugeValue, end.Sub(p.start).Seconds(), name)
+	}
+}
+
+// ServeMetrics serves the metrics at http://addr/metrics in the background.
+func ServeMetrics(addr string, m *Metrics) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{Registry: m.Registry}))
+	go func() {
+		if err := http.Serve(lis, mux); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("error serving metrics: %v", err)
+		}
+	}()
+	log.Printf("serving metrics at http://%s/metrics", lis.Addr())
+	return nil
+}
@@ -0,0 +1,60 @@
+package common
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"fmt"
+	"mppj"
+	"mppj/api"
+	"mppj/cmd/config"
+	"slices"
+)
+
+// Session is the session of a party, which is declared by a manifest (see 'mppj session create') or is the
+// fixed test session.
+type Session struct {
+	ID       []byte
+	Manifest *mppj.Manifest // nil for the test session
+}
+
+// MaxValueLength returns the maximum length of the values of the session.
+func (s *Session) MaxValueLength() int {
+	if s.Manifest == nil {
+		return config.MaxValLen
+	}
+	return s.Manifest.Values.MaxLength
+}
+
+// VerifyingKey returns the public key of the signatures of the party's files, which is declared by the manifest
+// or is the test key of the session.
+func (s *Session) VerifyingKey(party string) (ed25519.PublicKey, error) {
+	if s.Manifest == nil {
+		return GetTestSigningKey(s.ID, party).Public().(ed25519.PublicKey), nil
+	}
+	for _, p := range s.Manifest.Parties {
+		if p.ID == party {
+			if p.SigningKey == nil {
+				return nil, fmt.Errorf("%s has no signing key in the session manifest", party)
+			}
+			return ed25519.PublicKey(p.SigningKey), nil
+		}
+	}
+	return nil, fmt.Errorf("%s is not a party of the session", party)
+}
+
+// FileKey returns the function which checks the header of a file of the file transport, which must be of the
+// kind, of the session and written by one of the parties if any are given, and returns the key of its
+// signature.
+func (s *Session) FileKey(kind api.FileKind, parties ...string) func(api.FileHeader) (ed25519.PublicKey, error) {
+	return func(h api.FileHeader) (ed25519.PublicKey, error) {
+		switch {
+		case h.Kind != kind:
+			return nil, fmt.Errorf("expected a %s, got a %s", kind, h.Kind)
+		case !bytes.Equal(h.SessionID, s.ID):
+			return nil, fmt.Errorf("the file is of session %x, expected %x", h.SessionID, s.ID)
+		case len(parties) > 0 && !slices.Contains(parties, h.Party):
+			return nil, fmt.Errorf("unexpected file of %s", h.Party)
+		}
+		return s.VerifyingKey(h.Party)
+	}
+}
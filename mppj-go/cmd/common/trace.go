@@ -0,0 +1,42 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Tracer is the tracer of the parties' spans outside of the protocol's phases (e.g., the upload of the rows).
+var Tracer = otel.Tracer("mppj/cmd")
+
+// StartTracing records the spans of the party and exports them to the file at path, as OpenTelemetry spans
+// in JSON with one span per line, under the given service name. It also makes the parties propagate their
+// trace context to each other (see api.InjectTraceContext), so that the traces of a run can be linked. The
+// returned function flushes the spans and closes the file.
+func StartTracing(path, service string) (shutdown func() error, err error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	exporter, err := stdouttrace.New(stdouttrace.WithWriter(f))
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", service))),
+	)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return func() error {
+		return errors.Join(tp.Shutdown(context.Background()), f.Close())
+	}, nil
+}
@@ -0,0 +1,78 @@
+package helper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"mppj"
+	"mppj/api"
+	"mppj/cmd/common"
+	"mppj/transport"
+	"time"
+)
+
+// Convert runs 'mppj helper convert', which converts the rows of the sources' files in a directory and writes
+// them to a file for the receiver, for the file transport.
+func Convert(args []string) error {
+	f := common.NewFlags("helper convert", "Converts the rows of the sources' files in a directory, and writes them to a file for the receiver.")
+	session := f.Session()
+	nodeID := f.ID(session, mppj.RoleHelper, "")
+	sources := f.Sources(session)
+	nRows := f.NumRows(session)
+	rpk := f.ReceiverPK(session)
+	norm := f.Normalization(session, "the join key normalizers used by the sources, as a comma-separated list")
+	inDir := f.String("input_dir", "", "the directory of the sources' files, written with 'mppj source push -output'")
+	outFile := f.String("output", "", "the file to create for the receiver")
+	signingKey := f.SigningKey(session, nodeID)
+	timeout := f.Timeout("if positive, aborts the conversion after this duration")
+	debugSeed := f.DebugSeed("helper")
+	f.Check(func() error {
+		switch {
+		case *inDir == "" || *outFile == "":
+			return errors.New("the input directory and the output file are required")
+		case *signingKey == nil:
+			return errors.New("the signing key is required with a session manifest")
+		}
+		return nil
+	})
+	if err := f.Parse(args); err != nil {
+		return err
+	}
+
+	log.Printf("MPPJ Helper %s", *nodeID)
+
+	ctx, cancel := common.SignalContext(*timeout)
+	defer cancel()
+	noStore := ""
+	cfg := &serveConfig{nodeID: nodeID, sources: sources, nRows: nRows, session: session, rpk: rpk, norm: norm, storePath: &noStore, debugSeed: debugSeed}
+	helper, err := newHelperServer(ctx, cfg, common.NewMetrics(api.NewStatsHandler(*sources...)))
+	if err != nil {
+		return err
+	}
+
+	parties := make([]string, len(*sources))
+	for i, id := range *sources {
+		parties[i] = string(id)
+	}
+	tr := &transport.Files{
+		SessionID:    session.ID,
+		Party:        *nodeID,
+		SigningKey:   *signingKey,
+		VerifyingKey: session.FileKey(api.SourceFile, parties...),
+		SourceDir:    *inDir,
+		Sources:      *sources,
+		HelperPath:   *outFile,
+	}
+
+	start := time.Now()
+	log.Printf("converting the rows of %d sources from %s", len(*sources), *inDir)
+	if err := tr.Serve(helper.ctx, helper); err != nil {
+		if cause := context.Cause(helper.ctx); cause != nil {
+			err = cause
+		}
+		return fmt.Errorf("failed to convert tables: %w", err)
+	}
+	log.Printf("wrote the rows converted in %s to %s", time.Since(start), *outFile)
+	return nil
+}
@@ -0,0 +1,87 @@
+package helper
+
+import (
+	"mppj"
+	"mppj/cmd/common"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// helperMetrics are the helper's metrics, in addition to the ones common to all parties.
+type helperMetrics struct {
+	*common.Metrics
+
+	rowsReceived   *prometheus.CounterVec
+	rowsConverted  atomic.Int64
+	convStart      atomic.Int64 // the start of the conversion in Unix nanoseconds, or 0 if not started
+	convEnd        atomic.Int64 // the end of the conversion in Unix nanoseconds, or 0 if not ended
+	endConvert     func()       // ends the convert phase, set by startConversion
+	activeSessions prometheus.Gauge
+}
+
+func newHelperMetrics(m *common.Metrics, queue chan mppj.ConvertRowTask) *helperMetrics {
+	hm := &helperMetrics{Metrics: m}
+	factory := promauto.With(m.Registry)
+	hm.rowsReceived = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "mppj_helper_rows_received_total",
+		Help: "The number of rows received, per source.",
+	}, []string{"source"})
+	factory.NewCounterFunc(prometheus.CounterOpts{
+		Name: "mppj_helper_rows_converted_total",
+		Help: "The number of rows converted.",
+	}, func() float64 { return float64(hm.rowsConverted.Load()) })
+	factory.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "mppj_helper_conversion_rate_rows_per_second",
+		Help: "The average number of rows converted per second since the start of the conversion.",
+	}, hm.conversionRate)
+	factory.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "mppj_helper_queue_depth",
+		Help: "The number of received rows waiting for the conversion.",
+	}, func() float64 { return float64(len(queue)) })
+	hm.activeSessions = factory.NewGauge(prometheus.GaugeOpts{
+		Name: "mppj_helper_active_sessions",
+		Help: "The number of sessions between the first source's connection and the end of the sending to the receiver.",
+	})
+	return hm
+}
+
+// startConversion records the start of the conversion, which is when the first source connects. It must be
+// called once, before endConversion.
+func (hm *helperMetrics) startConversion() {
+	hm.endConvert = hm.StartPhase("convert")
+	hm.convStart.Store(time.Now().UnixNano())
+}
+
+// endConversion records the end of the conversion.
+func (hm *helperMetrics) endConversion() {
+	hm.convEnd.Store(time.Now().UnixNano())
+	hm.endConvert()
+}
+
+func (hm *helperMetrics) conversionRate() float64 {
+	start, end := hm.convStart.Load(), hm.convEnd.Load()
+	if start == 0 {
+		return 0
+	}
+	if end == 0 {
+		end = time.Now().UnixNano()
+	}
+	return float64(hm.rowsConverted.Load()) / time.Duration(end-start).Seconds()
+}
+
+// countingStore counts the rows put in a store.
+type countingStore struct {
+	mppj.RowStore
+	n *atomic.Int64
+}
+
+func (s countingStore) Put(pos int, row mppj.EncRowWithHint) error {
+	if err := s.RowStore.Put(pos, row); err != nil {
+		return err
+	}
+	s.n.Add(1)
+	return nil
+}
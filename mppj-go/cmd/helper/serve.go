@@ -0,0 +1,425 @@
+// Package helper implements the 'mppj helper serve' subcommand, which runs the helper's server for a session.
+package helper
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mppj"
+	"mppj/api"
+	"mppj/api/pb"
+	"mppj/cmd/common"
+	"mppj/cmd/config"
+	"mppj/transport"
+	"net"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+)
+
+// serveConfig holds the flag values of 'mppj helper serve'.
+type serveConfig struct {
+	nodeID      *string
+	sources     *mppj.SourceList
+	bindAddr    *string
+	nRows       *int
+	session     *common.Session
+	rpk         *mppj.PublicKeyTuple
+	norm        *mppj.Normalization
+	storePath   *string
+	timeout     *time.Duration
+	debugSeed   *string
+	metricsAddr *string
+	traceFile   *string
+}
+
+// incomingQueueSize is the number of received rows that can wait for the conversion.
+var incomingQueueSize = 16 * runtime.NumCPU()
+
+// sendBatchSize is the number of converted rows passed at once to the transport, which batches the rows of
+// its messages on its own.
+const sendBatchSize = 64
+
+// mppjHelperServer is the helper's handler of the messages of the sources and the receiver.
+type mppjHelperServer struct {
+	ctx   context.Context         // the session's context, which is done when the session is aborted
+	abort context.CancelCauseFunc // aborts the session
+
+	sid   []byte // the session ID, as bound into the messages
+	rpk   []byte // the receiver's marshalled public key
+	nRows int    // the number of rows per source
+
+	incomingEncRows chan mppj.ConvertRowTask
+
+	convTables chan mppj.RowStore
+	resumed    bool // whether the converted rows were loaded from a complete store
+
+	expected map[mppj.SourceID]mppj.TableIndex
+	mu       sync.Mutex
+	once     sync.Once
+
+	start, stop chan struct{} // signals for start and stop of processing
+
+	metrics    *helperMetrics
+	endReceive func() // ends the receive phase
+}
+
+var _ transport.Handler = (*mppjHelperServer)(nil)
+
+func newHelperServer(ctx context.Context, cfg *serveConfig, m *common.Metrics) (*mppjHelperServer, error) {
+
+	rnd := mppj.SecureRand()
+	if *cfg.debugSeed != "" {
+		log.Println("warning: the randomness is derived from the debug seed, the run is insecure")
+		rnd = mppj.NewSeededRand([]byte(*cfg.debugSeed + "/" + *cfg.nodeID))
+	}
+	sources := *cfg.sources
+	h := mppj.NewHelperWithRand(cfg.norm.BindSessionID(cfg.session.ID), sources, *cfg.nRows, rnd)
+
+	rpk := *cfg.rpk
+	rpkBytes, err := rpk.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, abort := context.WithCancelCause(ctx)
+	srv := &mppjHelperServer{
+		ctx:             ctx,
+		abort:           abort,
+		sid:             cfg.session.ID,
+		rpk:             rpkBytes,
+		nRows:           *cfg.nRows,
+		incomingEncRows: make(chan mppj.ConvertRowTask, incomingQueueSize),
+		convTables:      make(chan mppj.RowStore, 1),
+		expected:        make(map[mppj.SourceID]mppj.TableIndex, len(sources)),
+		start:           make(chan struct{}),
+		stop:            make(chan struct{}),
+	}
+	srv.metrics = newHelperMetrics(m, srv.incomingEncRows)
+
+	for i, id := range sources {
+		srv.expected[id] = mppj.TableIndex(i)
+	}
+
+	var store mppj.RowStore
+	if *cfg.storePath == "" {
+		store = make(mppj.EncTableWithHint, h.NumRows())
+	} else {
+		fileStore, err := openStore(*cfg.storePath, cfg.norm.BindSessionID(cfg.session.ID), sources, h.NumRows(), cfg.session.MaxValueLength())
+		if err != nil {
+			return nil, fmt.Errorf("failed to open the store: %w", err)
+		}
+		if fileStore.Complete() {
+			log.Printf("serving the %d converted rows from the complete store %s", fileStore.Len(), *cfg.storePath)
+			srv.resumed = true
+			close(srv.start)
+			srv.convTables <- fileStore
+			return srv, nil
+		}
+		store = fileStore
+	}
+
+	go func() {
+		log.Printf("waiting for %d sources: %v", len(srv.expected), sources)
+		counted := countingStore{RowStore: store, n: &srv.metrics.rowsConverted}
+		if err := h.ConvertTablesStreamTo(ctx, rpk, srv.incomingEncRows, counted); err != nil {
+			abort(fmt.Errorf("failed to convert tables: %w", err))
+			return
+		}
+		if fileStore, ok := store.(*mppj.FileRowStore); ok {
+			if err := fileStore.Commit(); err != nil {
+				abort(fmt.Errorf("failed to commit the store: %w", err))
+				return
+			}
+		}
+		srv.metrics.endConversion()
+		srv.convTables <- store
+		log.Println("conversion done")
+	}()
+
+	return srv, nil
+}
+
+// openStore opens the file store at path if it is complete, and otherwise (re-)creates it. The rows of an
+// incomplete store are discarded, as the helper's keys do not persist across restarts. A store of another
+// session (as bound by the helper), or with another number of rows, is rejected.
+func openStore(path string, sid []byte, sources []mppj.SourceID, nRows, maxValLen int) (*mppj.FileRowStore, error) {
+	store, err := mppj.OpenFileRowStore(path)
+	if err == nil {
+		if err := store.CheckSession(sid, sources, nRows); err != nil {
+			store.Close()
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	switch {
+	case err == nil && store.Complete():
+		return store, nil
+	case err == nil:
+		log.Printf("discarding the incomplete store %s", path)
+		store.Close()
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return nil, err
+	}
+	maxValCts := maxValLen/mppj.PAYLOADSIZE + 1 // accounts for the padding
+	return mppj.CreateFileRowStore(path, sid, sources, nRows, maxValCts)
+}
+
+// HandleSetup implements transport.Handler. The setup must be that of the helper's session.
+func (s *mppjHelperServer) HandleSetup(_ context.Context, setup api.Setup) error {
+	rpk, err := setup.ReceiverPK.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(setup.SessionID, s.sid) || !bytes.Equal(rpk, s.rpk) {
+		return errors.New("the setup does not match the session")
+	}
+	return nil
+}
+
+// HandlePush implements transport.Handler. As the rows already received cannot be taken back, any failure
+// aborts the session.
+func (s *mppjHelperServer) HandlePush(ctx context.Context, sourceID mppj.SourceID, rows transport.RowReceiver[*pb.EncRow]) (err error) {
+
+	if s.resumed {
+		return fmt.Errorf("%w: conversion already complete", transport.ErrUnexpectedSource)
+	}
+
+	s.mu.Lock()
+	tindex, ok := s.expected[sourceID] // TODO: this doesn't check for multiple connections from the same source
+	if !ok {
+		s.mu.Unlock()
+		return fmt.Errorf("%w: %s", transport.ErrUnexpectedSource, sourceID)
+	}
+	s.once.Do(func() {
+		close(s.start)
+		s.metrics.activeSessions.Set(1)
+		s.endReceive = s.metrics.StartPhase("receive")
+		s.metrics.startConversion()
+	})
+	s.mu.Unlock()
+
+	log.Printf("starting to receive rows for source %s", sourceID)
+	_, span := common.Tracer.Start(api.ExtractTraceContext(ctx), "helper.receive", trace.WithAttributes(attribute.String("mppj.source", string(sourceID))))
+	defer func() {
+		mppj.EndSpan(span, err)
+		if err != nil {
+			s.abort(fmt.Errorf("failed to receive the rows of source %s: %w", sourceID, err))
+		}
+	}()
+
+	if n := rows.NumRows(); n != s.nRows {
+		errCount := mppj.ErrTooManyRows
+		if n < s.nRows {
+			errCount = mppj.ErrTooFewRows
+		}
+		return fmt.Errorf("%w: source %s announced %d rows, expected %d", errCount, sourceID, n, s.nRows)
+	}
+
+	var rc int
+	received := s.metrics.rowsReceived.WithLabelValues(string(sourceID))
+	for {
+		encRowMsgs, err := rows.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		for _, encRowMsg := range encRowMsgs {
+			encRow, err := api.GetEncRowFromMsg(encRowMsg)
+			if err != nil {
+				return err
+			}
+			select {
+			case s.incomingEncRows <- mppj.ConvertRowTask{EncRowMsg: encRow, TableIndex: tindex}:
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-s.ctx.Done():
+				return fmt.Errorf("%w: %v", transport.ErrAborted, context.Cause(s.ctx))
+			}
+		}
+		rc += len(encRowMsgs)
+		received.Add(float64(len(encRowMsgs)))
+	}
+	log.Printf("%d rows received for source %s", rc, sourceID)
+
+	// Close the incoming channel if all tables have been received
+	s.mu.Lock()
+	delete(s.expected, sourceID)
+	if len(s.expected) == 0 {
+		close(s.incomingEncRows)
+		s.endReceive()
+	}
+	s.mu.Unlock()
+
+	return nil
+}
+
+// HandlePull implements transport.Handler. It sends the converted rows to the receiver once they are all
+// converted.
+func (s *mppjHelperServer) HandlePull(ctx context.Context, open func(numRows int) (transport.RowSender[*pb.EncRowWithHint], error)) (err error) {
+	var convTables mppj.RowStore
+	select {
+	case convTables = <-s.convTables:
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-s.ctx.Done():
+		return fmt.Errorf("%w: %v", transport.ErrAborted, context.Cause(s.ctx))
+	}
+
+	log.Printf("sending %d rows to receiver", convTables.Len())
+	endSend := s.metrics.StartPhase("send")
+	_, span := common.Tracer.Start(api.ExtractTraceContext(ctx), "helper.send", trace.WithAttributes(attribute.Int("mppj.rows", convTables.Len())))
+	defer func() { mppj.EndSpan(span, err) }()
+	rows, err := open(convTables.Len())
+	if err != nil {
+		return err
+	}
+
+	var i int
+	batch := make([]*pb.EncRowWithHint, 0, sendBatchSize)
+	for row, err := range convTables.Rows() {
+		if err != nil {
+			return err
+		}
+		i++
+		msg, err := api.GetEncRowWithHintMsg(row)
+		if err != nil {
+			return err
+		}
+		batch = append(batch, msg)
+		if len(batch) < sendBatchSize {
+			continue
+		}
+		if err := rows.Send(batch); err != nil {
+			log.Printf("error sending row: %v", err)
+			return err
+		}
+		batch = batch[:0]
+	}
+	if len(batch) > 0 {
+		if err := rows.Send(batch); err != nil {
+			log.Printf("error sending row: %v", err)
+			return err
+		}
+	}
+	if err := rows.Close(); err != nil { // waits for the receiver to close
+		return err
+	}
+
+	log.Printf("done sending %d rows to receiver", i)
+	endSend()
+	s.metrics.activeSessions.Set(0)
+	close(s.stop)
+
+	return nil
+}
+
+// Serve runs 'mppj helper serve', which receives the rows of the sources, converts them and sends them to the
+// receiver.
+func Serve(args []string) error {
+	f := common.NewFlags("helper serve", "Receives the rows of the sources, converts them and sends them to the receiver.")
+	cfg := &serveConfig{session: f.Session()}
+	cfg.nodeID = f.ID(cfg.session, mppj.RoleHelper, "")
+	cfg.sources = f.Sources(cfg.session)
+	cfg.bindAddr = f.String("bind_address", fmt.Sprintf(":%d", config.DEFAULT_PORT), "the address to bind")
+	cfg.nRows = f.NumRows(cfg.session)
+	cfg.rpk = f.ReceiverPK(cfg.session)
+	cfg.norm = f.Normalization(cfg.session, "the join key normalizers used by the sources, as a comma-separated list")
+	cfg.storePath = f.String("store", "", "if set, stores the converted rows in this file instead of in memory, and serves them from it after a restart")
+	cfg.timeout = f.Timeout("if positive, aborts the session after this duration")
+	cfg.debugSeed = f.DebugSeed("helper")
+	cfg.metricsAddr = f.MetricsAddress()
+	cfg.traceFile = f.Trace()
+	if err := f.Parse(args); err != nil {
+		return err
+	}
+
+	log.Printf("MPPJ Helper %s", *cfg.nodeID)
+
+	lis, err := net.Listen("tcp", *cfg.bindAddr)
+	if err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+	statsHandler := api.NewStatsHandler(*cfg.sources...)
+	tr := transport.NewGRPCHelper(lis, grpc.StatsHandler(statsHandler))
+	ctx, cancel := common.SignalContext(*cfg.timeout)
+	defer cancel()
+	shutdownTracing := func() error { return nil }
+	if *cfg.traceFile != "" {
+		if shutdownTracing, err = common.StartTracing(*cfg.traceFile, "mppj-helper"); err != nil {
+			return fmt.Errorf("failed to start tracing: %w", err)
+		}
+	}
+	ctx, span := common.Tracer.Start(ctx, "helper.run")
+	endRun := func(err error) {
+		mppj.EndSpan(span, err)
+		if err := shutdownTracing(); err != nil {
+			log.Printf("failed to write the trace: %v", err)
+		}
+	}
+	metrics := common.NewMetrics(statsHandler)
+	if *cfg.metricsAddr != "" {
+		if err := common.ServeMetrics(*cfg.metricsAddr, metrics); err != nil {
+			return fmt.Errorf("failed to serve the metrics: %w", err)
+		}
+	}
+	helper, err := newHelperServer(ctx, cfg, metrics)
+	if err != nil {
+		endRun(err)
+		return err
+	}
+
+	serveCtx, stopServe := context.WithCancel(context.Background())
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+		if err := tr.Serve(serveCtx, helper); err != nil {
+			helper.abort(fmt.Errorf("error during serve: %w", err))
+		}
+	}()
+	stop := func() { // cancels the remaining streams
+		stopServe()
+		<-served
+	}
+
+	log.Printf("helper listening at %v", lis.Addr())
+	start := time.Now()
+	abort := func() error {
+		stop()
+		err := context.Cause(helper.ctx)
+		endRun(err)
+		return fmt.Errorf("session aborted: %w", err)
+	}
+	select {
+	case <-helper.start:
+	case <-helper.ctx.Done():
+		return abort()
+	}
+	startActive := time.Now() // measured time from first source connection
+	select {
+	case <-helper.stop:
+	case <-helper.ctx.Done():
+		return abort()
+	}
+	log.Println("done processing")
+	endRun(nil)
+	total := time.Since(start)
+	active := time.Since(startActive)
+	common.PrintStats(statsHandler.GetStats(), total, active)
+	<-time.After(time.Second) // leaves some time for streams to close
+	log.Println("shutting down")
+	stop()
+	return nil
+}
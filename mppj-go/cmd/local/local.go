@@ -0,0 +1,112 @@
+// Package local implements the 'mppj local' subcommand, which runs all the parties of a session in a single
+// process on generated tables, and checks the result against the plaintext join.
+package local
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mppj"
+	"mppj/cmd/common"
+	"mppj/session"
+	"mppj/transport"
+)
+
+// Run runs 'mppj local'.
+func Run(args []string) error {
+	f := common.NewFlags("local", "Runs all the parties in a single process on generated tables, and checks the result against the plaintext join.")
+	nRows := f.Int("n_rows", 100, "the number of rows per source")
+	joinSize := f.Int("join_size", 10, "the number of rows in the join")
+	f.Check(func() error {
+		if *nRows <= 0 || *joinSize < 0 || *joinSize > *nRows {
+			return errors.New("the join size must be between 0 and the positive number of rows")
+		}
+		return nil
+	})
+	if err := f.Parse(args); err != nil {
+		return err
+	}
+	return MPPJ(*nRows, *joinSize)
+}
+
+// MPPJ runs the protocol for three sources with numRows rows, of which joinSize are in the join. The parties
+// run concurrently, and exchange their messages over the in-process transport.
+func MPPJ(numRows, joinSize int) error {
+
+	fmt.Println("----- MPPJ -----")
+	fmt.Println("")
+
+	sourceIDs := []mppj.SourceID{"ds1", "ds2", "ds3"}
+	p := session.Params{
+		ID:      mppj.NewSessionID(3, "helper", "receiver", sourceIDs),
+		Sources: sourceIDs,
+		NumRows: numRows,
+	}
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	tr := transport.NewLocal()
+
+	// Helper: converts the rows pushed by the sources, and sends them to the receiver
+	helper, err := session.NewHelper(p, tr)
+	if err != nil {
+		return err
+	}
+	helped := make(chan error, 1)
+	go func() { helped <- helper.Run(ctx) }()
+
+	// Receiver: sends its setup, which the helper relays to the sources
+	receiver, err := session.NewReceiver(p, tr)
+	if err != nil {
+		return err
+	}
+	if err := receiver.Setup(ctx); err != nil {
+		return err
+	}
+
+	// Data sources: prepare their tables for the receiver of the setup, and push them
+	tables := mppj.GenTestTables(sourceIDs, numRows, joinSize)
+	pushed := make(chan error, len(tables))
+	for sourceID, table := range tables {
+		source, err := session.NewSource(p, sourceID, tr)
+		if err != nil {
+			return err
+		}
+		go func() {
+			err := source.Push(ctx, table)
+			if err != nil {
+				cancel(fmt.Errorf("source %s: %w", sourceID, err))
+			}
+			pushed <- err
+		}()
+	}
+
+	// Receiver: pulls the converted rows and joins them
+	intersectionMPPJ := mppj.NewJoinTable(sourceIDs)
+	if _, _, err := receiver.Join(ctx, &intersectionMPPJ); err != nil {
+		return err
+	}
+	for range tables {
+		if err := <-pushed; err != nil {
+			return err
+		}
+	}
+	if err := <-helped; err != nil {
+		return err
+	}
+
+	fmt.Println("Tables after Join (Pseudonymized)")
+
+	fmt.Println(intersectionMPPJ, "\n length ", intersectionMPPJ.Len())
+
+	// Check results
+
+	// Plaintext join
+	joinedTablesPlain := mppj.IntersectSimple(tables, sourceIDs)
+
+	fmt.Println("Intersection of tables (plaintext):")
+	fmt.Println(joinedTablesPlain, "\n length ", joinedTablesPlain.Len())
+
+	fmt.Println("Are tables' contents equal?", joinedTablesPlain.EqualContents(&intersectionMPPJ))
+	return nil
+}
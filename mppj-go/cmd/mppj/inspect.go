@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"mppj"
+	"mppj/api"
+	"mppj/cmd/common"
+	"os"
+)
+
+// inspect runs 'mppj inspect', which describes the files used by the parties: the key and session files, the
+// sources' encryption pools and the helper's row stores.
+func inspect(args []string) error {
+	f := common.NewFlags("inspect", "Describes the key, manifest, encryption pool, row store and transport files.")
+	f.Positional("FILE...", 1)
+	if err := f.Parse(args); err != nil {
+		return err
+	}
+	for _, path := range f.Args() {
+		desc, err := describe(path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		fmt.Printf("%s: %s\n", path, desc)
+	}
+	return nil
+}
+
+// describe returns the description of the file at path, which is recognized by its content.
+func describe(path string) (string, error) {
+	magic, err := readMagic(path)
+	if err != nil {
+		return "", err
+	}
+	switch magic {
+	case "MPPJPOOL":
+		pool, err := mppj.OpenEncryptionPool(path)
+		if err != nil {
+			return "", err
+		}
+		defer pool.Close()
+		blind, value := pool.Remaining()
+		return fmt.Sprintf("encryption pool with %d blinding and %d value pairs remaining", blind, value), nil
+	case "MPPJROWS":
+		store, err := mppj.OpenFileRowStore(path)
+		if err != nil {
+			return "", err
+		}
+		defer store.Close()
+		state := "incomplete"
+		if store.Complete() {
+			state = "complete"
+		}
+		return fmt.Sprintf("%s row store of %d converted rows", state, store.Len()), nil
+	case "MPPJFILE":
+		f, err := os.Open(path)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		h, err := api.ReadFileHeader(bufio.NewReader(f))
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s of %d rows written by %s for session %x (signature not verified)",
+			h.Kind, h.NumRows, h.Party, h.SessionID), nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	if block, _ := pem.Decode(data); block != nil {
+		switch block.Type {
+		case common.PublicKeyBlock:
+			var rpk mppj.PublicKeyTuple
+			if err := rpk.UnmarshalBinary(block.Bytes); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("receiver public key %x", block.Bytes), nil
+		case common.VerifyingKeyBlock:
+			return fmt.Sprintf("verifying key %x", block.Bytes), nil
+		case common.SigningKeyBlock:
+			if len(block.Bytes) != ed25519.SeedSize {
+				return "", errors.New("invalid signing key")
+			}
+			pk := ed25519.NewKeyFromSeed(block.Bytes).Public().(ed25519.PublicKey)
+			return fmt.Sprintf("signing key of verifying key %x", []byte(pk)), nil // does not show the secret
+		case common.SecretKeyBlock:
+			var rsk mppj.SecretKeyTuple
+			if err := rsk.UnmarshalBinary(block.Bytes); err != nil {
+				return "", err
+			}
+			pk, err := rsk.PublicKey().MarshalBinary()
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("receiver secret key of public key %x", pk), nil // does not show the secret
+		}
+		return "", fmt.Errorf("unknown PEM block type: %s", block.Type)
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		m, err := mppj.ReadManifest(bytes.NewReader(data))
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("manifest of session %x, with sources %v of %d rows each and helper %s at %s",
+			m.SessionID(), m.Sources(), m.Limits.RowsPerSource, m.Helper().ID, m.Helper().Address), nil
+	}
+
+	return "", errors.New("unknown file type")
+}
+
+// readMagic returns the first bytes of the file at path, which identify the binary files.
+func readMagic(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	magic := make([]byte, 8)
+	n, err := io.ReadFull(f, magic)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	return string(magic[:n]), nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"log"
+	"mppj"
+	"mppj/cmd/common"
+	"os"
+)
+
+// keygen runs 'mppj keygen', which writes a new key pair to two files. The public key file is distributed to the
+// other parties (e.g., in the session manifest), and the secret key file stays with its owner.
+func keygen(args []string) error {
+	f := common.NewFlags("keygen", "Generates the receiver's key pair, for the -receiver_pk and -receiver_sk flags, or a signing key pair of the file transport, for the -signing_key flag.")
+	keyType := f.String("type", "receiver", "the type of key pair: receiver or signing")
+	skPath := f.String("sk", "", "the secret key file to create, which is only readable by its owner (default is <type>.key)")
+	pkPath := f.String("pk", "", "the public key file to create (default is <type>.pub)")
+	f.Check(func() error {
+		if *keyType != "receiver" && *keyType != "signing" {
+			return fmt.Errorf("unknown key type: %s", *keyType)
+		}
+		if *skPath == "" {
+			*skPath = *keyType + ".key"
+		}
+		if *pkPath == "" {
+			*pkPath = *keyType + ".pub"
+		}
+		if *skPath == *pkPath {
+			return errors.New("the secret and public key files must differ")
+		}
+		return nil
+	})
+	if err := f.Parse(args); err != nil {
+		return err
+	}
+
+	var skData, pkData []byte
+	skBlock, pkBlock := common.SecretKeyBlock, common.PublicKeyBlock
+	if *keyType == "signing" {
+		pk, sk, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			return err
+		}
+		skData, pkData = sk.Seed(), pk
+		skBlock, pkBlock = common.SigningKeyBlock, common.VerifyingKeyBlock
+	} else {
+		rsk, rpk := mppj.ReceiverKeyGen()
+		var err error
+		if skData, err = rsk.MarshalBinary(); err != nil {
+			return err
+		}
+		if pkData, err = rpk.MarshalBinary(); err != nil {
+			return err
+		}
+	}
+	if err := common.WritePEM(*skPath, skBlock, skData, true); err != nil {
+		return fmt.Errorf("failed to write the secret key: %w", err)
+	}
+	if err := common.WritePEM(*pkPath, pkBlock, pkData, false); err != nil {
+		os.Remove(*skPath) // the secret key is useless without its public key
+		return fmt.Errorf("failed to write the public key: %w", err)
+	}
+	log.Printf("wrote the secret key to %s and the public key to %s", *skPath, *pkPath)
+	return nil
+}
@@ -0,0 +1,105 @@
+// The mppj command runs the parties of the protocol and the tools around them, as subcommands grouped by role.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"mppj/cmd/common"
+	"mppj/cmd/helper"
+	"mppj/cmd/local"
+	"mppj/cmd/receiver"
+	"mppj/cmd/source"
+	"os"
+	"strings"
+)
+
+// command is a node of the command tree, which either runs with its arguments or has subcommands.
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) error
+	sub     []*command
+}
+
+var root = &command{
+	name: "mppj",
+	sub: []*command{
+		{name: "keygen", summary: "generates the receiver's key pair", run: keygen},
+		{name: "session", summary: "manages the sessions", sub: []*command{
+			{name: "create", summary: "creates the manifest of a new session", run: createSession},
+		}},
+		{name: "source", summary: "runs a source", sub: []*command{
+			{name: "push", summary: "prepares the source's rows and pushes them to the helper", run: source.Push},
+			{name: "precompute", summary: "precomputes the encryption randomness of a source", run: source.Precompute},
+		}},
+		{name: "helper", summary: "runs the helper", sub: []*command{
+			{name: "serve", summary: "converts the sources' rows for the receiver", run: helper.Serve},
+			{name: "convert", summary: "converts the rows of the sources' files for the receiver (file transport)", run: helper.Convert},
+		}},
+		{name: "receiver", summary: "runs the receiver", sub: []*command{
+			{name: "pull", summary: "pulls the converted rows from the helper and joins them", run: receiver.Pull},
+		}},
+		{name: "local", summary: "runs all the parties in a single process on generated tables", run: local.Run},
+		{name: "inspect", summary: "describes the key, manifest, pool and store files", run: inspect},
+	},
+}
+
+func init() {
+	log.SetFlags(log.Flags() &^ log.Ldate)
+	log.SetPrefix("> ")
+}
+
+func main() {
+	err := root.execute(os.Args[1:], nil)
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+	case errors.Is(err, common.ErrUsage):
+		os.Exit(2)
+	default:
+		log.Fatal(err)
+	}
+}
+
+// execute runs the subcommand of c designated by args, where path is the names of the parents of c.
+func (c *command) execute(args []string, path []string) error {
+	path = append(path, c.name)
+	if c.run != nil {
+		return c.run(args)
+	}
+	if len(args) == 0 {
+		c.usage(os.Stderr, path)
+		return common.ErrUsage
+	}
+	switch args[0] {
+	case "help", "-h", "-help", "--help":
+		c.usage(os.Stdout, path)
+		return nil
+	}
+	for _, sub := range c.sub {
+		if sub.name == args[0] {
+			return sub.execute(args[1:], path)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "unknown command: %s %s\n", strings.Join(path, " "), args[0])
+	c.usage(os.Stderr, path)
+	return common.ErrUsage
+}
+
+// usage prints the subcommands of c, recursively.
+func (c *command) usage(w io.Writer, path []string) {
+	fmt.Fprintf(w, "Usage: %s <command> [flags]\n\nCommands:\n", strings.Join(path, " "))
+	var list func(cmds []*command, prefix string)
+	list = func(cmds []*command, prefix string) {
+		for _, sub := range cmds {
+			if sub.run != nil {
+				fmt.Fprintf(w, "  %-22s %s\n", prefix+sub.name, sub.summary)
+			}
+			list(sub.sub, prefix+sub.name+" ")
+		}
+	}
+	list(c.sub, "")
+	fmt.Fprintf(w, "\nRun '%s <command> -h' for the flags of a command.\n", strings.Join(path, " "))
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"mppj"
+	"mppj/cmd/common"
+	"mppj/cmd/config"
+	"mppj/output"
+	"os"
+	"slices"
+	"strings"
+)
+
+// createSession runs 'mppj session create', which writes the manifest of a new session, for the -session flag
+// of all the parties.
+func createSession(args []string) error {
+	f := common.NewFlags("session create", "Creates the manifest of a new session between the given parties, for the -session flag.")
+	sources := f.Sources(nil)
+	helperID := f.String("helper", "helper", "the id of the helper")
+	helperAddr := f.HelperAddress(nil)
+	receiverID := f.String("receiver", "receiver", "the id of the receiver")
+	pkPath := f.String("receiver_pk", "", "the receiver's public key file created with 'mppj keygen'")
+	nRows := f.NumRows(nil)
+	normalize := f.String("normalize", "", "the join key normalizers as a comma-separated list (e.g., trim,lower,nfkc)")
+	maxValLen := f.Int("max_value_length", config.MaxValLen, "the maximum length of the values, in bytes")
+	colTypes := f.String("column_types", "", "the types of the output columns for the jsonl and arrow formats, as source=type pairs (e.g., ds1=int64,ds2=string)")
+	signingKeys := f.String("signing_keys", "", "the verifying keys of the parties' files for the file transport, as id=file pairs of keys created with 'mppj keygen -type signing'")
+	outPath := f.String("output", "session.json", "the manifest file to create")
+	f.Check(func() error {
+		if *pkPath == "" {
+			return errors.New("the receiver's public key is required")
+		}
+		return nil
+	})
+	if err := f.Parse(args); err != nil {
+		return err
+	}
+
+	rpk, err := common.ReadPublicKey(*pkPath)
+	if err != nil {
+		return err
+	}
+	pk, err := rpk.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	types, err := output.ParseColumnTypes(*colTypes)
+	if err != nil {
+		return err
+	}
+
+	m := mppj.NewManifest()
+	m.Parties = []mppj.Party{
+		{ID: *helperID, Role: mppj.RoleHelper, Address: *helperAddr},
+		{ID: *receiverID, Role: mppj.RoleReceiver, PublicKey: pk},
+	}
+	for _, id := range *sources {
+		m.Parties = append(m.Parties, mppj.Party{ID: string(id), Role: mppj.RoleSource})
+	}
+	if *signingKeys != "" {
+		for _, s := range strings.Split(*signingKeys, ",") {
+			id, path, ok := strings.Cut(s, "=")
+			if !ok {
+				return fmt.Errorf("invalid signing key: %q", s)
+			}
+			i := slices.IndexFunc(m.Parties, func(p mppj.Party) bool { return p.ID == id })
+			if i < 0 {
+				return fmt.Errorf("signing key of unknown party %q", id)
+			}
+			if m.Parties[i].SigningKey, err = common.ReadVerifyingKey(path); err != nil {
+				return err
+			}
+		}
+	}
+	m.Join.Normalize = *normalize
+	m.Values.MaxLength = *maxValLen
+	if len(types) > 0 {
+		m.Values.Types = make(map[mppj.SourceID]string, len(types))
+		for id, t := range types {
+			m.Values.Types[id] = string(t)
+		}
+	}
+	m.Limits.RowsPerSource = *nRows
+	if err := m.Validate(); err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(*outPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := m.WriteTo(out); err != nil {
+		out.Close()
+		return fmt.Errorf("failed to write the manifest: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	log.Printf("wrote the manifest of session %x to %s", m.SessionID(), *outPath)
+	return nil
+}
@@ -0,0 +1,54 @@
+package receiver
+
+import (
+	"mppj"
+	"mppj/cmd/common"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// receiverMetrics are the receiver's metrics, in addition to the ones common to all parties.
+type receiverMetrics struct {
+	*common.Metrics
+
+	rowsReceived prometheus.Counter
+	rowsJoined   prometheus.Counter
+}
+
+func newReceiverMetrics(m *common.Metrics) *receiverMetrics {
+	factory := promauto.With(m.Registry)
+	return &receiverMetrics{
+		Metrics: m,
+		rowsReceived: factory.NewCounter(prometheus.CounterOpts{
+			Name: "mppj_receiver_rows_received_total",
+			Help: "The number of rows received from the helper.",
+		}),
+		rowsJoined: factory.NewCounter(prometheus.CounterOpts{
+			Name: "mppj_receiver_rows_joined_total",
+			Help: "The number of joined rows written to the output.",
+		}),
+	}
+}
+
+// registerQueue exposes the number of received rows waiting in queue for the join.
+func (rm *receiverMetrics) registerQueue(queue chan mppj.EncRowWithHint) {
+	promauto.With(rm.Registry).NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "mppj_receiver_queue_depth",
+		Help: "The number of received rows waiting for the join.",
+	}, func() float64 { return float64(len(queue)) })
+}
+
+// countingWriter counts the rows written to a writer.
+type countingWriter struct {
+	mppj.RowWriter
+	n prometheus.Counter
+}
+
+func (w countingWriter) WriteRow(values []string) error {
+	if err := w.RowWriter.WriteRow(values); err != nil {
+		return err
+	}
+	w.n.Inc()
+	return nil
+}
@@ -0,0 +1,309 @@
+// Package receiver implements the 'mppj receiver pull' subcommand, which pulls the converted rows from the
+// helper and joins them.
+package receiver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mppj"
+	"mppj/api"
+	"mppj/api/pb"
+	"mppj/cmd/common"
+	"mppj/output"
+	"mppj/transport"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/stats"
+)
+
+// maxRows bounds the number of rows announced by the helper when the number of rows per source is not known.
+const maxRows = 1 << 30
+
+// pullConfig holds the flag values of 'mppj receiver pull'.
+type pullConfig struct {
+	nodeID      *string
+	sources     *mppj.SourceList
+	nRows       *int
+	helperAddr  *string
+	session     *common.Session
+	rsk         *mppj.SecretKeyTuple
+	rpk         *mppj.PublicKeyTuple
+	norm        *mppj.Normalization
+	outFormat   *string
+	outFile     *string
+	inFile      *string
+	spillDir    *string
+	nParts      *int
+	batchSize   *int
+	types       *output.ColumnTypes
+	timeout     *time.Duration
+	metricsAddr *string
+	traceFile   *string
+}
+
+// Pull runs 'mppj receiver pull', which pulls the converted rows from the helper, joins them and writes the
+// result.
+func Pull(args []string) error {
+	f := common.NewFlags("receiver pull", "Pulls the converted rows from the helper, joins them and writes the result.")
+	cfg := &pullConfig{session: f.Session()}
+	cfg.nodeID = f.ID(cfg.session, mppj.RoleReceiver, "receiver")
+	cfg.sources = f.Sources(cfg.session)
+	cfg.nRows = f.Int("n_rows", 0, fmt.Sprintf("if positive, the number of rows per source, which is checked against the number of rows announced by the helper (otherwise, at most %d rows are accepted)", maxRows))
+	f.Check(func() error {
+		if declared, err := f.Declared(cfg.session, "n_rows"); declared {
+			*cfg.nRows = cfg.session.Manifest.Limits.RowsPerSource
+			return err
+		}
+		if *cfg.nRows < 0 {
+			return errors.New("the number of rows per source must not be negative")
+		}
+		return nil
+	})
+	cfg.helperAddr = f.HelperAddress(cfg.session)
+	cfg.rsk, cfg.rpk = f.ReceiverKeys(cfg.session)
+	cfg.norm = f.Normalization(cfg.session, "the join key normalizers used by the sources, as a comma-separated list")
+	cfg.outFormat = f.String("format", "csv", "the output format: "+strings.Join(output.Formats, ", "))
+	cfg.outFile = f.String("output", "stdout", "the output file (or 'stdout' for standard output)")
+	cfg.inFile = f.String("input", "", "if set, joins the rows of this signed file of the helper instead of pulling them from the helper (for the file transport)")
+	cfg.spillDir = f.String("spill_dir", "", "if set, groups the rows in temporary files in this directory instead of in memory")
+	cfg.nParts = f.Int("spill_partitions", 256, "the number of temporary files for grouping the rows on disk")
+	cfg.batchSize = f.BatchSize("the number of rows per message received from the helper (1 uses the single-row messages)")
+	cfg.types = new(output.ColumnTypes)
+	f.Func("column_types", "the types of the output columns for the jsonl and arrow formats, as source=type pairs (e.g., ds1=int64,ds2=string)", func(s string) (err error) {
+		*cfg.types, err = output.ParseColumnTypes(s)
+		return err
+	})
+	f.Check(func() (err error) {
+		if declared, err := f.Declared(cfg.session, "column_types"); declared {
+			if err != nil {
+				return err
+			}
+			*cfg.types, err = output.NewColumnTypes(cfg.session.Manifest.Values.Types)
+			return err
+		}
+		return nil
+	})
+	cfg.timeout = f.Timeout("if positive, aborts after this duration")
+	cfg.metricsAddr = f.MetricsAddress()
+	cfg.traceFile = f.Trace()
+	f.Check(func() error {
+		if !slices.Contains(output.Formats, *cfg.outFormat) {
+			return fmt.Errorf("unknown output format: %s", *cfg.outFormat)
+		}
+		return nil
+	})
+	if err := f.Parse(args); err != nil {
+		return err
+	}
+
+	out := os.Stdout
+	if *cfg.outFile != "stdout" {
+		var err error
+		if out, err = os.Create(*cfg.outFile); err != nil {
+			return fmt.Errorf("failed to create output file: %w", err)
+		}
+		defer out.Close()
+	}
+
+	w, err := output.NewWriter(*cfg.outFormat, out, *cfg.types)
+	if err != nil {
+		return fmt.Errorf("invalid output format: %w", err)
+	}
+
+	log.Printf("MPPJ Receiver %s", *cfg.nodeID)
+
+	// opens a helper stream
+	statsHandler := api.NewStatsHandler()
+	metrics := newReceiverMetrics(common.NewMetrics(statsHandler))
+	if *cfg.metricsAddr != "" {
+		if err := common.ServeMetrics(*cfg.metricsAddr, metrics.Metrics); err != nil {
+			return fmt.Errorf("failed to serve the metrics: %w", err)
+		}
+	}
+	r := mppj.NewReceiverWithKeys(cfg.norm.BindSessionID(cfg.session.ID), *cfg.sources, *cfg.rsk, *cfg.rpk)
+
+	var start, startActive time.Time
+	start = time.Now() // measured time from helper connect
+
+	sigCtx, cancel := common.SignalContext(*cfg.timeout)
+	defer cancel()
+	ctx, abort := context.WithCancelCause(sigCtx) // aborts the join on the first reception error
+	defer abort(nil)
+
+	shutdownTracing := func() error { return nil }
+	if *cfg.traceFile != "" {
+		if shutdownTracing, err = common.StartTracing(*cfg.traceFile, "mppj-receiver"); err != nil {
+			return fmt.Errorf("failed to start tracing: %w", err)
+		}
+	}
+	ctx, span := common.Tracer.Start(ctx, "receiver.run")
+	endRun := func(err error) {
+		mppj.EndSpan(span, err)
+		if err := shutdownTracing(); err != nil {
+			log.Printf("Failed to write the trace: %v", err)
+		}
+	}
+
+	endWait := metrics.StartPhase("wait") // until the helper has converted the rows
+	downloadCtx, downloadSpan := common.Tracer.Start(ctx, "receiver.download")
+	failDownload := func(err error) error {
+		mppj.EndSpan(downloadSpan, err)
+		endRun(err)
+		return err
+	}
+	tr, err := cfg.transport(statsHandler)
+	if err != nil {
+		return failDownload(err)
+	}
+	defer tr.Close()
+	rows, err := tr.PullRows(api.InjectTraceContext(downloadCtx))
+	if err != nil {
+		return failDownload(fmt.Errorf("failed to open stream: %w", err))
+	}
+	numRows := rows.NumRows()
+	if expected := *cfg.nRows * len(*cfg.sources); expected > 0 && numRows != expected {
+		rows.Close()
+		return failDownload(fmt.Errorf("the helper announced %d rows, expected %d", numRows, expected))
+	}
+	if numRows <= 0 || numRows > maxRows {
+		rows.Close()
+		return failDownload(fmt.Errorf("the helper announced %d rows, expected between 1 and %d", numRows, maxRows))
+	}
+	log.Printf("expecting %d rows from helper", numRows)
+	endWait()
+
+	// the queues are bounded, so that the reception waits for the join rather than buffering the rows
+	queueSize := 16 * runtime.NumCPU()
+	inRowApi := make(chan *pb.EncRowWithHint, queueSize)
+	inRows := make(chan mppj.EncRowWithHint, queueSize)
+	metrics.registerQueue(inRows)
+
+	go func() {
+		endReceive := metrics.StartPhase("receive")
+		defer endReceive()
+		defer close(inRowApi)
+		var err error
+		defer func() { mppj.EndSpan(downloadSpan, err) }() // before closing inRowApi, which ends the run
+		rc := 0
+	recv:
+		for {
+			var rowMsgs []*pb.EncRowWithHint
+			rowMsgs, err = rows.Recv()
+			if rc == 0 {
+				log.Println("started receiving rows from the helper")
+				startActive = time.Now()
+			}
+			if err == io.EOF {
+				log.Printf("dowloaded %d rows", rc)
+				if rc < numRows {
+					err = fmt.Errorf("expected %d rows but got only %d", numRows, rc)
+				} else {
+					err = nil
+					break
+				}
+			}
+			if err != nil {
+				abort(fmt.Errorf("failed to receive row: %w", err))
+				break
+			}
+
+			rc += len(rowMsgs)
+			metrics.rowsReceived.Add(float64(len(rowMsgs)))
+
+			for _, rowMsg := range rowMsgs {
+				select {
+				case inRowApi <- rowMsg:
+				case <-ctx.Done(): // the join is aborted
+					err = context.Cause(ctx)
+					break recv
+				}
+			}
+
+			if rc >= numRows {
+				log.Printf("all %d rows received", rc)
+				break
+			}
+		}
+		if cerr := rows.Close(); cerr != nil && err == nil {
+			err = cerr
+			abort(fmt.Errorf("failed to close the download: %w", err))
+		}
+	}()
+
+	wg := sync.WaitGroup{}
+	once := sync.Once{}
+	for range runtime.NumCPU() {
+		wg.Add(1)
+		go func() {
+			for inRowMsg := range inRowApi {
+				inRow, err := api.GetEncRowWithHintFromMsg(inRowMsg)
+				if err != nil {
+					abort(fmt.Errorf("failed to convert incoming row: %w", err))
+					continue // drains the rows
+				}
+				select {
+				case inRows <- inRow:
+				case <-ctx.Done(): // the join stopped reading the rows
+				}
+			}
+			wg.Done()
+			once.Do(func() { wg.Wait(); close(inRows) })
+		}()
+	}
+
+	// the joined rows are written as they are decrypted
+	var n, skipped int
+	endJoin := metrics.StartPhase("join")
+	counted := countingWriter{RowWriter: w, n: metrics.rowsJoined}
+	if *cfg.spillDir != "" {
+		n, skipped, err = r.JoinTablesStreamToExternal(ctx, inRows, counted, *cfg.spillDir, *cfg.nParts)
+	} else {
+		n, skipped, err = r.JoinTablesStreamTo(ctx, inRows, counted)
+	}
+	endJoin()
+	endRun(err)
+	if err != nil {
+		return fmt.Errorf("failed to join tables: %w", err)
+	}
+	if skipped > 0 {
+		log.Printf("Warning: skipped %d groups with several rows of a source", skipped)
+	}
+
+	log.Printf("Result has %d rows", n)
+	common.PrintStats(statsHandler.GetStats(), time.Since(start), time.Since(startActive))
+	return nil
+}
+
+// transport returns the transport from the helper, which reads the rows of the input file if it is set.
+func (cfg *pullConfig) transport(statsHandler stats.Handler) (transport.Transport, error) {
+	if *cfg.inFile != "" {
+		var helpers []string
+		if cfg.session.Manifest != nil {
+			helpers = append(helpers, cfg.session.Manifest.Helper().ID)
+		}
+		return &transport.Files{
+			SessionID:    cfg.session.ID,
+			Party:        *cfg.nodeID,
+			VerifyingKey: cfg.session.FileKey(api.HelperFile, helpers...),
+			HelperPath:   *cfg.inFile,
+		}, nil
+	}
+	var opts []grpc.DialOption
+	opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials())) // no TLS for now
+	opts = append(opts, grpc.WithStatsHandler(statsHandler))
+	tr, err := transport.NewGRPC(*cfg.helperAddr, *cfg.batchSize, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to helper: %w", err)
+	}
+	return tr, nil
+}
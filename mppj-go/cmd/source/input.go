@@ -0,0 +1,325 @@
+package source
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// keySeparator separates the columns of composite keys.
+const keySeparator = "|"
+
+// keyEscaper escapes keySeparator and the escape character in the columns of composite keys.
+var keyEscaper = strings.NewReplacer(`\`, `\\`, keySeparator, `\`+keySeparator)
+
+// joinKey returns the key of the key columns. The columns of composite keys are escaped with keyEscaper and
+// joined with keySeparator, so that different columns give different keys, e.g., ("a|b", "c") and ("a", "b|c").
+// The key of a single column is the column.
+func joinKey(cols []string) string {
+	if len(cols) == 1 {
+		return cols[0]
+	}
+	escaped := make([]string, len(cols))
+	for i, col := range cols {
+		escaped[i] = keyEscaper.Replace(col)
+	}
+	return strings.Join(escaped, keySeparator)
+}
+
+// inputConfig describes the format of the input file and the columns to read.
+type inputConfig struct {
+	format    string   // csv, tsv or jsonl
+	delimiter rune     // the field delimiter (csv and tsv), which also joins the values of several columns (all formats)
+	quoting   string   // rfc4180, lazy or none (csv and tsv)
+	header    bool     // whether the first record is a header (csv and tsv)
+	keyCols   []string // the key columns, composite keys are joined with joinKey
+	valCols   []string // the value columns, all non-key columns if empty
+	maxValLen int      // the maximum length of the values, in bytes
+}
+
+// newInputConfig creates an input configuration from the flag values, applying the format's defaults.
+func newInputConfig(format, delimiter, quoting string, header bool, keyCols, valCols string, maxValLen int) (*inputConfig, error) {
+	c := &inputConfig{format: format, header: header, keyCols: splitList(keyCols), valCols: splitList(valCols), maxValLen: maxValLen}
+	switch format {
+	case "csv":
+		c.delimiter, c.quoting = ',', "rfc4180"
+	case "tsv":
+		c.delimiter, c.quoting = '\t', "none"
+	case "jsonl":
+		c.delimiter = ','
+		if len(c.keyCols) == 0 {
+			return nil, errors.New("the key fields must be specified for the jsonl format")
+		}
+	default:
+		return nil, fmt.Errorf("unknown input format: %q", format)
+	}
+	if delimiter != "" {
+		d, err := strconv.Unquote(`"` + delimiter + `"`) // allows escape sequences such as \t
+		if err != nil || utf8.RuneCountInString(d) != 1 {
+			return nil, fmt.Errorf("invalid delimiter: %q", delimiter)
+		}
+		c.delimiter, _ = utf8.DecodeRuneInString(d)
+	}
+	if quoting != "" {
+		switch quoting {
+		case "rfc4180", "lazy", "none":
+			c.quoting = quoting
+		default:
+			return nil, fmt.Errorf("unknown quoting: %q", quoting)
+		}
+	}
+	return c, nil
+}
+
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+// open opens the input file, or the standard input if filename is "stdin".
+func open(filename string) (io.ReadCloser, error) {
+	if filename == "stdin" {
+		return io.NopCloser(os.Stdin), nil
+	}
+	return os.Open(filename)
+}
+
+// rows returns an iterator over the (key, value) pairs of the input. The iteration stops at the first
+// error, which is then stored in the returned error.
+func (c *inputConfig) rows(r io.Reader) (iter.Seq2[string, string], *error) {
+	if c.format == "jsonl" {
+		return c.jsonRows(r)
+	}
+	return c.delimitedRows(r)
+}
+
+// delimitedRows reads the CSV and TSV formats.
+func (c *inputConfig) delimitedRows(r io.Reader) (iter.Seq2[string, string], *error) {
+	var readErr error
+	var next func() ([]string, error)
+	switch c.quoting {
+	case "none":
+		sc := bufio.NewScanner(r)
+		sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		next = func() ([]string, error) {
+			if !sc.Scan() {
+				if err := sc.Err(); err != nil {
+					return nil, err
+				}
+				return nil, io.EOF
+			}
+			return strings.Split(strings.TrimSuffix(sc.Text(), "\r"), string(c.delimiter)), nil
+		}
+	default:
+		cr := csv.NewReader(r)
+		cr.Comma = c.delimiter
+		cr.LazyQuotes = c.quoting == "lazy"
+		cr.FieldsPerRecord = -1
+		cr.ReuseRecord = true
+		next = cr.Read
+	}
+
+	return func(yield func(string, string) bool) {
+		var keyIdx, valIdx []int
+		line := 0
+		for {
+			record, err := next()
+			line++
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				readErr = err
+				return
+			}
+			if keyIdx == nil {
+				names := record
+				if !c.header {
+					names = make([]string, len(record))
+					for i := range names {
+						names[i] = strconv.Itoa(i)
+					}
+				}
+				if keyIdx, valIdx, readErr = c.columnIndices(names); readErr != nil {
+					return
+				}
+				if c.header {
+					continue
+				}
+			}
+			key, vals, err := selectColumns(record, keyIdx, valIdx)
+			if err != nil {
+				readErr = fmt.Errorf("line %d: %w", line, err)
+				return
+			}
+			val := strings.Join(vals, string(c.delimiter))
+			if len(val) > c.maxValLen {
+				readErr = fmt.Errorf("line %d: value too long: %s", line, val)
+				return
+			}
+			if !yield(key, val) {
+				return
+			}
+		}
+	}, &readErr
+}
+
+// columnIndices resolves the key and value columns from the column names.
+func (c *inputConfig) columnIndices(names []string) (keyIdx, valIdx []int, err error) {
+	index := make(map[string]int, len(names))
+	for i, name := range names {
+		index[name] = i
+	}
+	keyCols := c.keyCols
+	if len(keyCols) == 0 {
+		if len(names) == 0 {
+			return nil, nil, errors.New("empty header")
+		}
+		keyCols = names[:1]
+	}
+	isKey := make(map[int]bool)
+	for _, col := range keyCols {
+		i, ok := index[col]
+		if !ok {
+			return nil, nil, fmt.Errorf("unknown key column: %q", col)
+		}
+		keyIdx = append(keyIdx, i)
+		isKey[i] = true
+	}
+	if len(c.valCols) == 0 {
+		valIdx = make([]int, 0, len(names))
+		for i := range names {
+			if !isKey[i] {
+				valIdx = append(valIdx, i)
+			}
+		}
+		return keyIdx, valIdx, nil
+	}
+	for _, col := range c.valCols {
+		i, ok := index[col]
+		if !ok {
+			return nil, nil, fmt.Errorf("unknown value column: %q", col)
+		}
+		valIdx = append(valIdx, i)
+	}
+	return keyIdx, valIdx, nil
+}
+
+func selectColumns(record []string, keyIdx, valIdx []int) (string, []string, error) {
+	keys := make([]string, len(keyIdx))
+	for i, idx := range keyIdx {
+		if idx >= len(record) {
+			return "", nil, fmt.Errorf("missing column %d", idx)
+		}
+		keys[i] = record[idx]
+	}
+	vals := make([]string, len(valIdx))
+	for i, idx := range valIdx {
+		if idx >= len(record) {
+			return "", nil, fmt.Errorf("missing column %d", idx)
+		}
+		vals[i] = record[idx]
+	}
+	return joinKey(keys), vals, nil
+}
+
+// jsonRows reads the JSON Lines format. Each line is an object, and the values of the non-string fields
+// are read as their JSON encoding. The value fields default to all non-key fields in their order of appearance,
+// and their values are joined with the delimiter, as the columns of the delimited formats.
+func (c *inputConfig) jsonRows(r io.Reader) (iter.Seq2[string, string], *error) {
+	var readErr error
+	dec := json.NewDecoder(r)
+	return func(yield func(string, string) bool) {
+		for line := 1; ; line++ {
+			fields, names, err := decodeObject(dec)
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				readErr = fmt.Errorf("record %d: %w", line, err)
+				return
+			}
+			keys := make([]string, len(c.keyCols))
+			for i, col := range c.keyCols {
+				v, ok := fields[col]
+				if !ok {
+					readErr = fmt.Errorf("record %d: missing key field %q", line, col)
+					return
+				}
+				keys[i] = v
+			}
+			valCols := c.valCols
+			if len(valCols) == 0 {
+				valCols = make([]string, 0, len(names))
+				for _, name := range names {
+					if !slices.Contains(c.keyCols, name) {
+						valCols = append(valCols, name)
+					}
+				}
+			}
+			vals := make([]string, len(valCols))
+			for i, col := range valCols {
+				vals[i] = fields[col] // missing fields are empty
+			}
+			val := strings.Join(vals, string(c.delimiter))
+			if len(val) > c.maxValLen {
+				readErr = fmt.Errorf("record %d: value too long: %s", line, val)
+				return
+			}
+			if !yield(joinKey(keys), val) {
+				return
+			}
+		}
+	}, &readErr
+}
+
+// decodeObject decodes the next JSON object, and returns its fields as strings and its field names in order.
+func decodeObject(dec *json.Decoder) (map[string]string, []string, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, nil, err
+	}
+	if tok != json.Delim('{') {
+		return nil, nil, fmt.Errorf("expected an object, got %v", tok)
+	}
+	fields := make(map[string]string)
+	names := make([]string, 0)
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, nil, err
+		}
+		name := tok.(string) // object keys are always strings
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, nil, err
+		}
+		var val string
+		switch {
+		case string(raw) == "null":
+		case len(raw) > 0 && raw[0] == '"':
+			if err := json.Unmarshal(raw, &val); err != nil {
+				return nil, nil, err
+			}
+		default:
+			val = string(raw)
+		}
+		fields[name] = val
+		names = append(names, name)
+	}
+	if _, err := dec.Token(); err != nil { // closing '}'
+		return nil, nil, err
+	}
+	return fields, names, nil
+}
@@ -0,0 +1,279 @@
+package source
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestNewInputConfig(t *testing.T) {
+	tests := []struct {
+		name                         string
+		format, delimiter, quoting   string
+		keyCols                      string
+		expectedDelimiter            rune
+		expectedQuoting, expectedErr string
+	}{
+		{name: "csv", format: "csv", expectedDelimiter: ',', expectedQuoting: "rfc4180"},
+		{name: "tsv", format: "tsv", expectedDelimiter: '\t', expectedQuoting: "none"},
+		{name: "jsonl", format: "jsonl", keyCols: "id", expectedDelimiter: ','},
+		{name: "escaped delimiter", format: "csv", delimiter: `\t`, quoting: "lazy", expectedDelimiter: '\t', expectedQuoting: "lazy"},
+		{name: "jsonl delimiter", format: "jsonl", delimiter: ";", keyCols: "id", expectedDelimiter: ';'},
+		{name: "unknown format", format: "xml", expectedErr: "unknown input format"},
+		{name: "jsonl without key", format: "jsonl", expectedErr: "key fields must be specified"},
+		{name: "long delimiter", format: "csv", delimiter: ";;", expectedErr: "invalid delimiter"},
+		{name: "invalid escape", format: "csv", delimiter: `\q`, expectedErr: "invalid delimiter"},
+		{name: "unknown quoting", format: "csv", quoting: "double", expectedErr: "unknown quoting"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := newInputConfig(tt.format, tt.delimiter, tt.quoting, true, tt.keyCols, "", 100)
+			if tt.expectedErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedErr) {
+					t.Fatalf("expected an error containing %q, got %v", tt.expectedErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.delimiter != tt.expectedDelimiter || c.quoting != tt.expectedQuoting {
+				t.Fatalf("unexpected delimiter %q and quoting %q", c.delimiter, c.quoting)
+			}
+		})
+	}
+}
+
+func TestInputRows(t *testing.T) {
+	tests := []struct {
+		name                       string
+		format, delimiter, quoting string
+		noHeader                   bool
+		keyCols, valCols           string
+		maxValLen                  int
+		input                      string
+		expected                   [][2]string // the (key, value) pairs
+		expectedErr                string
+	}{
+		{
+			name:     "csv",
+			format:   "csv",
+			input:    "id,name,age\nu1,alice,30\nu2,bob,40\n",
+			expected: [][2]string{{"u1", "alice,30"}, {"u2", "bob,40"}},
+		},
+		{
+			name:     "csv quoted",
+			format:   "csv",
+			input:    "id,name\r\nu1,\"smith, alice\"\r\n\"u\"\"2\",bob\r\n",
+			expected: [][2]string{{"u1", "smith, alice"}, {`u"2`, "bob"}},
+		},
+		{
+			name:     "csv lazy quotes",
+			format:   "csv",
+			quoting:  "lazy",
+			input:    "id,name\nu1,al\"ice\n",
+			expected: [][2]string{{"u1", `al"ice`}},
+		},
+		{
+			name:      "csv delimiter",
+			format:    "csv",
+			delimiter: ";",
+			input:     "id;name;age\nu1;alice;30\n",
+			expected:  [][2]string{{"u1", "alice;30"}},
+		},
+		{
+			name:     "csv without header",
+			format:   "csv",
+			noHeader: true,
+			keyCols:  "1",
+			input:    "alice,u1,30\nbob,u2,40\n",
+			expected: [][2]string{{"u1", "alice,30"}, {"u2", "bob,40"}},
+		},
+		{
+			name:     "csv composite key and values",
+			format:   "csv",
+			keyCols:  "first,last",
+			valCols:  "age",
+			input:    "first,last,city,age\nalice,smith,bern,30\n",
+			expected: [][2]string{{"alice|smith", "30"}},
+		},
+		{
+			name:     "csv composite key with separator",
+			format:   "csv",
+			keyCols:  "first,last",
+			input:    "first,last,age\na|b,c,30\na,b|c,40\na\\,b,50\na,\\b,60\nalice,,70\n",
+			expected: [][2]string{{`a\|b|c`, "30"}, {`a|b\|c`, "40"}, {`a\\|b`, "50"}, {`a|\\b`, "60"}, {"alice|", "70"}},
+		},
+		{
+			name:     "csv key with separator",
+			format:   "csv",
+			input:    "id,name\na|b,alice\n",
+			expected: [][2]string{{"a|b", "alice"}},
+		},
+		{
+			name:     "tsv",
+			format:   "tsv",
+			input:    "id\tname\tage\r\nu1\t\"alice\"\t30\r\n",
+			expected: [][2]string{{"u1", "\"alice\"\t30"}},
+		},
+		{
+			name:      "tsv delimiter",
+			format:    "tsv",
+			delimiter: "|",
+			input:     "id|name|age\nu1|alice|30\n",
+			expected:  [][2]string{{"u1", "alice|30"}},
+		},
+		{
+			name:     "jsonl",
+			format:   "jsonl",
+			keyCols:  "id",
+			input:    "{\"id\": \"u1\", \"name\": \"alice\", \"age\": 30, \"tags\": [\"a\"], \"city\": null}\n{\"name\": \"bob\", \"id\": \"u2\"}\n",
+			expected: [][2]string{{"u1", `alice,30,["a"],`}, {"u2", "bob"}},
+		},
+		{
+			name:      "jsonl delimiter and values",
+			format:    "jsonl",
+			delimiter: ";",
+			keyCols:   "first,last",
+			valCols:   "age,city",
+			input:     "{\"first\": \"alice\", \"last\": \"smith\", \"age\": 30, \"city\": \"bern\"}\n{\"first\": \"bob\", \"last\": \"jones\"}\n",
+			expected:  [][2]string{{"alice|smith", "30;bern"}, {"bob|jones", ";"}},
+		},
+		{
+			name:     "jsonl composite key with separator",
+			format:   "jsonl",
+			keyCols:  "first,last",
+			input:    "{\"first\": \"a|b\", \"last\": \"c\"}\n{\"first\": \"a\", \"last\": \"b|c\"}\n",
+			expected: [][2]string{{`a\|b|c`, ""}, {`a|b\|c`, ""}},
+		},
+		{
+			name:        "csv unknown key column",
+			format:      "csv",
+			keyCols:     "uid",
+			input:       "id,name\nu1,alice\n",
+			expectedErr: `unknown key column: "uid"`,
+		},
+		{
+			name:        "csv unknown value column",
+			format:      "csv",
+			valCols:     "age",
+			input:       "id,name\nu1,alice\n",
+			expectedErr: `unknown value column: "age"`,
+		},
+		{
+			name:        "csv missing column",
+			format:      "csv",
+			input:       "id,name,age\nu1,alice,30\nu2,bob\n",
+			expected:    [][2]string{{"u1", "alice,30"}},
+			expectedErr: "line 3: missing column 2",
+		},
+		{
+			name:        "csv bare quote",
+			format:      "csv",
+			input:       "id,name\nu1,al\"ice\n",
+			expectedErr: "bare \" in non-quoted-field",
+		},
+		{
+			name:        "csv value too long",
+			format:      "csv",
+			maxValLen:   8,
+			input:       "id,name\nu1,alice\nu2,alexandra\n",
+			expected:    [][2]string{{"u1", "alice"}},
+			expectedErr: "line 3: value too long",
+		},
+		{
+			name:        "tsv missing column",
+			format:      "tsv",
+			input:       "id\tname\nu1\n",
+			expectedErr: "line 2: missing column 1",
+		},
+		{
+			name:        "jsonl missing key",
+			format:      "jsonl",
+			keyCols:     "id",
+			input:       "{\"id\": \"u1\"}\n{\"name\": \"bob\"}\n",
+			expected:    [][2]string{{"u1", ""}},
+			expectedErr: `record 2: missing key field "id"`,
+		},
+		{
+			name:        "jsonl not an object",
+			format:      "jsonl",
+			keyCols:     "id",
+			input:       "[\"u1\", \"alice\"]\n",
+			expectedErr: "record 1: expected an object",
+		},
+		{
+			name:        "jsonl invalid",
+			format:      "jsonl",
+			keyCols:     "id",
+			input:       "{\"id\": \"u1\",}\n",
+			expectedErr: "record 1: invalid character",
+		},
+		{
+			name:        "jsonl value too long",
+			format:      "jsonl",
+			keyCols:     "id",
+			maxValLen:   8,
+			input:       "{\"id\": \"u1\", \"name\": \"alexandra\"}\n",
+			expectedErr: "record 1: value too long",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			maxValLen := tt.maxValLen
+			if maxValLen == 0 {
+				maxValLen = 100
+			}
+			c, err := newInputConfig(tt.format, tt.delimiter, tt.quoting, !tt.noHeader, tt.keyCols, tt.valCols, maxValLen)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rows, readErr := c.rows(strings.NewReader(tt.input))
+			var got [][2]string
+			for key, val := range rows {
+				got = append(got, [2]string{key, val})
+			}
+			if tt.expectedErr != "" {
+				if *readErr == nil || !strings.Contains((*readErr).Error(), tt.expectedErr) {
+					t.Fatalf("expected an error containing %q, got %v", tt.expectedErr, *readErr)
+				}
+			} else if *readErr != nil {
+				t.Fatal(*readErr)
+			}
+			if !slices.Equal(got, tt.expected) {
+				t.Fatalf("expected rows %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	c, err := newInputConfig("csv", "", "", true, "", "", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "input.csv")
+	if err := os.WriteFile(path, []byte("id,name\nu1,alice\nu2,bob\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	table, err := readFile(path, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*table) != 2 || (*table)["u1"] != "alice" || (*table)["u2"] != "bob" {
+		t.Fatalf("unexpected table %v", *table)
+	}
+
+	if _, err := readFile(filepath.Join(t.TempDir(), "missing.csv"), c); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected os.ErrNotExist, got %v", err)
+	}
+	if err := os.WriteFile(path, []byte("id,name\nu1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readFile(path, c); err == nil || !strings.Contains(err.Error(), "missing column") {
+		t.Fatalf("expected a missing column, got %v", err)
+	}
+}
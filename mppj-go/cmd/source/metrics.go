@@ -0,0 +1,31 @@
+package source
+
+import (
+	"mppj/cmd/common"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// sourceMetrics are the source's metrics, in addition to the ones common to all parties.
+type sourceMetrics struct {
+	*common.Metrics
+
+	rowsPrepared prometheus.Counter
+	rowsSent     prometheus.Counter
+}
+
+func newSourceMetrics(m *common.Metrics) *sourceMetrics {
+	factory := promauto.With(m.Registry)
+	return &sourceMetrics{
+		Metrics: m,
+		rowsPrepared: factory.NewCounter(prometheus.CounterOpts{
+			Name: "mppj_source_rows_prepared_total",
+			Help: "The number of rows encrypted for the helper.",
+		}),
+		rowsSent: factory.NewCounter(prometheus.CounterOpts{
+			Name: "mppj_source_rows_sent_total",
+			Help: "The number of rows sent to the helper.",
+		}),
+	}
+}
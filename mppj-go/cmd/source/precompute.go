@@ -0,0 +1,43 @@
+package source
+
+import (
+	"errors"
+	"log"
+	"mppj"
+	"mppj/cmd/common"
+	"time"
+)
+
+// Precompute runs 'mppj source precompute', which generates the encryption randomness of the source's online
+// phase in a pool file, for use with 'mppj source push -pool'.
+func Precompute(args []string) error {
+	f := common.NewFlags("source precompute", "Generates the encryption randomness for the rows of a later 'mppj source push -pool'.")
+	session := f.Session()
+	nodeID := f.ID(session, mppj.RoleSource, "")
+	rpk := f.ReceiverPK(session)
+	poolPath := f.String("pool", "", "the pool file to create")
+	nRows := f.Int("rows", 0, "the number of rows to generate the randomness for")
+	debugSeed := f.DebugSeed("source")
+	f.Check(func() error {
+		if *poolPath == "" {
+			return errors.New("the pool file is required")
+		}
+		if *nRows <= 0 {
+			return errors.New("the number of rows must be positive")
+		}
+		return nil
+	})
+	if err := f.Parse(args); err != nil {
+		return err
+	}
+
+	// the normalization only applies to the online phase
+	ds := newDataSource(*nodeID, session.ID, *rpk, nil, *debugSeed)
+	log.Printf("precomputing the encryption randomness for %d rows into %s...", *nRows, *poolPath)
+	start := time.Now()
+	if err := ds.Precompute(*poolPath, *nRows, session.MaxValueLength()); err != nil {
+		return err
+	}
+	log.Printf("done precomputing in %s", time.Since(start))
+	return nil
+}
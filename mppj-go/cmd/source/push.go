@@ -0,0 +1,347 @@
+// Package source implements the 'mppj source' subcommands, which prepare the rows of a source for the
+// receiver and push them to the helper.
+package source
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"iter"
+	"log"
+	"mppj"
+	"mppj/api"
+	"mppj/api/pb"
+	"mppj/cmd/common"
+	"mppj/transport"
+	"runtime"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/stats"
+)
+
+// pushConfig holds the flag values of 'mppj source push'.
+type pushConfig struct {
+	nodeID      *string
+	helperAddr  *string
+	session     *common.Session
+	rpk         *mppj.PublicKeyTuple
+	norm        *mppj.Normalization
+	input       *string
+	format      *string
+	delimiter   *string
+	quoting     *string
+	header      *bool
+	keyCols     *string
+	valCols     *string
+	nCPU        *int
+	streamIn    *bool
+	tmpDir      *string
+	nBuckets    *int
+	poolPath    *string
+	outFile     *string
+	signingKey  *ed25519.PrivateKey
+	batchSize   *int
+	timeout     *time.Duration
+	debugSeed   *string
+	metricsAddr *string
+	traceFile   *string
+}
+
+// Push runs 'mppj source push', which reads the source's table, prepares its rows and sends them to the helper.
+func Push(args []string) error {
+	f := common.NewFlags("source push", "Reads the source's table, prepares its rows and sends them to the helper.")
+	cfg := &pushConfig{session: f.Session()}
+	cfg.nodeID = f.ID(cfg.session, mppj.RoleSource, "")
+	cfg.helperAddr = f.HelperAddress(cfg.session)
+	cfg.rpk = f.ReceiverPK(cfg.session)
+	cfg.norm = f.Normalization(cfg.session, "the join key normalizers as a comma-separated list (e.g., trim,lower,nfkc)")
+	cfg.input = f.String("input", "stdin", "the input file (or 'stdin' for standard input)")
+	cfg.format = f.String("format", "csv", "the input format: csv, tsv or jsonl")
+	cfg.delimiter = f.String("delimiter", "", "the field delimiter for the csv and tsv formats, which also joins the values of several value columns in all formats (default is ',' for csv and jsonl and '\\t' for tsv)")
+	cfg.quoting = f.String("quoting", "", "the quoting for the csv and tsv formats: rfc4180, lazy or none (default is rfc4180 for csv and none for tsv)")
+	cfg.header = f.Bool("header", true, "whether the csv and tsv inputs have a header (otherwise, columns are named by their index from 0)")
+	cfg.keyCols = f.String("key", "", "the key column(s) as a comma-separated list, composite keys are joined with '|', which is escaped with '\\' in the columns (default is the first column)")
+	cfg.valCols = f.String("values", "", "the value columns as a comma-separated list (default is all non-key columns)")
+	cfg.nCPU = f.Int("n_cpu", 0, "number of CPUs to use (default is all available CPUs)")
+	cfg.streamIn = f.Bool("stream", false, "stream the input through an external-memory shuffle instead of loading it in memory")
+	cfg.tmpDir = f.String("tmp_dir", "", "the directory for the temporary files of the streaming mode (default is the system's)")
+	cfg.nBuckets = f.Int("shuffle_buckets", 256, "the number of temporary files of the external-memory shuffle")
+	cfg.poolPath = f.String("pool", "", "the file of precomputed encryption randomness (see 'mppj source precompute'), which is consumed by the online phase")
+	cfg.outFile = f.String("output", "", "if set, writes the prepared rows to this signed file instead of pushing them to the helper (for the file transport)")
+	cfg.signingKey = f.SigningKey(cfg.session, cfg.nodeID)
+	f.Check(func() error {
+		if *cfg.outFile != "" && *cfg.signingKey == nil {
+			return errors.New("the signing key is required to write the output file with a session manifest")
+		}
+		return nil
+	})
+	cfg.batchSize = f.BatchSize("the number of rows per message sent to the helper (1 uses the single-row messages)")
+	cfg.timeout = f.Timeout("if positive, aborts after this duration")
+	cfg.debugSeed = f.DebugSeed("source")
+	cfg.metricsAddr = f.MetricsAddress()
+	cfg.traceFile = f.Trace()
+	var ic *inputConfig
+	f.Check(func() (err error) {
+		ic, err = newInputConfig(*cfg.format, *cfg.delimiter, *cfg.quoting, *cfg.header, *cfg.keyCols, *cfg.valCols, cfg.session.MaxValueLength())
+		return err
+	})
+	if err := f.Parse(args); err != nil {
+		return err
+	}
+
+	if *cfg.nCPU < 0 {
+		*cfg.nCPU = runtime.NumCPU()
+	}
+
+	log.Println("MPPJ Source", *cfg.nodeID)
+
+	ds := newDataSource(*cfg.nodeID, cfg.session.ID, *cfg.rpk, *cfg.norm, *cfg.debugSeed)
+
+	ctx, cancel := common.SignalContext(*cfg.timeout)
+	defer cancel()
+	shutdownTracing := func() error { return nil }
+	if *cfg.traceFile != "" {
+		var err error
+		if shutdownTracing, err = common.StartTracing(*cfg.traceFile, "mppj-source-"+*cfg.nodeID); err != nil {
+			return fmt.Errorf("failed to start tracing: %w", err)
+		}
+	}
+	ctx, span := common.Tracer.Start(ctx, "source.run", trace.WithAttributes(attribute.String("mppj.source", *cfg.nodeID)))
+	err := cfg.run(ctx, ds, ic)
+	mppj.EndSpan(span, err)
+	if err := shutdownTracing(); err != nil {
+		log.Printf("Failed to write the trace: %v", err)
+	}
+	return err
+}
+
+// newDataSource creates the source, with its randomness derived from debugSeed if it is set.
+func newDataSource(nodeID string, sid []byte, rpk mppj.PublicKeyTuple, norm mppj.Normalization, debugSeed string) *mppj.DataSource {
+	ds := mppj.NewDataSourceWithNormalization(sid, rpk, norm)
+	if debugSeed != "" {
+		log.Println("warning: the randomness is derived from the debug seed, the run is insecure")
+		ds.UseRand(mppj.NewSeededRand([]byte(debugSeed + "/" + nodeID)))
+	}
+	return ds
+}
+
+// run prepares and sends the rows to the helper, until ctx is done.
+func (cfg *pushConfig) run(ctx context.Context, ds *mppj.DataSource, ic *inputConfig) (err error) {
+
+	var pool *mppj.EncryptionPool
+	if *cfg.poolPath != "" {
+		pool, err = mppj.OpenEncryptionPool(*cfg.poolPath)
+		if err != nil {
+			return fmt.Errorf("failed to open the pool: %w", err)
+		}
+		defer pool.Close()
+		if err := ds.UsePool(pool); err != nil {
+			return fmt.Errorf("failed to use the pool: %w", err)
+		}
+		blind, value := pool.Remaining()
+		log.Printf("using the pool %s with %d blinding and %d value pairs left", *cfg.poolPath, blind, value)
+	}
+
+	statsHandler := api.NewStatsHandler(mppj.SourceID(*cfg.nodeID))
+	metrics := newSourceMetrics(common.NewMetrics(statsHandler))
+	if *cfg.metricsAddr != "" {
+		if err := common.ServeMetrics(*cfg.metricsAddr, metrics.Metrics); err != nil {
+			return fmt.Errorf("failed to serve the metrics: %w", err)
+		}
+	}
+
+	var table *mppj.TablePlain
+	var es *mppj.ExternalShuffler
+	var nRows int
+	endRead := metrics.StartPhase("read")
+	if *cfg.streamIn {
+		// prepares the rows as they are read and shuffles them on disk
+		es, err = mppj.NewExternalShuffler(*cfg.tmpDir, *cfg.nBuckets)
+		if err != nil {
+			return fmt.Errorf("failed to create shuffler: %w", err)
+		}
+		defer es.Close()
+		if *cfg.debugSeed != "" {
+			es.UseRand(mppj.NewSeededRand([]byte(*cfg.debugSeed + "/" + *cfg.nodeID + "/shuffle")))
+		}
+		log.Printf("preparing rows from %s using %d CPU(s)...", *cfg.input, *cfg.nCPU)
+		if err := prepareFile(ctx, ds, *cfg.input, ic, es, *cfg.nCPU); err != nil {
+			return fmt.Errorf("failed to prepare input file: %w", err)
+		}
+		nRows = es.Len()
+		metrics.rowsPrepared.Add(float64(nRows))
+	} else {
+		table, err = readFile(*cfg.input, ic)
+		if err != nil {
+			return fmt.Errorf("failed to read input file: %w", err)
+		}
+		nRows = len(*table)
+	}
+	endRead()
+
+	if pool != nil && !*cfg.streamIn {
+		if blind, _ := pool.Remaining(); blind < nRows {
+			log.Printf("warning: the pool has pairs for %d of the %d rows, the others are encrypted online", blind, nRows)
+		}
+	}
+
+	start := time.Now()
+
+	// cancelling ctx also cancels the stream, and the preparation below
+	spanName := "source.upload"
+	if *cfg.outFile != "" {
+		spanName = "source.export"
+	}
+	uploadCtx, span := common.Tracer.Start(ctx, spanName, trace.WithAttributes(attribute.Int("mppj.rows", nRows)))
+	defer func() { mppj.EndSpan(span, err) }()
+	tr, err := cfg.transport(statsHandler)
+	if err != nil {
+		return err
+	}
+	defer tr.Close()
+	streamCtx, abortStream := context.WithCancel(uploadCtx)
+	defer abortStream() // aborts the stream if it is not closed, which removes an incomplete output file
+	stream, err := tr.PushRows(api.InjectTraceContext(streamCtx), mppj.SourceID(*cfg.nodeID), nRows)
+	if err != nil {
+		return fmt.Errorf("failed to create stream: %w", err)
+	}
+	send := func(encRows []mppj.EncRow) error {
+		msgs := make([]*pb.EncRow, len(encRows))
+		for i, encRow := range encRows {
+			msg, err := api.GetEncRowMsg(encRow)
+			if err != nil {
+				return err
+			}
+			msgs[i] = msg
+		}
+		return stream.Send(msgs)
+	}
+
+	var encRows iter.Seq2[mppj.EncRow, error]
+	if *cfg.streamIn {
+		log.Printf("sending %d rows...", nRows)
+		encRows = es.Rows()
+	} else {
+		log.Printf("preparing and sending %d rows using %d CPU(s)...", nRows, *cfg.nCPU)
+		prepCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		encRowsChan, wait, err := ds.PrepareStream(prepCtx, *cfg.rpk, *table, *cfg.nCPU)
+		if err != nil {
+			return fmt.Errorf("failed to prepare stream: %w", err)
+		}
+		encRows = func(yield func(mppj.EncRow, error) bool) {
+			defer cancel() // stops the preparation if the sending stops early, but not the stream
+			for encRow := range encRowsChan {
+				metrics.rowsPrepared.Inc()
+				if !yield(encRow, nil) {
+					return
+				}
+			}
+			if err := wait(); err != nil {
+				yield(mppj.EncRow{}, err)
+			}
+		}
+	}
+
+	startActive := time.Now() // measured time from helper connect
+	endSend := metrics.StartPhase("send")
+	defer endSend()
+	batch := make([]mppj.EncRow, 0, *cfg.batchSize)
+	for encRow, err := range encRows {
+		if err != nil {
+			return fmt.Errorf("failed to read prepared row: %w", err)
+		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("failed to send enc rows: %w", context.Cause(ctx))
+		}
+		batch = append(batch, encRow)
+		if len(batch) < *cfg.batchSize {
+			continue
+		}
+		if err := send(batch); err != nil {
+			log.Printf("Failed to send enc rows: %v", err)
+			break
+		}
+		metrics.rowsSent.Add(float64(len(batch)))
+		batch = batch[:0]
+	}
+	if len(batch) > 0 {
+		if err := send(batch); err != nil {
+			log.Printf("Failed to send enc rows: %v", err)
+		} else {
+			metrics.rowsSent.Add(float64(len(batch)))
+		}
+	}
+	if err := stream.Close(); err != nil {
+		return fmt.Errorf("stream resulted in error: %w", err)
+	}
+
+	if *cfg.outFile != "" {
+		log.Printf("done writing %d rows to %s", nRows, *cfg.outFile)
+	} else {
+		log.Printf("done sending %d rows", nRows)
+	}
+	total := time.Since(start)
+	active := time.Since(startActive)
+	common.PrintStats(statsHandler.GetStats(), total, active)
+	return nil
+}
+
+// transport returns the transport to the helper, which writes the rows to the output file if it is set.
+func (cfg *pushConfig) transport(statsHandler stats.Handler) (transport.Transport, error) {
+	if *cfg.outFile != "" {
+		return &transport.Files{
+			SessionID:  cfg.session.ID,
+			Party:      *cfg.nodeID,
+			SigningKey: *cfg.signingKey,
+			SourcePath: *cfg.outFile,
+		}, nil
+	}
+	var opts []grpc.DialOption
+	opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials())) // no TLS for now
+	opts = append(opts, grpc.WithStatsHandler(statsHandler))
+	tr, err := transport.NewGRPC(*cfg.helperAddr, *cfg.batchSize, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to helper: %w", err)
+	}
+	return tr, nil
+}
+
+// readFile reads the input file into a table.
+func readFile(filename string, ic *inputConfig) (*mppj.TablePlain, error) {
+	r, err := open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	table := make(mppj.TablePlain)
+	rows, readErr := ic.rows(r)
+	for key, val := range rows {
+		table[key] = val
+	}
+	if *readErr != nil {
+		return nil, *readErr
+	}
+	return &table, nil
+}
+
+// prepareFile reads the input file row by row and prepares the rows into the shuffler.
+func prepareFile(ctx context.Context, ds *mppj.DataSource, filename string, ic *inputConfig, es *mppj.ExternalShuffler, nCPU int) error {
+	r, err := open(filename)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	rows, readErr := ic.rows(r)
+	if err := ds.PrepareExternal(ctx, rows, es, nCPU); err != nil {
+		return err
+	}
+	return *readErr
+}
@@ -13,8 +13,6 @@ import (
 	"errors"
 	"fmt"
 	"sync"
-
-	"golang.org/x/crypto/blake2b"
 )
 
 var curve = elliptic.P256()
@@ -93,9 +91,20 @@ func unpad(data []byte) ([]byte, error) {
 
 // *********************** PKE ************************
 
+// precomputedPK returns pk as a public key with a fixed-base table, as public keys are exponentiated in every
+// encryption and re-randomization. If the table cannot be computed, the key is returned as is.
+func precomputedPK(pk *Point) *PublicKey {
+	_ = pk.Precompute()
+	return (*PublicKey)(pk)
+}
+
 // PKEEncrypt encrypts a message msg using the public key pk.
 func PKEEncrypt(pk *PublicKey, msg *Message) *Ciphertext {
-	r := RandomScalar()
+	return pkeEncrypt(pk, msg, secureRand)
+}
+
+func pkeEncrypt(pk *PublicKey, msg *Message, rnd *Rand) *Ciphertext {
+	r := rnd.Scalar()
 
 	c0 := BaseExp(r)
 	c1 := Mul(&msg.m, (*Point)(pk).ScalarExp(r))
@@ -109,6 +118,11 @@ func PKEEncrypt(pk *PublicKey, msg *Message) *Ciphertext {
 
 // PKEEncryptVector encrypts a byte slice PAYLOADSIZE bytes at a time using the public key pk. ( due to the 256-bit curve)
 func PKEEncryptVector(pk *PublicKey, msg []byte) ([]*Ciphertext, error) {
+	return pkeEncryptVector(msg, func(m *Message) (*Ciphertext, error) { return PKEEncrypt(pk, m), nil })
+}
+
+// pkeEncryptVector splits msg into messages as PKEEncryptVector, and encrypts them with encrypt.
+func pkeEncryptVector(msg []byte, encrypt func(*Message) (*Ciphertext, error)) ([]*Ciphertext, error) {
 
 	ciphertexts := make([]*Ciphertext, len(pad(msg, PAYLOADSIZE))/PAYLOADSIZE)
 	msg_padded := pad(msg, PAYLOADSIZE)
@@ -123,7 +137,10 @@ func PKEEncryptVector(pk *PublicKey, msg []byte) ([]*Ciphertext, error) {
 		if err != nil {
 			return nil, err
 		}
-		ciphertexts[idx] = PKEEncrypt(pk, msg)
+		ciphertexts[idx], err = encrypt(msg)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	return ciphertexts, nil
@@ -180,7 +197,11 @@ func PKEDecryptVector(sk *SecretKey, ciphertexts []*Ciphertext) ([]byte, error)
 
 // ReRand re-randomizes a ciphertext using pk.
 func ReRand(pk *PublicKey, ciphertext *Ciphertext) *Ciphertext {
-	r := RandomScalar()
+	return reRand(pk, ciphertext, secureRand)
+}
+
+func reRand(pk *PublicKey, ciphertext *Ciphertext, rnd *Rand) *Ciphertext {
+	r := rnd.Scalar()
 
 	c0 := Mul(ciphertext.c0, BaseExp(r))
 	c1 := Mul(ciphertext.c1, (*Point)(pk).ScalarExp(r))
@@ -194,13 +215,18 @@ func ReRand(pk *PublicKey, ciphertext *Ciphertext) *Ciphertext {
 
 // ReRandVector re-randomizes a slice of ciphertexts using pk.
 func ReRandVector(pk *PublicKey, ciphertexts []*Ciphertext) []*Ciphertext {
+	return reRandVector(pk, ciphertexts, secureRand)
+}
+
+func reRandVector(pk *PublicKey, ciphertexts []*Ciphertext, rnd *Rand) []*Ciphertext {
 	ciphertextsout := make([]*Ciphertext, len(ciphertexts))
+	streams := rnd.split()
 	var wg sync.WaitGroup
 	for i, ct := range ciphertexts {
 		wg.Add(1)
 		go func(i int, ct *Ciphertext) {
 			defer wg.Done()
-			ciphertextsout[i] = ReRand(pk, ct)
+			ciphertextsout[i] = reRand(pk, ct, streams(i))
 		}(i, ct)
 	}
 	wg.Wait()
@@ -209,10 +235,96 @@ func ReRandVector(pk *PublicKey, ciphertexts []*Ciphertext) []*Ciphertext {
 
 // PKEKeyGen generates a new public/private key pair. (scalar, point)
 func PKEKeyGen() (*SecretKey, *PublicKey) {
-	sk := RandomScalar()
+	return pkeKeyGen(secureRand)
+}
+
+func pkeKeyGen(rnd *Rand) (*SecretKey, *PublicKey) {
+	sk := rnd.Scalar()
 
 	pk := BaseExp(sk)
-	return (*SecretKey)(sk.Neg()), (*PublicKey)(pk) // Negate the scalar for efficiency
+	return (*SecretKey)(sk.Neg()), precomputedPK(pk) // Negate the scalar for efficiency
+}
+
+// ReceiverKeyGen generates a new key pair for the receiver, for NewReceiverWithKeys. The public keys are
+// distributed to the sources and the helper.
+func ReceiverKeyGen() (SecretKeyTuple, PublicKeyTuple) {
+	bsk, bpk := PKEKeyGen()
+	esk, epk := PKEKeyGen()
+	return SecretKeyTuple{bsk: bsk, esk: esk}, PublicKeyTuple{bpk: bpk, epk: epk}
+}
+
+// PublicKey returns the public keys of the secret keys.
+func (skt SecretKeyTuple) PublicKey() PublicKeyTuple {
+	return PublicKeyTuple{
+		bpk: precomputedPK(BaseExp((*Scalar)(skt.bsk).Neg())), // the secret keys are stored negated
+		epk: precomputedPK(BaseExp((*Scalar)(skt.esk).Neg())),
+	}
+}
+
+// MarshalBinary serializes the public keys as two compressed points.
+func (pkt PublicKeyTuple) MarshalBinary() ([]byte, error) {
+	if pkt.bpk == nil || pkt.epk == nil {
+		return nil, errors.New("missing public key")
+	}
+	bpk, err := (*Point)(pkt.bpk).MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	epk, err := (*Point)(pkt.epk).MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return append(bpk, epk...), nil
+}
+
+// UnmarshalBinary deserializes public keys serialized with MarshalBinary.
+func (pkt *PublicKeyTuple) UnmarshalBinary(data []byte) error {
+	pointLen := int(group.Params().CompressedElementLength)
+	if len(data) != 2*pointLen {
+		return fmt.Errorf("invalid public keys: expected %d bytes, got %d", 2*pointLen, len(data))
+	}
+	bpk, epk := NewPoint(), NewPoint()
+	if err := bpk.UnmarshalBinary(data[:pointLen]); err != nil {
+		return fmt.Errorf("invalid public keys: %w", err)
+	}
+	if err := epk.UnmarshalBinary(data[pointLen:]); err != nil {
+		return fmt.Errorf("invalid public keys: %w", err)
+	}
+	pkt.bpk, pkt.epk = precomputedPK(bpk), precomputedPK(epk)
+	return nil
+}
+
+// MarshalBinary serializes the secret keys as two scalars.
+func (skt SecretKeyTuple) MarshalBinary() ([]byte, error) {
+	if skt.bsk == nil || skt.esk == nil {
+		return nil, errors.New("missing secret key")
+	}
+	bsk, err := skt.bsk.s.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	esk, err := skt.esk.s.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return append(bsk, esk...), nil
+}
+
+// UnmarshalBinary deserializes secret keys serialized with MarshalBinary.
+func (skt *SecretKeyTuple) UnmarshalBinary(data []byte) error {
+	scalarLen := int(group.Params().ScalarLength)
+	if len(data) != 2*scalarLen {
+		return fmt.Errorf("invalid secret keys: expected %d bytes, got %d", 2*scalarLen, len(data))
+	}
+	bsk, esk := NewScalarEmpty(), NewScalarEmpty()
+	if err := bsk.s.UnmarshalBinary(data[:scalarLen]); err != nil {
+		return fmt.Errorf("invalid secret keys: %w", err)
+	}
+	if err := esk.s.UnmarshalBinary(data[scalarLen:]); err != nil {
+		return fmt.Errorf("invalid secret keys: %w", err)
+	}
+	skt.bsk, skt.esk = (*SecretKey)(bsk), (*SecretKey)(esk)
+	return nil
 }
 
 // Serialize serializes a Ciphertext into a byte slice.
@@ -229,6 +341,36 @@ func (ct *Ciphertext) Serialize() ([]byte, error) {
 	return append(c0Bytes, c1Bytes...), nil
 }
 
+// SerializePoints serializes the two points of a Ciphertext separately.
+func (ct *Ciphertext) SerializePoints() (c0, c1 []byte, err error) {
+	c0, err = ct.c0.MarshalBinary()
+	if err != nil {
+		return nil, nil, err
+	}
+	c1, err = ct.c1.MarshalBinary()
+	if err != nil {
+		return nil, nil, err
+	}
+	return c0, c1, nil
+}
+
+// DeserializeCiphertextPoints deserializes a Ciphertext from its two serialized points.
+func DeserializeCiphertextPoints(c0, c1 []byte) (*Ciphertext, error) {
+	byteLen := int(group.Params().CompressedElementLength)
+	if len(c0) != byteLen || len(c1) != byteLen {
+		return nil, fmt.Errorf("invalid point lengths %d and %d, expected %d", len(c0), len(c1), byteLen)
+	}
+
+	ct := &Ciphertext{c0: NewPoint(), c1: NewPoint()}
+	if err := ct.c0.UnmarshalBinary(c0); err != nil {
+		return nil, err
+	}
+	if err := ct.c1.UnmarshalBinary(c1); err != nil {
+		return nil, err
+	}
+	return ct, nil
+}
+
 func SerializeCiphertexts(cts []*Ciphertext) ([]byte, error) {
 	serialized := make([]byte, 0)
 	for _, ct := range cts {
@@ -423,7 +565,11 @@ func HashToMessage(msg, sid []byte) *Message {
 
 // RandomKeyFromPoint generates a random 16-byte key from a random point on the curve
 func RandomKeyFromPoint(sid []byte) (*Point, []byte) {
-	rp := RandomPoint()
+	return randomKeyFromPoint(sid, secureRand)
+}
+
+func randomKeyFromPoint(sid []byte, rnd *Rand) (*Point, []byte) {
+	rp := rnd.Point()
 
 	key, err := KeyFromPoint(rp, sid)
 	if err != nil {
@@ -477,15 +623,11 @@ func SymmetricDecrypt(key []byte, ciphertext SymmetricCiphertext) ([]byte, error
 // Generates keys *deterministically* from a seed
 func GetTestKeys(seed []byte) (SecretKeyTuple, PublicKeyTuple) {
 
-	xof, err := blake2b.NewXOF(blake2b.OutputLengthUnknown, seed)
-	if err != nil {
-		panic(err)
-	}
-
-	esk := &Scalar{s: group.RandomScalar(xof)}
-	bsk := &Scalar{s: group.RandomScalar(xof)}
+	rnd := NewSeededRand(seed)
+	esk := rnd.Scalar()
+	bsk := rnd.Scalar()
 	rsk := SecretKeyTuple{esk: (*SecretKey)(esk.Neg()), bsk: (*SecretKey)(bsk.Neg())}
-	rpk := PublicKeyTuple{epk: (*PublicKey)(BaseExp(esk)), bpk: (*PublicKey)(BaseExp(bsk))}
+	rpk := PublicKeyTuple{epk: precomputedPK(BaseExp(esk)), bpk: precomputedPK(BaseExp(bsk))}
 
 	return rsk, rpk
 }
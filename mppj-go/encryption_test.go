@@ -458,3 +458,40 @@ func TestPKEEncKeys(t *testing.T) {
 		}
 	}
 }
+
+func TestSerializeReceiverKeys(t *testing.T) {
+	rsk, rpk := ReceiverKeyGen()
+
+	pkData, err := rpk.MarshalBinary()
+	require.NoError(t, err)
+	var rpk2 PublicKeyTuple
+	require.NoError(t, rpk2.UnmarshalBinary(pkData))
+	pkData2, err := rsk.PublicKey().MarshalBinary()
+	require.NoError(t, err)
+	require.Equal(t, pkData, pkData2)
+
+	skData, err := rsk.MarshalBinary()
+	require.NoError(t, err)
+	var rsk2 SecretKeyTuple
+	require.NoError(t, rsk2.UnmarshalBinary(skData))
+
+	// the deserialized keys are usable for a join
+	sourceIDs := []SourceID{"ds1", "ds2"}
+	sid := NewSessionID(2, "helper", "receiver", sourceIDs)
+	tables := GenTestTables(sourceIDs, 10, 5)
+	encTables := make(map[SourceID]EncTable)
+	for _, sourceID := range sourceIDs {
+		encTable, err := NewDataSource(sid, rpk2).Prepare(rpk2, tables[sourceID])
+		require.NoError(t, err)
+		encTables[sourceID] = encTable
+	}
+	converted, err := NewHelper(sid, sourceIDs, 10).Convert(rpk2, encTables)
+	require.NoError(t, err)
+	join, err := NewReceiverWithKeys(sid, sourceIDs, rsk2, rpk2).JoinTables(converted, len(sourceIDs))
+	require.NoError(t, err)
+	joinPlain := IntersectSimple(tables, sourceIDs)
+	require.True(t, joinPlain.EqualContents(&join))
+
+	require.Error(t, rpk2.UnmarshalBinary(pkData[1:]))
+	require.Error(t, rsk2.UnmarshalBinary(skData[1:]))
+}
@@ -0,0 +1,24 @@
+package mppj
+
+import "errors"
+
+// The errors returned by the parties on invalid inputs. They are wrapped with more context, and can be
+// tested with errors.Is.
+var (
+	// ErrTooManyRows is returned when the helper receives more rows than it expects.
+	ErrTooManyRows = errors.New("more rows than expected")
+	// ErrTooFewRows is returned when the helper's input ends before it received the rows it expects.
+	ErrTooFewRows = errors.New("fewer rows than expected")
+	// ErrInvalidRow is returned for encrypted rows with missing ciphertexts.
+	ErrInvalidRow = errors.New("invalid row")
+	// ErrInvalidSourceIndex is returned for rows with a source index that does not match any source.
+	ErrInvalidSourceIndex = errors.New("invalid source index")
+	// ErrDuplicateKey is returned when a source has several rows with the same join key, by the source which
+	// prepares them. The receiver skips their groups, and counts them (see JoinTable.Skipped).
+	ErrDuplicateKey = errors.New("duplicate join key")
+	// ErrDecryption is returned by the receiver for rows which cannot be decrypted, e.g., because they
+	// were not produced by the protocol or were tampered with.
+	ErrDecryption = errors.New("decryption failed")
+	// ErrInvalidManifest is returned for session manifests with missing or inconsistent parameters.
+	ErrInvalidManifest = errors.New("invalid session manifest")
+)
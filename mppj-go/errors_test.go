@@ -0,0 +1,261 @@
+package mppj
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHelperErrors(t *testing.T) {
+
+	sourceIDs := []SourceID{"ds1", "ds2"}
+
+	sid := NewSessionID(2, "helper", "receiver", sourceIDs)
+
+	receiver := NewReceiver(sid, sourceIDs)
+	ds := NewDataSource(sid, receiver.GetPK())
+
+	cuid, cval, err := ds.ProcessRow("uid", "val")
+	require.NoError(t, err)
+	row := EncRow{Cuid: cuid, Cval: cval}
+
+	convert := func(tasks ...ConvertRowTask) error {
+		helper := NewHelper(sid, sourceIDs, 1)
+		in := make(chan ConvertRowTask)
+		go func() {
+			for _, task := range tasks {
+				in <- task
+			}
+			close(in)
+		}()
+		_, err := helper.ConvertTablesStream(context.Background(), receiver.GetPK(), in)
+		return err
+	}
+
+	require.NoError(t, convert(ConvertRowTask{row, 0}, ConvertRowTask{row, 1}))
+	require.ErrorIs(t, convert(ConvertRowTask{row, 0}, ConvertRowTask{row, 1}, ConvertRowTask{row, 1}, ConvertRowTask{row, 0}), ErrTooManyRows)
+	require.ErrorIs(t, convert(ConvertRowTask{row, 0}), ErrTooFewRows)
+	require.ErrorIs(t, convert(ConvertRowTask{row, 0}, ConvertRowTask{row, 2}), ErrInvalidSourceIndex)
+	require.ErrorIs(t, convert(ConvertRowTask{row, 0}, ConvertRowTask{EncRow{Cuid: cuid}, 1}), ErrInvalidRow)
+}
+
+func TestReceiverErrors(t *testing.T) {
+
+	sourceIDs := []SourceID{"ds1", "ds2", "ds3"}
+
+	sid := NewSessionID(3, "helper", "receiver", sourceIDs)
+
+	helper := NewHelper(sid, sourceIDs, ROW_AMOUNT)
+	receiver := NewReceiver(sid, sourceIDs)
+	ds := NewDataSource(sid, receiver.GetPK())
+
+	tables := GenTestTables(sourceIDs, ROW_AMOUNT, INTERSECTION_SIZE)
+	encTables := make(map[SourceID]EncTable, TABLE_AMOUNT)
+	for sourceID, table := range tables {
+		prepTable, err := ds.Prepare(receiver.GetPK(), table)
+		require.NoError(t, err)
+		encTables[sourceID] = prepTable
+	}
+	joinedTables, err := helper.Convert(receiver.GetPK(), encTables)
+	require.NoError(t, err)
+
+	tamper := func(f func(row *EncRowWithHint)) EncTableWithHint {
+		tampered := make(EncTableWithHint, len(joinedTables))
+		for i, row := range joinedTables {
+			row.CVal = append(SymmetricCiphertext(nil), row.CVal...)
+			f(&row)
+			tampered[i] = row
+		}
+		return tampered
+	}
+
+	// the source index is the first byte of the (malleable) value ciphertext
+	_, err = receiver.JoinTables(tamper(func(row *EncRowWithHint) { row.CVal[0] ^= 0x80 }), len(encTables))
+	require.ErrorIs(t, err, ErrInvalidSourceIndex)
+
+	_, err = receiver.JoinTables(tamper(func(row *EncRowWithHint) { row.CVal = nil }), len(encTables))
+	require.ErrorIs(t, err, ErrDecryption)
+
+	// the receiver can still join the valid rows afterwards
+	_, err = receiver.JoinTables(joinedTables, len(encTables))
+	require.NoError(t, err)
+}
+
+func TestReceiverDuplicateKey(t *testing.T) {
+
+	sourceIDs := []SourceID{"ds1", "ds2", "ds3"}
+
+	sid := NewSessionID(3, "helper", "receiver", sourceIDs)
+
+	receiver := NewReceiver(sid, sourceIDs)
+	ds := NewDataSource(sid, receiver.GetPK())
+
+	convert := func(keys map[SourceID][]string) EncTableWithHint {
+		encTables := make(map[SourceID]EncTable, len(keys))
+		for sourceID, uids := range keys {
+			for _, uid := range uids {
+				cuid, cval, err := ds.ProcessRow(uid, string(sourceID)+"-"+uid)
+				require.NoError(t, err)
+				encTables[sourceID] = append(encTables[sourceID], EncRow{Cuid: cuid, Cval: cval})
+			}
+		}
+		joinedTables, err := NewHelper(sid, sourceIDs, 3).Convert(receiver.GetPK(), encTables)
+		require.NoError(t, err)
+		return joinedTables
+	}
+
+	expected := NewJoinTable(sourceIDs)
+	require.NoError(t, expected.Insert(map[SourceID]string{"ds1": "ds1-uid", "ds2": "ds2-uid", "ds3": "ds3-uid"}))
+	// the row of the group, if it was written before a further row of the group was received
+	expectedWithDup := NewJoinTable(sourceIDs)
+	require.NoError(t, expectedWithDup.Insert(map[SourceID]string{"ds1": "ds1-uid", "ds2": "ds2-uid", "ds3": "ds3-uid"}))
+	require.NoError(t, expectedWithDup.Insert(map[SourceID]string{"ds1": "ds1-dup", "ds2": "ds2-dup", "ds3": "ds3-dup"}))
+
+	// ds1 has two rows with the key "dup", which form a complete group with the row of ds2
+	joinedTables := convert(map[SourceID][]string{
+		"ds1": {"dup", "dup", "uid"},
+		"ds2": {"dup", "uid", "ds2"},
+		"ds3": {"uid", "ds3", "ds3bis"},
+	})
+
+	// the group is skipped, and the other rows are joined
+	join, err := receiver.JoinTables(joinedTables, len(sourceIDs))
+	require.NoError(t, err)
+	require.Equal(t, 1, join.Skipped())
+	require.True(t, expected.EqualContents(&join), "expected:\n%v\ngot:\n%v", expected, join)
+
+	encrows := make(chan EncRowWithHint, len(joinedTables))
+	for _, row := range joinedTables {
+		encrows <- row
+	}
+	close(encrows)
+	join = NewJoinTable(sourceIDs)
+	n, skipped, err := receiver.JoinTablesStreamToExternal(context.Background(), encrows, &join, t.TempDir(), 2)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	require.Equal(t, 1, skipped)
+	require.True(t, expected.EqualContents(&join), "expected:\n%v\ngot:\n%v", expected, join)
+
+	// every source has a row with the key "dup", and ds1 a further one: depending on the order of the rows, the
+	// group is skipped, or its row is written before the further row is received, but the group is reported
+	joinedTables = convert(map[SourceID][]string{
+		"ds1": {"dup", "dup", "uid"},
+		"ds2": {"dup", "uid", "ds2"},
+		"ds3": {"dup", "uid", "ds3"},
+	})
+	for range 10 {
+		rand.Shuffle(len(joinedTables), func(i, j int) { joinedTables[i], joinedTables[j] = joinedTables[j], joinedTables[i] })
+		join, err := receiver.JoinTables(joinedTables, len(sourceIDs))
+		require.NoError(t, err)
+		require.Equal(t, 1, join.Skipped())
+		require.True(t, expected.EqualContents(&join) || expectedWithDup.EqualContents(&join), "unexpected join:\n%v", join)
+	}
+
+	// the external join groups all the rows before decrypting them, and skips the group of four rows
+	encrows = make(chan EncRowWithHint, len(joinedTables))
+	for _, row := range joinedTables {
+		encrows <- row
+	}
+	close(encrows)
+	join = NewJoinTable(sourceIDs)
+	n, skipped, err = receiver.JoinTablesStreamToExternal(context.Background(), encrows, &join, t.TempDir(), 2)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	require.Equal(t, 1, skipped)
+	require.True(t, expected.EqualContents(&join), "expected:\n%v\ngot:\n%v", expected, join)
+}
+
+func TestPrepareStreamErrors(t *testing.T) {
+
+	sourceIDs := []SourceID{"ds1", "ds2"}
+
+	sid := NewSessionID(2, "helper", "receiver", sourceIDs)
+
+	receiver := NewReceiver(sid, sourceIDs)
+	tables := GenTestTables(sourceIDs, ROW_AMOUNT, INTERSECTION_SIZE)
+
+	t.Run("worker error", func(t *testing.T) {
+		// a closed pool makes every row fail
+		ds := NewDataSource(sid, receiver.GetPK())
+		path := filepath.Join(t.TempDir(), "ds.pool")
+		require.NoError(t, ds.Precompute(path, ROW_AMOUNT, 30))
+		pool, err := OpenEncryptionPool(path)
+		require.NoError(t, err)
+		require.NoError(t, ds.UsePool(pool))
+		require.NoError(t, pool.Close())
+
+		encRows, wait, err := ds.PrepareStream(context.Background(), receiver.GetPK(), tables["ds1"], 4)
+		require.NoError(t, err)
+		for range encRows {
+		}
+		require.ErrorIs(t, wait(), os.ErrClosed)
+
+		_, err = ds.Prepare(receiver.GetPK(), tables["ds1"])
+		require.ErrorIs(t, err, os.ErrClosed)
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		ds := NewDataSource(sid, receiver.GetPK())
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		encRows, wait, err := ds.PrepareStream(ctx, receiver.GetPK(), tables["ds1"], 4)
+		require.NoError(t, err)
+		require.ErrorIs(t, wait(), context.Canceled)
+		for range encRows {
+		}
+	})
+}
+
+func TestCancellation(t *testing.T) {
+
+	sourceIDs := []SourceID{"ds1", "ds2"}
+
+	sid := NewSessionID(2, "helper", "receiver", sourceIDs)
+
+	receiver := NewReceiver(sid, sourceIDs)
+	ds := NewDataSource(sid, receiver.GetPK())
+
+	cuid, cval, err := ds.ProcessRow("uid", "val")
+	require.NoError(t, err)
+
+	// the inputs are never closed, so the calls only return because of the cancellation
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	t.Run("helper", func(t *testing.T) {
+		helper := NewHelper(sid, sourceIDs, 1)
+		in := make(chan ConvertRowTask, 1)
+		in <- ConvertRowTask{EncRow{Cuid: cuid, Cval: cval}, 0}
+		_, err := helper.ConvertTablesStream(ctx, receiver.GetPK(), in)
+		require.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("receiver", func(t *testing.T) {
+		join := NewJoinTable(sourceIDs)
+		_, _, err := receiver.JoinTablesStreamTo(ctx, make(chan EncRowWithHint), &join)
+		require.ErrorIs(t, err, context.Canceled)
+		_, _, err = receiver.JoinTablesStreamToExternal(ctx, make(chan EncRowWithHint), &join, t.TempDir(), 2)
+		require.ErrorIs(t, err, context.Canceled)
+		_, err = receiver.JoinTablesMultiKeyStream(ctx, make(chan EncRowMultiKeyWithHint))
+		require.ErrorIs(t, err, context.Canceled)
+	})
+
+	t.Run("source", func(t *testing.T) {
+		es, err := NewExternalShuffler(t.TempDir(), 2)
+		require.NoError(t, err)
+		defer es.Close()
+		rows := func(yield func(string, string) bool) {
+			for i := 0; ; i++ {
+				if !yield(fmt.Sprintf("uid%d", i), "val") {
+					return
+				}
+			}
+		}
+		require.ErrorIs(t, ds.PrepareExternal(ctx, rows, es), context.Canceled)
+	})
+}
@@ -0,0 +1,112 @@
+// This provides precomputed tables for the exponentiation of fixed bases, i.e., the receiver's public keys,
+// which are raised to a fresh random scalar in every PKEEncrypt and ReRand.
+package mppj
+
+import (
+	"errors"
+	"math/bits"
+
+	"filippo.io/nistec"
+)
+
+const (
+	fixedBaseWindow  = 6                                                 // the bits per digit of the scalar
+	fixedBaseDigits  = (256 + 1 + fixedBaseWindow - 1) / fixedBaseWindow // one more bit for the carry of the signed digits
+	fixedBaseEntries = 1 << (fixedBaseWindow - 1)                        // the absolute values of the non-zero digits
+)
+
+// fixedBaseTable holds the multiples j * 2^(w*i) * P of a base P, for j in [1, 2^(w-1)] and each digit i of a
+// scalar. An exponentiation is then a sum of one table entry per digit, without doublings. The entries are
+// selected in constant time. The generator does not need a table, as the standard library already has one.
+type fixedBaseTable [fixedBaseDigits][fixedBaseEntries]nistec.P256Point
+
+// newFixedBaseTable computes the table of the base p, which takes about as long as 30 exponentiations.
+func newFixedBaseTable(p *Point) (*fixedBaseTable, error) {
+	data, err := p.p.MarshalBinary() // uncompressed
+	if err != nil {
+		return nil, err
+	}
+	base, err := nistec.NewP256Point().SetBytes(data)
+	if err != nil {
+		return nil, err
+	}
+
+	t := new(fixedBaseTable)
+	for i := range t {
+		t[i][0].Set(base)
+		for j := 1; j < fixedBaseEntries; j++ {
+			t[i][j].Add(&t[i][j-1], base)
+		}
+		for range fixedBaseWindow {
+			base.Double(base)
+		}
+	}
+	return t, nil
+}
+
+// exp computes p^s, where p is the base of the table.
+func (t *fixedBaseTable) exp(s *Scalar) (*Point, error) {
+	scalar, err := s.s.MarshalBinary() // big-endian, reduced
+	if err != nil {
+		return nil, err
+	}
+	if len(scalar) != 32 {
+		return nil, errors.New("invalid scalar length")
+	}
+
+	res := nistec.NewP256Point()
+	entry, neg := nistec.NewP256Point(), nistec.NewP256Point()
+	for i, digit := range signedDigits(scalar) {
+		abs, isNeg := absDigit(digit)
+		entry.Set(nistec.NewP256Point()) // the identity, for digit 0
+		for j := range fixedBaseEntries {
+			entry.Select(&t[i][j], entry, equalDigit(abs, j+1))
+		}
+		neg.Negate(entry)
+		entry.Select(neg, entry, isNeg)
+		res.Add(res, entry)
+	}
+
+	e := group.NewElement()
+	if err := e.UnmarshalBinary(res.Bytes()); err != nil {
+		return nil, err
+	}
+	return &Point{p: e}, nil
+}
+
+// signedDigits recodes a 256-bit big-endian scalar into digits in [-2^(w-1), 2^(w-1)], least significant first,
+// in constant time.
+func signedDigits(scalar []byte) [fixedBaseDigits]int {
+	var digits [fixedBaseDigits]int
+	carry := 0
+	for i := range digits {
+		d := windowBits(scalar, i*fixedBaseWindow) + carry
+		carry = (d + fixedBaseEntries) >> fixedBaseWindow // 1 iff d >= 2^(w-1)
+		digits[i] = d - carry<<fixedBaseWindow
+	}
+	return digits
+}
+
+// windowBits returns the w bits of the big-endian scalar starting at bit offset.
+func windowBits(scalar []byte, offset int) int {
+	var v int
+	for b := offset + fixedBaseWindow - 1; b >= offset; b-- {
+		v <<= 1
+		if byteIndex := len(scalar) - 1 - b/8; byteIndex >= 0 {
+			v |= int(scalar[byteIndex]>>(b%8)) & 1
+		}
+	}
+	return v
+}
+
+// absDigit returns the absolute value of d and 1 if d is negative, in constant time.
+func absDigit(d int) (int, int) {
+	sign := d >> (bits.UintSize - 1) // all ones iff negative
+	return (d ^ sign) - sign, sign & 1
+}
+
+// equalDigit returns 1 if a == b and 0 otherwise, in constant time. Both must be non-negative.
+func equalDigit(a, b int) int {
+	x := uint(a ^ b)
+	return int(((x - 1) &^ x) >> (bits.UintSize - 1))
+}
@@ -0,0 +1,53 @@
+package mppj
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestFixedBaseExp(t *testing.T) {
+	base := RandomPoint()
+	table, err := newFixedBaseTable(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	orderMinusOne := new(big.Int).Sub(curve.Params().N, big.NewInt(1))
+	scalars := []*Scalar{NewScalar(big.NewInt(0)), NewScalar(big.NewInt(1)), NewScalar(big.NewInt(32)), NewScalar(big.NewInt(33)), NewScalar(orderMinusOne)}
+	for range 50 {
+		scalars = append(scalars, RandomScalar())
+	}
+
+	for _, s := range scalars {
+		got, err := table.exp(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := base.ScalarExp(s); !got.Equals(want) {
+			t.Errorf("wrong exponentiation for scalar %v: got %v, want %v", s.s, got, want)
+		}
+	}
+}
+
+func TestPrecomputedKeys(t *testing.T) {
+	sk, pk := PKEKeyGen()
+	if (*Point)(pk).table == nil {
+		t.Fatal("expected a precomputed public key")
+	}
+
+	msg, err := RandomMsg()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ct := ReRand(pk, PKEEncrypt(pk, msg))
+	if !PKEDecrypt(sk, ct).Equals(msg) {
+		t.Errorf("decryption with a precomputed key failed")
+	}
+
+	var p Point
+	p.p = group.NewElement()
+	data, _ := (*Point)(pk).MarshalBinary()
+	if err := p.UnmarshalBinary(data); err != nil || p.table != nil {
+		t.Errorf("unmarshalled point should not have a table")
+	}
+}
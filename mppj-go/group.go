@@ -3,7 +3,7 @@
 package mppj
 
 import (
-	"crypto/rand"
+	"encoding/hex"
 	"math/big"
 
 	circl "github.com/cloudflare/circl/group"
@@ -11,6 +11,9 @@ import (
 
 var group = circl.P256
 
+// GroupName is the name of the group, as declared in the session manifests.
+const GroupName = "P-256"
+
 // Scalar represents a scalar value modulo the curve's order
 type Scalar struct {
 	s circl.Scalar
@@ -18,7 +21,8 @@ type Scalar struct {
 
 // Point represents a point on the elliptic curve.
 type Point struct {
-	p circl.Element
+	p     circl.Element
+	table *fixedBaseTable // optional, speeds up ScalarExp for fixed bases
 }
 
 // SerializePoint serializes a Point into a byte slice.
@@ -29,10 +33,17 @@ func (p *Point) MarshalBinary() ([]byte, error) {
 
 // DeserializePoint deserializes a byte slice into a Point.
 func (p *Point) UnmarshalBinary(data []byte) error {
+	p.table = nil
 	err := p.p.UnmarshalBinary(data)
 	return err
 }
 
+// String returns the hexadecimal encoding of the compressed point.
+func (p *Point) String() string {
+	pb, _ := p.MarshalBinary()
+	return hex.EncodeToString(pb)
+}
+
 // NewPoint creates a new Point with coordinates (x, y) modulo the curve's prime P.
 func NewPoint() *Point {
 	return &Point{p: group.NewElement()}
@@ -45,6 +56,19 @@ func (a *Point) Equals(b *Point) bool {
 
 }
 
+// distinctPoints returns whether the points are pairwise distinct.
+func distinctPoints(points []*Point) bool {
+	seen := make(map[string]bool, len(points))
+	for _, p := range points {
+		pb, err := p.MarshalBinary()
+		if err != nil || seen[string(pb)] {
+			return false
+		}
+		seen[string(pb)] = true
+	}
+	return true
+}
+
 // Gen returns the generator of the elliptic curve.
 func Gen() *Point {
 	return &Point{p: group.Generator()}
@@ -82,11 +106,27 @@ func (a *Point) Invert() *Point {
 	return &Point{p: a.p.Copy().Neg(a.p)}
 }
 
-// ScalarExp exponentiates a point a by a scalar b on the elliptic curve.
+// ScalarExp exponentiates a point a by a scalar b on the elliptic curve. It uses the precomputed table of a, if any.
 func (a *Point) ScalarExp(b *Scalar) *Point {
+	if a.table != nil {
+		if res, err := a.table.exp(b); err == nil {
+			return res
+		}
+	}
 	return &Point{p: a.p.Copy().Mul(a.p, b.s)}
 }
 
+// Precompute computes a table which speeds up the subsequent exponentiations of a, for points which are
+// exponentiated many times, such as public keys. It must not be called concurrently with the use of a.
+func (a *Point) Precompute() error {
+	t, err := newFixedBaseTable(a)
+	if err != nil {
+		return err
+	}
+	a.table = t
+	return nil
+}
+
 // InvertScalar returns the multiplicative inverse of a scalar.
 func (s *Scalar) Invert() *Scalar {
 	return &Scalar{s: s.s.Copy().Inv(s.s)}
@@ -94,8 +134,7 @@ func (s *Scalar) Invert() *Scalar {
 
 // produces a unifromly random point on the curve
 func RandomPoint() *Point {
-	s := group.RandomScalar(rand.Reader)
-	return &Point{p: group.NewElement().MulGen(s)} // faster than  group.RandomElement(rand.Reader)
+	return secureRand.Point()
 }
 
 // NewScalar creates a new scalar from value.
@@ -132,10 +171,7 @@ func (a *Scalar) Copy() *Scalar {
 
 // RandomScalar creates a new random scalar.
 func RandomScalar() *Scalar {
-
-	return &Scalar{
-		s: group.RandomScalar(rand.Reader),
-	}
+	return secureRand.Scalar()
 }
 
 // HashToPoint hashes a byte slice to a scalar. See hash to field/group RFC
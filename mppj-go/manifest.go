@@ -0,0 +1,241 @@
+// This provides the session manifest, which declares the parameters of a session in a file shared by all the
+// parties. The session ID is derived from the hash of the manifest, so that parties which do not agree on
+// every parameter cannot join each other's rows.
+package mppj
+
+import (
+	"crypto/ed25519"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+)
+
+// ManifestVersion is the version of the manifests written by this package.
+const ManifestVersion = 1
+
+// JoinInner is the join mode of the protocol, which outputs the keys that are in the tables of all sources.
+const JoinInner = "inner"
+
+// Role is the role of a party in a session.
+type Role string
+
+const (
+	RoleSource   Role = "source"
+	RoleHelper   Role = "helper"
+	RoleReceiver Role = "receiver"
+)
+
+// Party is a participant of a session.
+type Party struct {
+	ID         string `json:"id"`
+	Role       Role   `json:"role"`
+	Address    string `json:"address,omitempty"`     // the endpoint of the helper
+	PublicKey  []byte `json:"public_key,omitempty"`  // the receiver's public keys, see PublicKeyTuple.MarshalBinary
+	SigningKey []byte `json:"signing_key,omitempty"` // the Ed25519 public key of the party's files, if any
+}
+
+// JoinSpec is how the sources' tables are joined.
+type JoinSpec struct {
+	Mode      string `json:"mode"`
+	Normalize string `json:"normalize,omitempty"` // the join key normalization, see ParseNormalization
+}
+
+// ValueSchema describes the values of the sources' rows.
+type ValueSchema struct {
+	MaxLength int                 `json:"max_length"`      // in bytes, which sets the number of value ciphertexts
+	Types     map[SourceID]string `json:"types,omitempty"` // the types of the values in the output, per source
+}
+
+// Limits sets the size of the session.
+type Limits struct {
+	RowsPerSource int `json:"rows_per_source"` // the number of rows the helper expects from each source
+}
+
+// Manifest declares the parameters of a session. The order of the sources is the order of their tables.
+type Manifest struct {
+	Version int         `json:"version"`
+	Nonce   []byte      `json:"nonce"` // makes the session ID unique
+	Group   string      `json:"group"`
+	Parties []Party     `json:"parties"`
+	Join    JoinSpec    `json:"join"`
+	Values  ValueSchema `json:"values"`
+	Limits  Limits      `json:"limits"`
+}
+
+// NewManifest returns a manifest with a fresh nonce and the protocol's parameters, to which the parties, value
+// schema and limits are added.
+func NewManifest() *Manifest {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		panic(err)
+	}
+	return &Manifest{
+		Version: ManifestVersion,
+		Nonce:   nonce,
+		Group:   GroupName,
+		Join:    JoinSpec{Mode: JoinInner},
+	}
+}
+
+// ReadManifest reads and validates a manifest in JSON.
+func ReadManifest(r io.Reader) (*Manifest, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields() // the parameters which are not understood would not be enforced
+	var m Manifest
+	if err := dec.Decode(&m); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidManifest, err)
+	}
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// WriteTo writes the manifest in indented JSON.
+func (m *Manifest) WriteTo(w io.Writer) (int64, error) {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(append(data, '\n'))
+	return int64(n), err
+}
+
+// Validate checks that the manifest is supported and complete: it has one helper with an address, one
+// receiver with public keys and at least two sources, whose ids are distinct.
+func (m *Manifest) Validate() error {
+	invalid := func(format string, args ...any) error {
+		return fmt.Errorf("%w: %s", ErrInvalidManifest, fmt.Sprintf(format, args...))
+	}
+	if m.Version != ManifestVersion {
+		return invalid("unsupported version %d", m.Version)
+	}
+	if len(m.Nonce) < 16 {
+		return invalid("the nonce must have at least 16 bytes")
+	}
+	if m.Group != GroupName {
+		return invalid("unsupported group %q", m.Group)
+	}
+	var nHelpers, nReceivers int
+	var ids []string
+	for _, p := range m.Parties {
+		switch {
+		case p.ID == "":
+			return invalid("missing party id")
+		case slices.Contains(ids, p.ID):
+			return invalid("duplicate party id %q", p.ID)
+		}
+		ids = append(ids, p.ID)
+		if p.SigningKey != nil && len(p.SigningKey) != ed25519.PublicKeySize {
+			return invalid("invalid signing key of party %q", p.ID)
+		}
+		switch p.Role {
+		case RoleSource:
+		case RoleHelper:
+			if p.Address == "" {
+				return invalid("missing address of the helper")
+			}
+			nHelpers++
+		case RoleReceiver:
+			var rpk PublicKeyTuple
+			if err := rpk.UnmarshalBinary(p.PublicKey); err != nil {
+				return invalid("public keys of the receiver: %v", err)
+			}
+			nReceivers++
+		default:
+			return invalid("unknown role %q of party %q", p.Role, p.ID)
+		}
+	}
+	if nHelpers != 1 || nReceivers != 1 {
+		return invalid("expected one helper and one receiver, got %d and %d", nHelpers, nReceivers)
+	}
+	sources := m.Sources()
+	if len(sources) < 2 {
+		return invalid("at least two sources are required")
+	}
+	if m.Join.Mode != JoinInner {
+		return invalid("unsupported join mode %q", m.Join.Mode)
+	}
+	if _, err := ParseNormalization(m.Join.Normalize); err != nil {
+		return invalid("%v", err)
+	}
+	if m.Values.MaxLength <= 0 {
+		return invalid("the maximum value length must be positive")
+	}
+	for id := range m.Values.Types {
+		if !slices.Contains(sources, id) {
+			return invalid("value type of unknown source %q", id)
+		}
+	}
+	if m.Limits.RowsPerSource <= 0 {
+		return invalid("the number of rows per source must be positive")
+	}
+	return nil
+}
+
+// Sources returns the ids of the sources, in the order of their tables.
+func (m *Manifest) Sources() []SourceID {
+	var sources []SourceID
+	for _, p := range m.Parties {
+		if p.Role == RoleSource {
+			sources = append(sources, SourceID(p.ID))
+		}
+	}
+	return sources
+}
+
+// party returns the first party with the role.
+func (m *Manifest) party(role Role) Party {
+	for _, p := range m.Parties {
+		if p.Role == role {
+			return p
+		}
+	}
+	return Party{}
+}
+
+// Helper returns the helper of a valid manifest.
+func (m *Manifest) Helper() Party {
+	return m.party(RoleHelper)
+}
+
+// Receiver returns the receiver of a valid manifest.
+func (m *Manifest) Receiver() Party {
+	return m.party(RoleReceiver)
+}
+
+// ReceiverPK returns the receiver's public keys.
+func (m *Manifest) ReceiverPK() (PublicKeyTuple, error) {
+	var rpk PublicKeyTuple
+	err := rpk.UnmarshalBinary(m.Receiver().PublicKey)
+	return rpk, err
+}
+
+// Normalization returns the join key normalization.
+func (m *Manifest) Normalization() (Normalization, error) {
+	return ParseNormalization(m.Join.Normalize)
+}
+
+// Hash returns the SHA-256 hash of the manifest's canonical encoding, which does not depend on the formatting
+// of the file it was read from.
+func (m *Manifest) Hash() []byte {
+	data, err := json.Marshal(m) // the fields and the map keys are in a fixed order
+	if err != nil {
+		panic(err)
+	}
+	h := sha256.Sum256(data)
+	return h[:]
+}
+
+// SessionID derives the session ID from the hash of the manifest.
+func (m *Manifest) SessionID() []byte {
+	sid, err := hkdf.Key(sha256.New, m.Hash(), nil, "session manifest", sha256.New().Size())
+	if err != nil {
+		panic(err)
+	}
+	return sid
+}
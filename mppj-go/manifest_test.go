@@ -0,0 +1,95 @@
+package mppj
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testManifest(t *testing.T) *Manifest {
+	_, rpk := ReceiverKeyGen()
+	pk, err := rpk.MarshalBinary()
+	require.NoError(t, err)
+	m := NewManifest()
+	m.Parties = []Party{
+		{ID: "helper", Role: RoleHelper, Address: "localhost:40000"},
+		{ID: "receiver", Role: RoleReceiver, PublicKey: pk},
+		{ID: "ds1", Role: RoleSource},
+		{ID: "ds2", Role: RoleSource},
+	}
+	m.Join.Normalize = "trim,lower"
+	m.Values = ValueSchema{MaxLength: 30, Types: map[SourceID]string{"ds2": "int64"}}
+	m.Limits.RowsPerSource = 100
+	require.NoError(t, m.Validate())
+	return m
+}
+
+func TestManifest(t *testing.T) {
+
+	require.Equal(t, group.(fmt.Stringer).String(), GroupName)
+
+	m := testManifest(t)
+	require.Equal(t, []SourceID{"ds1", "ds2"}, m.Sources())
+	require.Equal(t, "localhost:40000", m.Helper().Address)
+
+	var buf bytes.Buffer
+	_, err := m.WriteTo(&buf)
+	require.NoError(t, err)
+	data := buf.Bytes()
+	read, err := ReadManifest(bytes.NewReader(data))
+	require.NoError(t, err)
+	require.Equal(t, m.SessionID(), read.SessionID())
+
+	// the session ID does not depend on the formatting of the file
+	compact := strings.Join(strings.Fields(string(data)), "")
+	read, err = ReadManifest(strings.NewReader(compact))
+	require.NoError(t, err)
+	require.Equal(t, m.SessionID(), read.SessionID())
+
+	// but it depends on every parameter
+	sid := m.SessionID()
+	for name, modify := range map[string]func(m *Manifest){
+		"nonce":     func(m *Manifest) { m.Nonce[0]++ },
+		"order":     func(m *Manifest) { m.Parties[2], m.Parties[3] = m.Parties[3], m.Parties[2] },
+		"address":   func(m *Manifest) { m.Parties[0].Address = "localhost:40001" },
+		"normalize": func(m *Manifest) { m.Join.Normalize = "trim" },
+		"types":     func(m *Manifest) { m.Values.Types["ds1"] = "bool" },
+		"rows":      func(m *Manifest) { m.Limits.RowsPerSource++ },
+	} {
+		other, err := ReadManifest(bytes.NewReader(data))
+		require.NoError(t, err)
+		modify(other)
+		require.NotEqual(t, sid, other.SessionID(), name)
+	}
+}
+
+func TestInvalidManifest(t *testing.T) {
+
+	for name, modify := range map[string]func(m *Manifest){
+		"version":     func(m *Manifest) { m.Version = 2 },
+		"nonce":       func(m *Manifest) { m.Nonce = nil },
+		"group":       func(m *Manifest) { m.Group = "P-384" },
+		"no helper":   func(m *Manifest) { m.Parties = m.Parties[1:] },
+		"no address":  func(m *Manifest) { m.Parties[0].Address = "" },
+		"public key":  func(m *Manifest) { m.Parties[1].PublicKey = m.Parties[1].PublicKey[1:] },
+		"duplicate":   func(m *Manifest) { m.Parties[3].ID = "ds1" },
+		"signing key": func(m *Manifest) { m.Parties[2].SigningKey = []byte("short") },
+		"one source":  func(m *Manifest) { m.Parties = m.Parties[:3] },
+		"role":        func(m *Manifest) { m.Parties[3].Role = "observer" },
+		"join mode":   func(m *Manifest) { m.Join.Mode = "outer" },
+		"normalize":   func(m *Manifest) { m.Join.Normalize = "unknown" },
+		"max length":  func(m *Manifest) { m.Values.MaxLength = 0 },
+		"value types": func(m *Manifest) { m.Values.Types["ds3"] = "string" },
+		"rows":        func(m *Manifest) { m.Limits.RowsPerSource = 0 },
+	} {
+		m := testManifest(t)
+		modify(m)
+		require.ErrorIs(t, m.Validate(), ErrInvalidManifest, name)
+	}
+
+	_, err := ReadManifest(strings.NewReader(`{"version": 1, "unknown": true}`))
+	require.ErrorIs(t, err, ErrInvalidManifest)
+}
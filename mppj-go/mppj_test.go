@@ -1,6 +1,7 @@
 package mppj
 
 import (
+	"context"
 	"testing"
 )
 
@@ -54,7 +55,226 @@ func TestMPPJ(t *testing.T) {
 	joinedTablesPlain := IntersectSimple(tables, sourceIDs)
 
 	if !joinedTablesPlain.EqualContents(&intersectionMPPJ) {
-		t.Errorf("Expected tables' contents to be equal, but they are not: \n Plain: \n%s \n MPPJ: \n%s", joinedTablesPlain, intersectionMPPJ)
+		t.Errorf("Expected tables' contents to be equal, but they are not: \n Plain: \n%v \n MPPJ: \n%v", joinedTablesPlain, intersectionMPPJ)
 	}
 
 }
+
+func TestMPPJNormalization(t *testing.T) {
+
+	sourceIDs := []SourceID{"ds1", "ds2"}
+
+	norm, err := ParseNormalization("trim,lower,email")
+	if err != nil {
+		t.Fatalf("Error in ParseNormalization: %v", err)
+	}
+
+	sid := NewSessionID(2, "helper", "receiver", sourceIDs)
+	nsid := norm.BindSessionID(sid)
+
+	helper := NewHelper(nsid, sourceIDs, 4)
+	receiver := NewReceiver(nsid, sourceIDs)
+
+	tables := map[SourceID]TablePlain{
+		"ds1": {"Alice@example.com": "a1", " bob.smith@gmail.com": "b1", "carol@example.com": "c1", "erin@example.com": "e1"},
+		"ds2": {"alice@example.com ": "a2", "BobSmith+work@GMail.com": "b2", "carol+work@example.com": "c2", "dave@example.com": "d2"},
+	}
+
+	encTables := make(map[SourceID]EncTable, len(tables))
+	for sourceID, table := range tables {
+		ds := NewDataSourceWithNormalization(sid, receiver.GetPK(), norm)
+		prepTable, err := ds.Prepare(receiver.GetPK(), table)
+		if err != nil {
+			t.Fatalf("Error in Prepare: %v", err)
+		}
+		encTables[sourceID] = prepTable
+	}
+
+	joinedTables, err := helper.Convert(receiver.GetPK(), encTables)
+	if err != nil {
+		t.Fatalf("Error in Convert: %v", err)
+	}
+
+	intersectionMPPJ, err := receiver.JoinTables(joinedTables, len(encTables))
+	if err != nil {
+		t.Fatalf("Error in JoinTables: %v", err)
+	}
+
+	expected := NewJoinTable(sourceIDs)
+	expected.Insert(map[SourceID]string{"ds1": "a1", "ds2": "a2"})
+	expected.Insert(map[SourceID]string{"ds1": "b1", "ds2": "b2"})
+
+	if !expected.EqualContents(&intersectionMPPJ) {
+		t.Errorf("Expected tables' contents to be equal, but they are not: \n Expected: \n%v \n MPPJ: \n%v", expected, intersectionMPPJ)
+	}
+}
+
+// countingWriter is a RowWriter which only counts the rows.
+type countingWriter struct {
+	header  []SourceID
+	rows    int
+	flushed bool
+}
+
+func (w *countingWriter) WriteHeader(sourceIDs []SourceID) error {
+	w.header = sourceIDs
+	return nil
+}
+
+func (w *countingWriter) WriteRow(values []string) error {
+	w.rows++
+	return nil
+}
+
+func (w *countingWriter) Flush() error {
+	w.flushed = true
+	return nil
+}
+
+func TestMPPJStreamTo(t *testing.T) {
+
+	sourceIDs := []SourceID{"ds1", "ds2", "ds3"}
+
+	sid := NewSessionID(3, "helper", "receiver", sourceIDs)
+
+	helper := NewHelper(sid, sourceIDs, ROW_AMOUNT)
+	receiver := NewReceiver(sid, sourceIDs)
+	ds := NewDataSource(sid, receiver.GetPK())
+
+	tables := GenTestTables(sourceIDs, ROW_AMOUNT, INTERSECTION_SIZE)
+	encTables := make(map[SourceID]EncTable, TABLE_AMOUNT)
+	for sourceID, table := range tables {
+		prepTable, err := ds.Prepare(receiver.GetPK(), table)
+		if err != nil {
+			t.Fatalf("Error in Prepare: %v", err)
+		}
+		encTables[sourceID] = prepTable
+	}
+
+	joinedTables, err := helper.Convert(receiver.GetPK(), encTables)
+	if err != nil {
+		t.Fatalf("Error in Convert: %v", err)
+	}
+
+	encrows := make(chan EncRowWithHint, len(joinedTables))
+	for _, row := range joinedTables {
+		encrows <- row
+	}
+	close(encrows)
+
+	w := new(countingWriter)
+	n, _, err := receiver.JoinTablesStreamTo(context.Background(), encrows, w)
+	if err != nil {
+		t.Fatalf("Error in JoinTablesStreamTo: %v", err)
+	}
+	if n != INTERSECTION_SIZE || w.rows != INTERSECTION_SIZE {
+		t.Errorf("Expected %d rows, got %d (%d written)", INTERSECTION_SIZE, n, w.rows)
+	}
+	if len(w.header) != len(sourceIDs) || !w.flushed {
+		t.Errorf("Expected header %v and flushed writer, got header %v and flushed=%v", sourceIDs, w.header, w.flushed)
+	}
+}
+
+func TestMPPJExternal(t *testing.T) {
+
+	sourceIDs := []SourceID{"ds1", "ds2", "ds3"}
+
+	sid := NewSessionID(3, "helper", "receiver", sourceIDs)
+
+	helper := NewHelper(sid, sourceIDs, ROW_AMOUNT)
+	receiver := NewReceiver(sid, sourceIDs)
+	ds := NewDataSource(sid, receiver.GetPK())
+
+	tables := GenTestTables(sourceIDs, ROW_AMOUNT, INTERSECTION_SIZE)
+	encTables := make(map[SourceID]EncTable, TABLE_AMOUNT)
+	for sourceID, table := range tables {
+		prepTable, err := ds.Prepare(receiver.GetPK(), table)
+		if err != nil {
+			t.Fatalf("Error in Prepare: %v", err)
+		}
+		encTables[sourceID] = prepTable
+	}
+
+	joinedTables, err := helper.Convert(receiver.GetPK(), encTables)
+	if err != nil {
+		t.Fatalf("Error in Convert: %v", err)
+	}
+
+	encrows := make(chan EncRowWithHint, len(joinedTables))
+	for _, row := range joinedTables {
+		encrows <- row
+	}
+	close(encrows)
+
+	intersectionMPPJ := NewJoinTable(sourceIDs)
+	if _, _, err := receiver.JoinTablesStreamToExternal(context.Background(), encrows, &intersectionMPPJ, t.TempDir(), 4); err != nil {
+		t.Fatalf("Error in JoinTablesStreamToExternal: %v", err)
+	}
+
+	joinedTablesPlain := IntersectSimple(tables, sourceIDs)
+	if !joinedTablesPlain.EqualContents(&intersectionMPPJ) {
+		t.Errorf("Expected tables' contents to be equal, but they are not: \n Plain: \n%v \n MPPJ: \n%v", joinedTablesPlain, intersectionMPPJ)
+	}
+}
+
+// notifyingWriter is a RowWriter which signals each written row.
+type notifyingWriter struct {
+	rows chan []string
+}
+
+func (w *notifyingWriter) WriteHeader(sourceIDs []SourceID) error { return nil }
+
+func (w *notifyingWriter) WriteRow(values []string) error {
+	w.rows <- values
+	return nil
+}
+
+func (w *notifyingWriter) Flush() error { return nil }
+
+func TestMPPJPipelined(t *testing.T) {
+
+	sourceIDs := []SourceID{"ds1", "ds2"}
+
+	sid := NewSessionID(2, "helper", "receiver", sourceIDs)
+
+	helper := NewHelper(sid, sourceIDs, 1)
+	receiver := NewReceiver(sid, sourceIDs)
+	ds := NewDataSource(sid, receiver.GetPK())
+
+	encTables := make(map[SourceID]EncTable)
+	for _, sourceID := range sourceIDs {
+		prepTable, err := ds.Prepare(receiver.GetPK(), TablePlain{"uid": "val_" + string(sourceID)})
+		if err != nil {
+			t.Fatalf("Error in Prepare: %v", err)
+		}
+		encTables[sourceID] = prepTable
+	}
+
+	joinedTables, err := helper.Convert(receiver.GetPK(), encTables)
+	if err != nil {
+		t.Fatalf("Error in Convert: %v", err)
+	}
+
+	encrows := make(chan EncRowWithHint)
+	w := &notifyingWriter{rows: make(chan []string, 1)}
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := receiver.JoinTablesStreamTo(context.Background(), encrows, w)
+		done <- err
+	}()
+
+	for _, row := range joinedTables {
+		encrows <- row
+	}
+
+	// the complete group is decrypted before the input is closed
+	row := <-w.rows
+	if row[0] != "val_ds1" || row[1] != "val_ds2" {
+		t.Errorf("Unexpected joined row: %v", row)
+	}
+
+	close(encrows)
+	if err := <-done; err != nil {
+		t.Fatalf("Error in JoinTablesStreamTo: %v", err)
+	}
+}
@@ -0,0 +1,466 @@
+// This file implements the multi-key ("OR") matching mode, where each row carries several
+// identifiers of different types (e.g., an email and a phone number), and the receiver links
+// the rows which share any identifier.
+//
+// Each identifier type is processed as in the single-key protocol: the sources blind each
+// identifier, and the helper evaluates the PRF on it and produces a blinded value key and a
+// hint for it. The value of a row is encrypted once, and its key can be recovered through any
+// identifier type for which the rows sharing the identifier form a complete group (i.e., one
+// row per source). The receiver links the rows with a union-find over all PRF outputs, and
+// outputs the connected components that consist of exactly one decryptable row per source.
+//
+// Leakage: compared to the single-key mode, the receiver additionally learns the linkage graph
+// between the rows, that is, for each identifier type, which rows share an identifier, and which
+// PRF outputs appear in the same row. In particular, this reveals partial matches (e.g., an email
+// shared by a strict subset of the sources, or two rows linked only by a phone number) even when
+// the corresponding records are not part of the join result, as well as the size of each
+// connected component. The helper learns the number of identifier types. Missing identifiers are
+// replaced by random ones by the sources, so that their absence is not revealed.
+package mppj
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"slices"
+	"sync"
+)
+
+// MultiKeyRow is a row with several identifiers. The identifiers are positional: Keys[t] is the
+// identifier of type t, and the empty string denotes a missing identifier.
+type MultiKeyRow struct {
+	Keys []string
+	Val  string
+}
+
+// TableMultiKey is a plaintext table for the multi-key mode.
+type TableMultiKey []MultiKeyRow
+
+// EncRowMultiKey is a source row for the multi-key mode, with one encrypted identifier per type.
+type EncRowMultiKey struct {
+	Cuids []*Ciphertext
+	Cval  []*Ciphertext
+}
+
+type EncTableMultiKey []EncRowMultiKey
+
+// EncRowMultiKeyWithHint is a converted row for the multi-key mode. The value is encrypted once,
+// and its key is blinded and hinted for each identifier type.
+type EncRowMultiKeyWithHint struct {
+	Cnymes   []Ciphertext
+	CVal     SymmetricCiphertext
+	CValKeys []Ciphertext
+	CHints   []Ciphertext
+}
+
+type EncTableMultiKeyWithHint []EncRowMultiKeyWithHint
+
+// keyTypeInput returns the PRF input for the identifier key of type t, so that the PRF outputs
+// of different types do not collide.
+func keyTypeInput(t int, key string) []byte {
+	return fmt.Appendf(nil, "%d|%s", t, key)
+}
+
+// PrepareMultiKey prepares a multi-key table for joining. All rows must have the same number of
+// identifier types. The source's normalization is applied to all non-missing identifiers, which must
+// then be unique per type (otherwise ErrDuplicateKey is returned).
+func (s *DataSource) PrepareMultiKey(table TableMultiKey) (EncTableMultiKey, error) {
+	if len(table) == 0 {
+		return EncTableMultiKey{}, nil
+	}
+
+	numTypes := len(table[0].Keys)
+	keys := make([][]string, len(table)) // the normalized identifiers
+	seen := make([]map[string]bool, numTypes)
+	for t := range seen {
+		seen[t] = make(map[string]bool, len(table))
+	}
+	for i, row := range table {
+		if len(row.Keys) != numTypes {
+			return nil, fmt.Errorf("rows have different numbers of identifier types: %d and %d", numTypes, len(row.Keys))
+		}
+		nkeys, err := s.normalizeKeys(row.Keys)
+		if err != nil {
+			return nil, err
+		}
+		for t, key := range nkeys {
+			if key == "" {
+				continue
+			}
+			if seen[t][key] {
+				return nil, fmt.Errorf("%w: identifier %q of type %d", ErrDuplicateKey, key, t)
+			}
+			seen[t][key] = true
+		}
+		keys[i] = nkeys
+	}
+
+	perm := s.rand.Perm(len(table))
+	streams := s.rand.split()
+	encTable := make(EncTableMultiKey, len(table))
+	err := parallelFor(len(table), func(i int) error {
+		cuids, cval, err := s.encryptRowMultiKey(keys[perm[i]], table[perm[i]].Val, streams(i))
+		if err != nil {
+			return err
+		}
+		encTable[i] = EncRowMultiKey{Cuids: cuids, Cval: cval}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return encTable, nil
+}
+
+// ProcessRowMultiKey normalizes, hashes and encrypts the identifiers and encrypts the value towards
+// the receiver. Missing identifiers are replaced by the encryption of a random message.
+func (s *DataSource) ProcessRowMultiKey(keys []string, val string) (cuids []*Ciphertext, cval []*Ciphertext, err error) {
+	return s.processRowMultiKey(keys, val, s.rand)
+}
+
+func (s *DataSource) processRowMultiKey(keys []string, val string, rnd *Rand) (cuids []*Ciphertext, cval []*Ciphertext, err error) {
+	keys, err = s.normalizeKeys(keys)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s.encryptRowMultiKey(keys, val, rnd)
+}
+
+// normalizeKeys applies the source's normalization to the non-missing identifiers.
+func (s *DataSource) normalizeKeys(keys []string) ([]string, error) {
+	nkeys := make([]string, len(keys))
+	for t, key := range keys {
+		if key == "" {
+			continue
+		}
+		nkey, err := s.norm.Apply(key)
+		if err != nil {
+			return nil, err
+		}
+		nkeys[t] = nkey
+	}
+	return nkeys, nil
+}
+
+// encryptRowMultiKey hashes and encrypts the normalized identifiers, and encrypts the value.
+func (s *DataSource) encryptRowMultiKey(keys []string, val string, rnd *Rand) (cuids []*Ciphertext, cval []*Ciphertext, err error) {
+	cuids = make([]*Ciphertext, len(keys))
+	for t, key := range keys {
+		if key == "" {
+			cuids[t] = pkeEncrypt(s.rpk.bpk, &Message{m: *rnd.Point()}, rnd)
+			continue
+		}
+		cuids[t] = oprfBlind(s.rpk.bpk, keyTypeInput(t, key), s.sid, rnd)
+	}
+	cval, err = pkeEncryptVector([]byte(val), func(m *Message) (*Ciphertext, error) {
+		return pkeEncrypt(s.rpk.epk, m, rnd), nil
+	})
+	return cuids, cval, err
+}
+
+// ConvertMultiKey converts the multi-key tables of the sources, then shuffles the converted rows.
+func (h *Helper) ConvertMultiKey(rpk PublicKeyTuple, tables map[SourceID]EncTableMultiKey) (EncTableMultiKeyWithHint, error) {
+
+	if h.padKey == nil || h.padKeyShares == nil {
+		return nil, fmt.Errorf("nonceerr, Nonces not generated. Please call GenNonces() before calling this function")
+	}
+
+	type task struct {
+		row    *EncRowMultiKey
+		tindex int
+	}
+
+	for sourceID := range tables {
+		if _, ok := h.sourceIndices[sourceID]; !ok {
+			return nil, fmt.Errorf("unexpected source ID: %s", sourceID)
+		}
+	}
+	tasks := make([]task, 0, len(h.rowPerm))
+	for tindex, sourceID := range h.sources { // rather than the map's order, which is not reproducible
+		table := tables[sourceID]
+		for i := range table {
+			tasks = append(tasks, task{row: &table[i], tindex: tindex})
+		}
+	}
+	if len(tasks) > len(h.rowPerm) {
+		return nil, fmt.Errorf("%w: the conversion expects %d rows, got %d", ErrTooManyRows, len(h.rowPerm), len(tasks))
+	}
+	if len(tasks) < len(h.rowPerm) {
+		return nil, fmt.Errorf("%w: the conversion expects %d rows, got %d", ErrTooFewRows, len(h.rowPerm), len(tasks))
+	}
+
+	res := make(EncTableMultiKeyWithHint, len(h.rowPerm))
+	streams := h.rand.split()
+	err := parallelFor(len(tasks), func(i int) error {
+		convRow, err := h.convertRowMultiKey(rpk, tasks[i].row, tasks[i].tindex, streams(i))
+		if err != nil {
+			return err
+		}
+		res[h.rowPerm[i]] = *convRow
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// ConvertRowMultiKey evaluates the PRF on each identifier of the row, and produces a blinded value key
+// and a hint per identifier type.
+func (h *Helper) ConvertRowMultiKey(rpk PublicKeyTuple, r *EncRowMultiKey, rid int) (*EncRowMultiKeyWithHint, error) {
+	return h.convertRowMultiKey(rpk, r, rid, h.rand)
+}
+
+func (h *Helper) convertRowMultiKey(rpk PublicKeyTuple, r *EncRowMultiKey, rid int, rnd *Rand) (*EncRowMultiKeyWithHint, error) {
+
+	if rid < 0 || rid >= len(h.padKeyShares) {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidSourceIndex, rid)
+	}
+	if len(r.Cuids) == 0 || slices.Contains(r.Cuids, nil) || len(r.Cval) == 0 || slices.Contains(r.Cval, nil) {
+		return nil, fmt.Errorf("%w: missing ciphertexts", ErrInvalidRow)
+	}
+
+	rp, ad, err := h.encryptValue(rpk, r.Cval, rid, rnd)
+	if err != nil {
+		return nil, err
+	}
+
+	row := &EncRowMultiKeyWithHint{
+		Cnymes:   make([]Ciphertext, len(r.Cuids)),
+		CVal:     ad,
+		CValKeys: make([]Ciphertext, len(r.Cuids)),
+		CHints:   make([]Ciphertext, len(r.Cuids)),
+	}
+	for t, cuid := range r.Cuids {
+		joinid := oprfEval(h.convK, rpk.bpk, cuid, rnd) // ReRand internally
+		blindkey, hint := h.blindKeyAndHint(rpk, joinid, rp, rid, rnd)
+		row.Cnymes[t], row.CValKeys[t], row.CHints[t] = *joinid, *blindkey, *hint
+	}
+	return row, nil
+}
+
+// JoinTablesMultiKey joins the multi-key tables, see JoinTablesMultiKeyStream.
+func (r *Receiver) JoinTablesMultiKey(joinedTables EncTableMultiKeyWithHint) (JoinTable, error) {
+
+	encrows := make(chan EncRowMultiKeyWithHint, len(joinedTables))
+
+	go func() {
+		defer close(encrows)
+		for _, ct := range joinedTables {
+			encrows <- ct
+		}
+	}()
+
+	return r.JoinTablesMultiKeyStream(context.Background(), encrows)
+}
+
+// unionFind is a disjoint-set forest over row indices.
+type unionFind []int
+
+func newUnionFind(n int) unionFind {
+	uf := make(unionFind, n)
+	for i := range uf {
+		uf[i] = i
+	}
+	return uf
+}
+
+func (uf unionFind) find(i int) int {
+	for uf[i] != i {
+		uf[i] = uf[uf[i]] // path halving
+		i = uf[i]
+	}
+	return i
+}
+
+func (uf unionFind) union(i, j int) {
+	ri, rj := uf.find(i), uf.find(j)
+	if ri < rj {
+		uf[rj] = ri
+	} else if rj < ri {
+		uf[ri] = rj
+	}
+}
+
+// multiKeyRow is a received row with its unblinded PRF outputs and, once decrypted, its value.
+type multiKeyRow struct {
+	EncRowMultiKeyWithHint
+	prfs      []string
+	decrypted bool
+	sourceID  SourceID
+	val       string
+}
+
+// JoinTablesMultiKeyStream links the rows sharing any identifier, and decrypts the connected components
+// consisting of exactly one row per source. When ctx is done, it stops reading in and returns the cause of
+// the cancellation.
+//
+// The groups of an identifier with several rows of a source (which PrepareMultiKey rejects) cannot be
+// decrypted, and are skipped. The join of the other rows is then returned, and the skipped groups are counted
+// by its Skipped.
+func (r *Receiver) JoinTablesMultiKeyStream(ctx context.Context, in chan EncRowMultiKeyWithHint) (JoinTable, error) {
+
+	rows := make([]*multiKeyRow, 0)
+loop:
+	for {
+		select {
+		case row, ok := <-in:
+			if !ok {
+				break loop
+			}
+			rows = append(rows, &multiKeyRow{EncRowMultiKeyWithHint: row})
+		case <-ctx.Done():
+			return JoinTable{}, context.Cause(ctx)
+		}
+	}
+
+	if err := parallelFor(len(rows), func(i int) error {
+		row := rows[i]
+		row.prfs = make([]string, len(row.Cnymes))
+		for t := range row.Cnymes {
+			msgPRF, err := OPRFUnblind(r.recvSK.bsk, &row.Cnymes[t]).GetMessageBytes()
+			if err != nil {
+				return fmt.Errorf("%w: %v", ErrDecryption, err)
+			}
+			row.prfs[t] = string(msgPRF)
+		}
+		return nil
+	}); err != nil {
+		return JoinTable{}, err
+	}
+
+	// groups the rows by PRF output (the outputs of different types are distinct) and links them
+	uf := newUnionFind(len(rows))
+	type group struct {
+		keyType int
+		rows    []int
+	}
+	groups := make(map[string]*group)
+	for i, row := range rows {
+		for t, prf := range row.prfs {
+			g, ok := groups[prf]
+			if !ok {
+				g = &group{keyType: t}
+				groups[prf] = g
+			}
+			g.rows = append(g.rows, i)
+			uf.union(g.rows[0], i)
+		}
+	}
+
+	// decrypts the rows which belong to a complete group for some identifier type
+	completeGroups := make([]*group, 0)
+	var skipped int // the groups with several rows of a source
+	for _, g := range groups {
+		switch {
+		case len(g.rows) == len(r.sourceIDs):
+			completeGroups = append(completeGroups, g)
+		case len(g.rows) > len(r.sourceIDs): // more rows than sources
+			skipped++
+		}
+	}
+	mu := sync.Mutex{}
+	if err := parallelFor(len(completeGroups), func(i int) error {
+		g := completeGroups[i]
+		decGroup := make([]EncValueWithHint, len(g.rows))
+		hints := make([]*Point, len(g.rows))
+		mask := Identity()
+		for j, ri := range g.rows {
+			row := rows[ri]
+			decGroup[j] = EncValueWithHint{
+				val:        row.CVal,
+				blindedkey: *OPRFUnblind(r.recvSK.bsk, &row.CValKeys[g.keyType]),
+				hint:       *OPRFUnblind(r.recvSK.bsk, &row.CHints[g.keyType]),
+			}
+			hints[j] = &decGroup[j].hint.m
+			mask = Mul(mask, hints[j])
+		}
+		if !distinctPoints(hints) {
+			// the rows of a source with the same identifier have the same hint, and their group cannot
+			// be unmasked
+			mu.Lock()
+			skipped++
+			mu.Unlock()
+			return nil
+		}
+		invMask := mask.Invert()
+		for j, ri := range g.rows {
+			mu.Lock()
+			done := rows[ri].decrypted
+			mu.Unlock()
+			if done {
+				continue
+			}
+			sourceID, val, err := r.decryptValue(decGroup[j], invMask)
+			if err != nil {
+				return err
+			}
+			mu.Lock()
+			rows[ri].decrypted, rows[ri].sourceID, rows[ri].val = true, sourceID, val
+			mu.Unlock()
+		}
+		return nil
+	}); err != nil {
+		return JoinTable{}, err
+	}
+
+	// outputs the components with exactly one decrypted row per source
+	components := make(map[int][]int)
+	for i := range rows {
+		root := uf.find(i)
+		components[root] = append(components[root], i)
+	}
+
+	join := NewJoinTable(r.sourceIDs)
+	for _, comp := range components {
+		if len(comp) != len(r.sourceIDs) {
+			continue
+		}
+		vals := make(map[SourceID]string, len(comp))
+		for _, ri := range comp {
+			if !rows[ri].decrypted {
+				break
+			}
+			vals[rows[ri].sourceID] = rows[ri].val
+		}
+		if len(vals) != len(r.sourceIDs) {
+			continue // some rows are not decryptable, or several rows are from the same source
+		}
+		if err := join.Insert(vals); err != nil {
+			return JoinTable{}, err
+		}
+	}
+
+	join.skipped = skipped
+	return join, nil
+}
+
+// parallelFor calls f(i) for i in 0..n-1 over runtime.NumCPU() workers, and returns the first error.
+func parallelFor(n int, f func(i int) error) error {
+	tasks := make(chan int)
+	errs := make(chan error, runtime.NumCPU())
+	var wg sync.WaitGroup
+	for range runtime.NumCPU() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range tasks {
+				if err := f(i); err != nil {
+					errs <- err
+					for range tasks {
+						// drains the tasks
+					}
+					return
+				}
+			}
+		}()
+	}
+	for i := range n {
+		tasks <- i
+	}
+	close(tasks)
+	wg.Wait()
+	close(errs)
+	return <-errs
+}
@@ -0,0 +1,167 @@
+package mppj
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMPPJMultiKey(t *testing.T) {
+
+	sourceIDs := []SourceID{"ds1", "ds2"}
+
+	sid := NewSessionID(2, "helper", "receiver", sourceIDs)
+
+	helper := NewHelper(sid, sourceIDs, 4)
+	receiver := NewReceiver(sid, sourceIDs)
+
+	// identifier types: email, phone
+	tables := map[SourceID]TableMultiKey{
+		"ds1": {
+			{Keys: []string{"alice@example.com", "+41000000001"}, Val: "alice1"},
+			{Keys: []string{"bob@example.com", "+41000000002"}, Val: "bob1"},
+			{Keys: []string{"", "+41000000003"}, Val: "carol1"},
+			{Keys: []string{"dave@example.com", ""}, Val: "dave1"},
+		},
+		"ds2": {
+			{Keys: []string{"alice@example.com", "+41000000009"}, Val: "alice2"}, // matches on email
+			{Keys: []string{"robert@example.com", "+41000000002"}, Val: "bob2"},  // matches on phone
+			{Keys: []string{"carol@example.com", ""}, Val: "carol2"},             // no match
+			{Keys: []string{"", "+41000000004"}, Val: "erin2"},                   // no match
+		},
+	}
+
+	encTables := make(map[SourceID]EncTableMultiKey, len(tables))
+	for sourceID, table := range tables {
+		ds := NewDataSource(sid, receiver.GetPK())
+		encTable, err := ds.PrepareMultiKey(table)
+		require.NoError(t, err)
+		encTables[sourceID] = encTable
+	}
+
+	convTable, err := helper.ConvertMultiKey(receiver.GetPK(), encTables)
+	require.NoError(t, err)
+
+	joined, err := receiver.JoinTablesMultiKey(convTable)
+	require.NoError(t, err)
+
+	expected := NewJoinTable(sourceIDs)
+	expected.Insert(map[SourceID]string{"ds1": "alice1", "ds2": "alice2"})
+	expected.Insert(map[SourceID]string{"ds1": "bob1", "ds2": "bob2"})
+
+	require.True(t, expected.EqualContents(&joined), "expected:\n%v\ngot:\n%v", expected, joined)
+}
+
+func TestMPPJMultiKeyAmbiguous(t *testing.T) {
+
+	sourceIDs := []SourceID{"ds1", "ds2"}
+
+	sid := NewSessionID(2, "helper", "receiver", sourceIDs)
+
+	helper := NewHelper(sid, sourceIDs, 2)
+	receiver := NewReceiver(sid, sourceIDs)
+
+	// the ds2 rows are linked to the same ds1 row through different identifiers
+	tables := map[SourceID]TableMultiKey{
+		"ds1": {
+			{Keys: []string{"alice@example.com", "+41000000001"}, Val: "alice1"},
+			{Keys: []string{"bob@example.com", "+41000000002"}, Val: "bob1"},
+		},
+		"ds2": {
+			{Keys: []string{"alice@example.com", ""}, Val: "alice2"},
+			{Keys: []string{"", "+41000000001"}, Val: "alice3"},
+		},
+	}
+
+	encTables := make(map[SourceID]EncTableMultiKey, len(tables))
+	for sourceID, table := range tables {
+		ds := NewDataSource(sid, receiver.GetPK())
+		encTable, err := ds.PrepareMultiKey(table)
+		require.NoError(t, err)
+		encTables[sourceID] = encTable
+	}
+
+	convTable, err := helper.ConvertMultiKey(receiver.GetPK(), encTables)
+	require.NoError(t, err)
+
+	joined, err := receiver.JoinTablesMultiKey(convTable)
+	require.NoError(t, err)
+	require.Equal(t, 0, joined.Len())
+}
+
+func TestMPPJMultiKeyDuplicate(t *testing.T) {
+
+	sourceIDs := []SourceID{"ds1", "ds2", "ds3"}
+
+	sid := NewSessionID(3, "helper", "receiver", sourceIDs)
+
+	helper := NewHelper(sid, sourceIDs, 5)
+	receiver := NewReceiver(sid, sourceIDs)
+
+	// the source rejects an identifier which is duplicated after normalization
+	norm, err := ParseNormalization("lower")
+	require.NoError(t, err)
+	ds := NewDataSourceWithNormalization(sid, receiver.GetPK(), norm)
+	_, err = ds.PrepareMultiKey(TableMultiKey{
+		{Keys: []string{"alice@example.com", "+41000000001"}, Val: "alice1"},
+		{Keys: []string{"ALICE@example.com", "+41000000002"}, Val: "alice2"},
+	})
+	require.True(t, errors.Is(err, ErrDuplicateKey), "expected ErrDuplicateKey, got %v", err)
+
+	// the receiver skips the groups with two rows of ds1, which bypassed the check, whether they have as many
+	// rows as sources (alice) or more (carol), and joins the other rows
+	rows := map[SourceID]TableMultiKey{
+		"ds1": {
+			{Keys: []string{"alice@example.com", ""}, Val: "alice1"},
+			{Keys: []string{"alice@example.com", ""}, Val: "alice1bis"},
+			{Keys: []string{"bob@example.com", ""}, Val: "bob1"},
+			{Keys: []string{"carol@example.com", ""}, Val: "carol1"},
+			{Keys: []string{"carol@example.com", ""}, Val: "carol1bis"},
+		},
+		"ds2": {
+			{Keys: []string{"alice@example.com", ""}, Val: "alice2"},
+			{Keys: []string{"bob@example.com", ""}, Val: "bob2"},
+			{Keys: []string{"carol@example.com", ""}, Val: "carol2"},
+			{Keys: []string{"frank@example.com", ""}, Val: "frank2"},
+			{Keys: []string{"", "+41000000006"}, Val: "grace2"},
+		},
+		"ds3": {
+			{Keys: []string{"bob@example.com", "+41000000002"}, Val: "bob3"},
+			{Keys: []string{"dave@example.com", ""}, Val: "dave3"},
+			{Keys: []string{"", "+41000000005"}, Val: "erin3"},
+			{Keys: []string{"carol@example.com", ""}, Val: "carol3"},
+			{Keys: []string{"", "+41000000007"}, Val: "heidi3"},
+		},
+	}
+	encTables := make(map[SourceID]EncTableMultiKey, len(rows))
+	for sourceID, table := range rows {
+		ds := NewDataSource(sid, receiver.GetPK())
+		for _, row := range table {
+			cuids, cval, err := ds.ProcessRowMultiKey(row.Keys, row.Val)
+			require.NoError(t, err)
+			encTables[sourceID] = append(encTables[sourceID], EncRowMultiKey{Cuids: cuids, Cval: cval})
+		}
+	}
+
+	convTable, err := helper.ConvertMultiKey(receiver.GetPK(), encTables)
+	require.NoError(t, err)
+
+	joined, err := receiver.JoinTablesMultiKey(convTable)
+	require.NoError(t, err)
+	require.Equal(t, 2, joined.Skipped())
+
+	expected := NewJoinTable(sourceIDs)
+	expected.Insert(map[SourceID]string{"ds1": "bob1", "ds2": "bob2", "ds3": "bob3"})
+	require.True(t, expected.EqualContents(&joined), "expected:\n%v\ngot:\n%v", expected, joined)
+}
+
+func TestUnionFind(t *testing.T) {
+	uf := newUnionFind(5)
+	uf.union(0, 3)
+	uf.union(4, 3)
+	uf.union(1, 2)
+	require.Equal(t, uf.find(0), uf.find(4))
+	require.Equal(t, uf.find(1), uf.find(2))
+	require.NotEqual(t, uf.find(0), uf.find(1))
+}
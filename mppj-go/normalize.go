@@ -0,0 +1,258 @@
+package mppj
+
+import (
+	"crypto/hkdf"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// NormalizeFunc canonicalizes a join key. It may return an error if the key cannot be
+// brought into canonical form (e.g., an unparseable phone number).
+type NormalizeFunc func(key string) (string, error)
+
+// Normalizer is a named key normalization step. The argument is an optional parameter
+// (e.g., the default country code for phone numbers) given as "name:arg" in specs.
+type Normalizer struct {
+	Name string
+	Arg  string
+	fn   NormalizeFunc
+}
+
+// String returns the spec of the normalizer, as accepted by ParseNormalization.
+func (n Normalizer) String() string {
+	if n.Arg == "" {
+		return n.Name
+	}
+	return n.Name + ":" + n.Arg
+}
+
+// builtinNormalizers maps the normalizer names to their constructors.
+var builtinNormalizers = map[string]func(arg string) (NormalizeFunc, error){
+	"trim":             noArg(normalizeTrim),
+	"lower":            noArg(normalizeLower),
+	"nfkc":             noArg(normalizeNFKC),
+	"strip-diacritics": noArg(normalizeStripDiacritics),
+	"email":            noArg(normalizeEmail),
+	"phone":            newPhoneNormalizer,
+	"date":             newDateNormalizer,
+}
+
+func noArg(fn NormalizeFunc) func(arg string) (NormalizeFunc, error) {
+	return func(arg string) (NormalizeFunc, error) {
+		if arg != "" {
+			return nil, errors.New("normalizer does not take an argument")
+		}
+		return fn, nil
+	}
+}
+
+// Normalization is an ordered list of normalizers applied to the join keys by the sources,
+// before they are hashed and blinded. All sources of a session must use the same normalization,
+// which is enforced by binding it into the session ID (see BindSessionID).
+type Normalization []Normalizer
+
+// ParseNormalization parses a comma-separated list of normalizer specs, e.g., "trim,lower,phone:41".
+// The supported normalizers are:
+//   - trim: removes leading and trailing white spaces.
+//   - lower: maps the key to lower case.
+//   - nfkc: applies Unicode NFKC normalization.
+//   - strip-diacritics: removes diacritical marks (e.g., "é" becomes "e").
+//   - email: canonicalizes an email address (trimmed and lower case, and for Gmail addresses, without
+//     the dots and the "+tag" of the local part, and with the domain gmail.com).
+//   - phone[:cc]: formats a phone number as E.164, using cc as the country code for national numbers.
+//   - date[:layout]: formats a date as YYYY-MM-DD, parsing it with layout or with common layouts.
+func ParseNormalization(spec string) (Normalization, error) {
+	var n Normalization
+	if strings.TrimSpace(spec) == "" {
+		return n, nil
+	}
+	for _, s := range strings.Split(spec, ",") {
+		name, arg, _ := strings.Cut(strings.TrimSpace(s), ":")
+		newFn, ok := builtinNormalizers[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown normalizer: %q", name)
+		}
+		fn, err := newFn(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid normalizer %q: %w", s, err)
+		}
+		n = append(n, Normalizer{Name: name, Arg: arg, fn: fn})
+	}
+	return n, nil
+}
+
+// String returns the spec of the normalization, as accepted by ParseNormalization.
+func (n Normalization) String() string {
+	specs := make([]string, len(n))
+	for i, nz := range n {
+		specs[i] = nz.String()
+	}
+	return strings.Join(specs, ",")
+}
+
+// Apply applies the normalizers to the key, in order.
+func (n Normalization) Apply(key string) (string, error) {
+	var err error
+	for _, nz := range n {
+		if key, err = nz.fn(key); err != nil {
+			return "", fmt.Errorf("normalizer %s: %w", nz, err)
+		}
+	}
+	return key, nil
+}
+
+// ApplyTable normalizes the keys of a table. It returns an error if two keys of the table
+// have the same normalized form, as a source cannot hold duplicate join keys.
+func (n Normalization) ApplyTable(table TablePlain) (TablePlain, error) {
+	if len(n) == 0 {
+		return table, nil
+	}
+	normTable := make(TablePlain, len(table))
+	for uid, val := range table {
+		nuid, err := n.Apply(uid)
+		if err != nil {
+			return nil, err
+		}
+		if _, exists := normTable[nuid]; exists {
+			return nil, fmt.Errorf("%w: %q after normalization", ErrDuplicateKey, nuid)
+		}
+		normTable[nuid] = val
+	}
+	return normTable, nil
+}
+
+// BindSessionID derives the session ID for the normalization from the session ID sid. The
+// empty normalization leaves sid unchanged. Since the derived ID is used for hashing the
+// join keys, sources using different normalizations cannot produce matching rows.
+func (n Normalization) BindSessionID(sid []byte) []byte {
+	if len(n) == 0 {
+		return sid
+	}
+	bsid, err := hkdf.Key(sha256.New, sid, nil, "key normalization|"+n.String(), sha256.New().Size())
+	if err != nil {
+		panic(err)
+	}
+	return bsid
+}
+
+func normalizeTrim(key string) (string, error) {
+	return strings.TrimSpace(key), nil
+}
+
+func normalizeLower(key string) (string, error) {
+	return strings.ToLower(key), nil
+}
+
+func normalizeNFKC(key string) (string, error) {
+	return norm.NFKC.String(key), nil
+}
+
+func normalizeStripDiacritics(key string) (string, error) {
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	res, _, err := transform.String(t, key)
+	return res, err
+}
+
+// gmailDomains are the domains of the Gmail addresses, which are equivalent.
+var gmailDomains = map[string]bool{"gmail.com": true, "googlemail.com": true}
+
+func normalizeEmail(key string) (string, error) {
+	key = strings.ToLower(strings.TrimSpace(key))
+	at := strings.LastIndex(key, "@")
+	if at <= 0 || at == len(key)-1 {
+		return "", fmt.Errorf("invalid email address: %q", key)
+	}
+	local, domain := key[:at], key[at+1:]
+	if gmailDomains[domain] {
+		// only Gmail ignores the dots and the "+tag" of the local part, which distinguish the
+		// addresses of other domains
+		local, _, _ = strings.Cut(local, "+")
+		local = strings.ReplaceAll(local, ".", "")
+		domain = "gmail.com"
+	}
+	if local == "" {
+		return "", fmt.Errorf("invalid email address: %q", key)
+	}
+	return local + "@" + domain, nil
+}
+
+// newPhoneNormalizer returns a normalizer to the E.164 format. National numbers (without
+// international prefix) are prefixed with the country code cc, after removing the trunk prefix 0.
+func newPhoneNormalizer(cc string) (NormalizeFunc, error) {
+	cc = strings.TrimPrefix(cc, "+")
+	for _, r := range cc {
+		if r < '0' || r > '9' {
+			return nil, fmt.Errorf("invalid country code: %q", cc)
+		}
+	}
+	if len(cc) > 3 {
+		return nil, fmt.Errorf("invalid country code: %q", cc)
+	}
+	return func(key string) (string, error) {
+		key = strings.TrimSpace(key)
+		international := strings.HasPrefix(key, "+")
+		var digits strings.Builder
+		for _, r := range key {
+			switch {
+			case r >= '0' && r <= '9':
+				digits.WriteRune(r)
+			case r == '+' || r == ' ' || r == '-' || r == '.' || r == '(' || r == ')' || r == '/':
+			default:
+				return "", fmt.Errorf("invalid phone number: %q", key)
+			}
+		}
+		num := digits.String()
+		switch {
+		case international:
+		case strings.HasPrefix(num, "00"):
+			num = num[2:]
+		case cc != "":
+			num = cc + strings.TrimPrefix(num, "0")
+		default:
+			return "", fmt.Errorf("national phone number without country code: %q", key)
+		}
+		if len(num) < 8 || len(num) > 15 {
+			return "", fmt.Errorf("invalid phone number length: %q", key)
+		}
+		return "+" + num, nil
+	}, nil
+}
+
+// dateLayouts are the layouts tried by the date normalizer when no layout is specified.
+// Ambiguous layouts such as 01/02/2006 vs 02/01/2006 must be specified explicitly.
+var dateLayouts = []string{
+	time.DateOnly,
+	"2006/01/02",
+	"20060102",
+	"02.01.2006",
+	"2 January 2006",
+	"January 2, 2006",
+	"2 Jan 2006",
+	"Jan 2, 2006",
+	time.RFC3339,
+}
+
+// newDateNormalizer returns a normalizer to the YYYY-MM-DD format.
+func newDateNormalizer(layout string) (NormalizeFunc, error) {
+	layouts := dateLayouts
+	if layout != "" {
+		layouts = []string{layout}
+	}
+	return func(key string) (string, error) {
+		key = strings.TrimSpace(key)
+		for _, l := range layouts {
+			if d, err := time.Parse(l, key); err == nil {
+				return d.Format(time.DateOnly), nil
+			}
+		}
+		return "", fmt.Errorf("invalid date: %q", key)
+	}, nil
+}
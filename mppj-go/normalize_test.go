@@ -0,0 +1,94 @@
+package mppj
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizers(t *testing.T) {
+	tests := []struct {
+		spec string
+		in   string
+		want string
+	}{
+		{"trim", "  alice \t", "alice"},
+		{"lower", "Alice", "alice"},
+		{"nfkc", "ｆｕｌｌｗｉｄｔｈ", "fullwidth"},
+		{"strip-diacritics", "Zoë Müller-Éclair", "Zoe Muller-Eclair"},
+		{"email", " John.Doe+news@Example.com ", "john.doe+news@example.com"},
+		{"email", "John.Smith@corp.com", "john.smith@corp.com"},
+		{"email", " John.Doe+news@GMail.com ", "johndoe@gmail.com"},
+		{"email", "j.o.h.n.doe@googlemail.com", "johndoe@gmail.com"},
+		{"phone:41", "044 668 18 00", "+41446681800"},
+		{"phone:41", "+41 (44) 668-1800", "+41446681800"},
+		{"phone", "0041 44 668 18 00", "+41446681800"},
+		{"date", "2024-03-01", "2024-03-01"},
+		{"date", "01.03.2024", "2024-03-01"},
+		{"date", "March 1, 2024", "2024-03-01"},
+		{"date:01/02/2006", "03/01/2024", "2024-03-01"},
+		{"trim,lower,strip-diacritics", " JOSÉ ", "jose"},
+	}
+	for _, test := range tests {
+		t.Run(test.spec+"/"+test.in, func(t *testing.T) {
+			n, err := ParseNormalization(test.spec)
+			require.NoError(t, err)
+			require.Equal(t, test.spec, n.String())
+			got, err := n.Apply(test.in)
+			require.NoError(t, err)
+			require.Equal(t, test.want, got)
+		})
+	}
+}
+
+func TestNormalizersInvalid(t *testing.T) {
+	for _, spec := range []string{"unknown", "lower:arg", "phone:abc", "trim,,lower"} {
+		_, err := ParseNormalization(spec)
+		require.Error(t, err, spec)
+	}
+
+	tests := []struct {
+		spec string
+		in   string
+	}{
+		{"email", "not-an-email"},
+		{"email", "@example.com"},
+		{"phone", "044 668 18 00"},
+		{"phone:41", "044-CALL-ME"},
+		{"phone:41", "12"},
+		{"date", "yesterday"},
+	}
+	for _, test := range tests {
+		n, err := ParseNormalization(test.spec)
+		require.NoError(t, err)
+		_, err = n.Apply(test.in)
+		require.Error(t, err, "%s(%q)", test.spec, test.in)
+	}
+}
+
+func TestNormalizationApplyTable(t *testing.T) {
+	n, err := ParseNormalization("trim,lower")
+	require.NoError(t, err)
+
+	table, err := n.ApplyTable(TablePlain{" Alice": "v1", "BOB ": "v2"})
+	require.NoError(t, err)
+	require.Equal(t, TablePlain{"alice": "v1", "bob": "v2"}, table)
+
+	_, err = n.ApplyTable(TablePlain{"alice": "v1", "Alice ": "v2"})
+	require.Error(t, err)
+}
+
+func TestNormalizationBindSessionID(t *testing.T) {
+	sid := []byte("session-id")
+
+	var empty Normalization
+	require.Equal(t, sid, empty.BindSessionID(sid))
+
+	n1, err := ParseNormalization("trim,lower")
+	require.NoError(t, err)
+	n2, err := ParseNormalization("lower,trim")
+	require.NoError(t, err)
+	require.False(t, bytes.Equal(n1.BindSessionID(sid), sid))
+	require.False(t, bytes.Equal(n1.BindSessionID(sid), n2.BindSessionID(sid)))
+}
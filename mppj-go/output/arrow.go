@@ -0,0 +1,133 @@
+package output
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mppj"
+	"strconv"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+)
+
+// ArrowBatchSize is the number of rows per Arrow record batch.
+const ArrowBatchSize = 4096
+
+// ArrowWriter writes the results as an Arrow IPC stream, with one nullable column per source.
+type ArrowWriter struct {
+	w       io.Writer
+	types   ColumnTypes
+	schema  *arrow.Schema
+	builder *array.RecordBuilder
+	ipcw    *ipc.Writer
+	n       int
+}
+
+func NewArrowWriter(w io.Writer, types ColumnTypes) *ArrowWriter {
+	return &ArrowWriter{w: w, types: types}
+}
+
+func arrowType(t ColumnType) arrow.DataType {
+	switch t {
+	case Int64:
+		return arrow.PrimitiveTypes.Int64
+	case Float64:
+		return arrow.PrimitiveTypes.Float64
+	case Bool:
+		return arrow.FixedWidthTypes.Boolean
+	default:
+		return arrow.BinaryTypes.String
+	}
+}
+
+func (aw *ArrowWriter) WriteHeader(sourceIDs []mppj.SourceID) error {
+	if aw.schema != nil {
+		return errors.New("header already written")
+	}
+	fields := make([]arrow.Field, len(sourceIDs))
+	for i, t := range aw.types.of(sourceIDs) {
+		fields[i] = arrow.Field{Name: string(sourceIDs[i]), Type: arrowType(t), Nullable: true}
+	}
+	aw.schema = arrow.NewSchema(fields, nil)
+	aw.builder = array.NewRecordBuilder(memory.DefaultAllocator, aw.schema)
+	aw.ipcw = ipc.NewWriter(aw.w, ipc.WithSchema(aw.schema))
+	return nil
+}
+
+func (aw *ArrowWriter) WriteRow(values []string) error {
+	if aw.schema == nil {
+		return errors.New("header not written")
+	}
+	if len(values) != len(aw.schema.Fields()) {
+		return fmt.Errorf("row has %d values, expected %d", len(values), len(aw.schema.Fields()))
+	}
+	for i, v := range values {
+		if err := appendValue(aw.builder.Field(i), v); err != nil {
+			return fmt.Errorf("column %s: %w", aw.schema.Field(i).Name, err)
+		}
+	}
+	aw.n++
+	if aw.n == ArrowBatchSize {
+		return aw.writeBatch()
+	}
+	return nil
+}
+
+func appendValue(b array.Builder, v string) error {
+	switch b := b.(type) {
+	case *array.StringBuilder:
+		b.Append(v)
+		return nil
+	}
+	if v == "" {
+		b.AppendNull()
+		return nil
+	}
+	switch b := b.(type) {
+	case *array.Int64Builder:
+		i, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return err
+		}
+		b.Append(i)
+	case *array.Float64Builder:
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return err
+		}
+		b.Append(f)
+	case *array.BooleanBuilder:
+		bv, err := strconv.ParseBool(v)
+		if err != nil {
+			return err
+		}
+		b.Append(bv)
+	default:
+		return fmt.Errorf("unsupported builder %T", b)
+	}
+	return nil
+}
+
+func (aw *ArrowWriter) writeBatch() error {
+	rec := aw.builder.NewRecord()
+	defer rec.Release()
+	aw.n = 0
+	return aw.ipcw.Write(rec)
+}
+
+// Flush writes the pending rows as a record batch and ends the stream. No rows can be written afterwards.
+func (aw *ArrowWriter) Flush() error {
+	if aw.schema == nil {
+		return errors.New("header not written")
+	}
+	if aw.n > 0 {
+		if err := aw.writeBatch(); err != nil {
+			return err
+		}
+	}
+	aw.builder.Release()
+	return aw.ipcw.Close()
+}
@@ -0,0 +1,222 @@
+// Package output provides writers for the join results, in the CSV, TSV, JSON Lines and Arrow IPC formats.
+package output
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mppj"
+	"strconv"
+	"strings"
+)
+
+// ColumnType is the type of a result column. The values are decrypted as strings, and parsed into their
+// column's type by the typed formats (JSON Lines and Arrow). Empty values of non-string columns are null.
+type ColumnType string
+
+const (
+	String  ColumnType = "string"
+	Int64   ColumnType = "int64"
+	Float64 ColumnType = "float64"
+	Bool    ColumnType = "bool"
+)
+
+// ColumnTypes maps the source IDs to the type of their column. Columns without type are strings.
+type ColumnTypes map[mppj.SourceID]ColumnType
+
+// ParseColumnTypes parses a comma-separated list of source=type pairs, e.g., "ds1=int64,ds2=string".
+func ParseColumnTypes(spec string) (ColumnTypes, error) {
+	types := make(map[mppj.SourceID]string)
+	if spec == "" {
+		return ColumnTypes{}, nil
+	}
+	for _, s := range strings.Split(spec, ",") {
+		id, typ, ok := strings.Cut(s, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid column type: %q", s)
+		}
+		types[mppj.SourceID(id)] = typ
+	}
+	return NewColumnTypes(types)
+}
+
+// NewColumnTypes checks the names of the types of the columns, e.g., as declared by a session manifest.
+func NewColumnTypes(types map[mppj.SourceID]string) (ColumnTypes, error) {
+	ct := make(ColumnTypes, len(types))
+	for id, typ := range types {
+		switch t := ColumnType(typ); t {
+		case String, Int64, Float64, Bool:
+			ct[id] = t
+		default:
+			return nil, fmt.Errorf("unknown column type: %q", typ)
+		}
+	}
+	return ct, nil
+}
+
+func (ct ColumnTypes) of(sourceIDs []mppj.SourceID) []ColumnType {
+	types := make([]ColumnType, len(sourceIDs))
+	for i, id := range sourceIDs {
+		types[i] = String
+		if t, ok := ct[id]; ok {
+			types[i] = t
+		}
+	}
+	return types
+}
+
+// Formats lists the supported output formats.
+var Formats = []string{"csv", "tsv", "jsonl", "arrow"}
+
+// NewWriter returns a writer to w for the format. The column types are ignored by the untyped formats.
+func NewWriter(format string, w io.Writer, types ColumnTypes) (mppj.RowWriter, error) {
+	switch format {
+	case "csv":
+		return NewCSVWriter(w), nil
+	case "tsv":
+		return NewTSVWriter(w), nil
+	case "jsonl":
+		return NewJSONLinesWriter(w, types), nil
+	case "arrow":
+		return NewArrowWriter(w, types), nil
+	default:
+		return nil, fmt.Errorf("unknown output format: %q", format)
+	}
+}
+
+// CSVWriter writes the results as CSV, with a header of source IDs.
+type CSVWriter struct {
+	w *csv.Writer
+}
+
+func NewCSVWriter(w io.Writer) *CSVWriter {
+	return &CSVWriter{w: csv.NewWriter(w)}
+}
+
+func (cw *CSVWriter) WriteHeader(sourceIDs []mppj.SourceID) error {
+	header := make([]string, len(sourceIDs))
+	for i, sid := range sourceIDs {
+		header[i] = string(sid)
+	}
+	return cw.w.Write(header)
+}
+
+func (cw *CSVWriter) WriteRow(values []string) error {
+	return cw.w.Write(values)
+}
+
+func (cw *CSVWriter) Flush() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+// TSVWriter writes the results as tab-separated values. Since TSV has no quoting, tabs and line breaks
+// in the values are escaped as \t, \n and \r, and backslashes as \\.
+type TSVWriter struct {
+	w *bufio.Writer
+}
+
+func NewTSVWriter(w io.Writer) *TSVWriter {
+	return &TSVWriter{w: bufio.NewWriter(w)}
+}
+
+var tsvEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+func (tw *TSVWriter) writeLine(fields []string) error {
+	for i, f := range fields {
+		if i > 0 {
+			if err := tw.w.WriteByte('\t'); err != nil {
+				return err
+			}
+		}
+		if _, err := tsvEscaper.WriteString(tw.w, f); err != nil {
+			return err
+		}
+	}
+	return tw.w.WriteByte('\n')
+}
+
+func (tw *TSVWriter) WriteHeader(sourceIDs []mppj.SourceID) error {
+	header := make([]string, len(sourceIDs))
+	for i, sid := range sourceIDs {
+		header[i] = string(sid)
+	}
+	return tw.writeLine(header)
+}
+
+func (tw *TSVWriter) WriteRow(values []string) error {
+	return tw.writeLine(values)
+}
+
+func (tw *TSVWriter) Flush() error {
+	return tw.w.Flush()
+}
+
+// JSONLinesWriter writes each result row as a JSON object, with the source IDs as field names.
+type JSONLinesWriter struct {
+	w         *bufio.Writer
+	types     ColumnTypes
+	sourceIDs []mppj.SourceID
+	colTypes  []ColumnType
+}
+
+func NewJSONLinesWriter(w io.Writer, types ColumnTypes) *JSONLinesWriter {
+	return &JSONLinesWriter{w: bufio.NewWriter(w), types: types}
+}
+
+func (jw *JSONLinesWriter) WriteHeader(sourceIDs []mppj.SourceID) error {
+	jw.sourceIDs = sourceIDs
+	jw.colTypes = jw.types.of(sourceIDs)
+	return nil
+}
+
+func (jw *JSONLinesWriter) WriteRow(values []string) error {
+	if len(values) != len(jw.sourceIDs) {
+		return fmt.Errorf("row has %d values, expected %d", len(values), len(jw.sourceIDs))
+	}
+	line := []byte{'{'}
+	for i, v := range values {
+		if i > 0 {
+			line = append(line, ',')
+		}
+		line = strconv.AppendQuote(line, string(jw.sourceIDs[i]))
+		line = append(line, ':')
+		val, err := jsonValue(jw.colTypes[i], v)
+		if err != nil {
+			return fmt.Errorf("column %s: %w", jw.sourceIDs[i], err)
+		}
+		line = append(line, val...)
+	}
+	line = append(line, '}', '\n')
+	_, err := jw.w.Write(line)
+	return err
+}
+
+func (jw *JSONLinesWriter) Flush() error {
+	return jw.w.Flush()
+}
+
+// jsonValue returns the JSON encoding of the value v of type t.
+func jsonValue(t ColumnType, v string) ([]byte, error) {
+	if t != String && v == "" {
+		return []byte("null"), nil
+	}
+	var val any
+	var err error
+	switch t {
+	case Int64:
+		val, err = strconv.ParseInt(v, 10, 64)
+	case Float64:
+		val, err = strconv.ParseFloat(v, 64)
+	case Bool:
+		val, err = strconv.ParseBool(v)
+	default:
+		val = v
+	}
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(val)
+}
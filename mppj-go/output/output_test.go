@@ -0,0 +1,91 @@
+package output
+
+import (
+	"bytes"
+	"mppj"
+	"testing"
+
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/stretchr/testify/require"
+)
+
+var testSourceIDs = []mppj.SourceID{"ds1", "ds2"}
+
+func testTable() mppj.JoinTable {
+	t := mppj.NewJoinTable(testSourceIDs)
+	t.Insert(map[mppj.SourceID]string{"ds1": "42", "ds2": "a,b"})
+	t.Insert(map[mppj.SourceID]string{"ds1": "", "ds2": "c\td"})
+	return t
+}
+
+func TestWriters(t *testing.T) {
+	types := ColumnTypes{"ds1": Int64}
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"csv", "ds1,ds2\n42,\"a,b\"\n,c\td\n"},
+		{"tsv", "ds1\tds2\n42\ta,b\n\tc\\td\n"},
+		{"jsonl", "{\"ds1\":42,\"ds2\":\"a,b\"}\n{\"ds1\":null,\"ds2\":\"c\\td\"}\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			w, err := NewWriter(test.format, &buf, types)
+			require.NoError(t, err)
+			require.NoError(t, testTable().WriteRows(w))
+			require.Equal(t, test.want, buf.String())
+		})
+	}
+
+	_, err := NewWriter("xml", nil, types)
+	require.Error(t, err)
+}
+
+func TestArrowWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter("arrow", &buf, ColumnTypes{"ds1": Int64})
+	require.NoError(t, err)
+	require.NoError(t, testTable().WriteRows(w))
+
+	r, err := ipc.NewReader(&buf)
+	require.NoError(t, err)
+	defer r.Release()
+
+	require.Equal(t, "ds1", r.Schema().Field(0).Name)
+	require.Equal(t, "int64", r.Schema().Field(0).Type.Name())
+	require.Equal(t, "utf8", r.Schema().Field(1).Type.Name())
+
+	require.True(t, r.Next())
+	rec := r.Record()
+	require.EqualValues(t, 2, rec.NumRows())
+	ds1 := rec.Column(0).(*array.Int64)
+	require.Equal(t, int64(42), ds1.Value(0))
+	require.True(t, ds1.IsNull(1))
+	ds2 := rec.Column(1).(*array.String)
+	require.Equal(t, "a,b", ds2.Value(0))
+	require.Equal(t, "c\td", ds2.Value(1))
+	require.False(t, r.Next())
+}
+
+func TestWriterInvalidValue(t *testing.T) {
+	table := mppj.NewJoinTable(testSourceIDs)
+	table.Insert(map[mppj.SourceID]string{"ds1": "not a number", "ds2": "x"})
+	for _, format := range []string{"jsonl", "arrow"} {
+		w, err := NewWriter(format, new(bytes.Buffer), ColumnTypes{"ds1": Int64})
+		require.NoError(t, err)
+		require.Error(t, table.WriteRows(w), format)
+	}
+}
+
+func TestParseColumnTypes(t *testing.T) {
+	types, err := ParseColumnTypes("ds1=int64,ds2=bool")
+	require.NoError(t, err)
+	require.Equal(t, ColumnTypes{"ds1": Int64, "ds2": Bool}, types)
+
+	_, err = ParseColumnTypes("ds1")
+	require.Error(t, err)
+	_, err = ParseColumnTypes("ds1=decimal")
+	require.Error(t, err)
+}
@@ -1,73 +1,115 @@
 package mppj
 
 import (
+	"context"
 	"fmt"
-	"math/rand/v2"
+	"iter"
 	"runtime"
+	"slices"
 	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type DataSource struct {
-	sid []byte
-	rpk PublicKeyTuple
+	sid  []byte
+	rpk  PublicKeyTuple
+	norm Normalization
+	pool *EncryptionPool // optional, see UsePool
+	rand *Rand
 }
 
 func NewDataSource(sid []byte, rpk PublicKeyTuple) *DataSource {
-	return &DataSource{sid: sid, rpk: rpk}
+	return &DataSource{sid: sid, rpk: rpk, rand: SecureRand()}
+}
+
+// NewDataSourceWithNormalization creates a data source which normalizes the join keys with norm before
+// processing them. The source uses the session ID norm.BindSessionID(sid), which the helper and the
+// receiver must use as well.
+func NewDataSourceWithNormalization(sid []byte, rpk PublicKeyTuple, norm Normalization) *DataSource {
+	return &DataSource{sid: norm.BindSessionID(sid), rpk: rpk, norm: norm, rand: SecureRand()}
+}
+
+// UseRand makes the source take its randomness from r instead of crypto/rand, e.g., a seeded Rand for
+// reproducible runs. The pairs of a pool are still taken in the order in which the rows are prepared, so
+// runs with a pool are not reproducible.
+func (s *DataSource) UseRand(r *Rand) {
+	s.rand = r
 }
 
 // Prepare prepares a table for joining by adding hashing the UIDs and encrypting its contents towards the receiver.
 func (s *DataSource) Prepare(rpk PublicKeyTuple, table TablePlain) (EncTable, error) {
 
-	preparedTable := make(EncTable, len(table))
+	preparedTable := make(EncTable, 0, len(table))
 
-	encRows, err := s.PrepareStream(rpk, table)
+	encRows, wait, err := s.PrepareStream(context.Background(), rpk, table)
 	if err != nil {
 		return nil, err
 	}
 
-	i := 0
 	for encRow := range encRows {
-		preparedTable[i] = encRow
-		i++
+		preparedTable = append(preparedTable, encRow)
+	}
+	if err := wait(); err != nil {
+		return nil, err
 	}
-	if i != len(table) {
+	if len(preparedTable) != len(table) {
 		return nil, fmt.Errorf("number of prepared elements do not match")
 	}
 
 	return preparedTable, nil
 }
 
-// Prepare prepares a table for joining by adding hashing the UIDs and encrypting its contents towards the receiver.
-func (s *DataSource) PrepareStream(rpk PublicKeyTuple, table TablePlain, ncpu ...int) (encRows <-chan EncRow, err error) {
-	var wg sync.WaitGroup
-
-	rows := make(chan TableRow, len(table))
+// PrepareStream prepares the rows of a table in parallel, and sends them in a random order on encRows. The
+// channel is closed once all rows are prepared, on the first error, or when ctx is done. The returned wait
+// function then returns the first error or the cause of the context's cancellation, if any. The caller must
+// read encRows until it is closed, or cancel ctx to stop the preparation.
+func (s *DataSource) PrepareStream(ctx context.Context, rpk PublicKeyTuple, table TablePlain, ncpu ...int) (encRows <-chan EncRow, wait func() error, err error) {
+	table, err = s.norm.ApplyTable(table)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	encRowsChan := make(chan EncRow, len(table))
-	//fmt.Printf("tasks: %d\n", len(table))
+	ctx, cancel := context.WithCancelCause(ctx)
+	ctx, span := tracer.Start(ctx, "source.prepare", trace.WithAttributes(attribute.Int("mppj.rows", len(table))))
+	hash, encrypt := newPhase(ctx, "source.hash"), newPhase(ctx, "source.encrypt")
 
 	n := runtime.NumCPU()
 	if len(ncpu) > 0 && ncpu[0] > 0 {
 		n = ncpu[0]
 	}
 
+	type task struct {
+		i   int // the position of the row in the permuted table
+		row TableRow
+		rnd *Rand
+	}
+	type prepared struct {
+		i   int
+		row EncRow
+	}
+	tasks := make(chan task, n)
+	results := make(chan prepared, n)
+	encRowsChan := make(chan EncRow, len(table))
+
+	var wg sync.WaitGroup
 	for range n {
 		wg.Add(1)
 		go func() {
-
-			i := 0
-			for task := range rows {
-
-				cuid, cval, err := s.ProcessRow(task.uid, task.val)
+			defer wg.Done()
+			for task := range tasks {
+				cuid, cval, err := s.processRow(task.row.uid, task.row.val, task.rnd, hash, encrypt)
 				if err != nil {
+					cancel(err)
+					return
+				}
+				select {
+				case results <- prepared{i: task.i, row: EncRow{Cuid: cuid, Cval: cval}}:
+				case <-ctx.Done():
 					return
 				}
-				encRowsChan <- EncRow{Cuid: cuid, Cval: cval}
-				i++
 			}
-			//fmt.Printf("worker processed %d\n", i)
-			wg.Done()
 		}()
 	}
 
@@ -76,20 +118,182 @@ func (s *DataSource) PrepareStream(rpk PublicKeyTuple, table TablePlain, ncpu ..
 		for uid := range table {
 			uids = append(uids, uid)
 		}
-		perm := rand.Perm(len(uids)) // TODO: use secure random source
-		for _, uid := range perm {
-			rows <- TableRow{uid: uids[uid], val: table[uids[uid]]}
+		slices.Sort(uids) // the map's order is random, but not reproducible
+		perm := s.rand.Perm(len(uids))
+		streams := s.rand.split()
+	loop:
+		for i, j := range perm {
+			select {
+			case tasks <- task{i: i, row: TableRow{uid: uids[j], val: table[uids[j]]}, rnd: streams(i)}:
+			case <-ctx.Done():
+				break loop
+			}
 		}
-		close(rows)
+		close(tasks)
 		wg.Wait()
+		close(results)
+	}()
+
+	var result error
+	done := make(chan struct{})
+	go func() {
+		// sends the rows in the permuted order rather than in the order they are prepared in, so that the
+		// output only depends on the source's randomness
+		pending := make(map[int]EncRow)
+		next := 0
+		for res := range results {
+			pending[res.i] = res.row
+			for row, ok := pending[next]; ok; row, ok = pending[next] {
+				delete(pending, next)
+				encRowsChan <- row // does not block, as the channel has room for all rows
+				next++
+			}
+		}
+		result = context.Cause(ctx)
+		hash.record()
+		encrypt.record()
+		EndSpan(span, result)
+		cancel(nil)
 		close(encRowsChan)
+		close(done)
+	}()
+
+	wait = func() error {
+		<-done
+		return result
+	}
+	return encRowsChan, wait, nil
+}
+
+// PrepareExternal prepares the rows read from an iterator and adds them to the external shuffler es, so
+// that tables larger than the memory can be prepared. The prepared rows are then read from es.Rows(). As for
+// PrepareStream, the normalized keys must be unique: once the rows are added, es checks the keys of all the
+// rows it holds, and ErrDuplicateKey is returned otherwise. When ctx is done, the reading of the rows stops
+// and the cause of the cancellation is returned.
+func (s *DataSource) PrepareExternal(ctx context.Context, rows iter.Seq2[string, string], es *ExternalShuffler, ncpu ...int) (err error) {
+	ctx, span := tracer.Start(ctx, "source.prepare")
+	hash, encrypt := newPhase(ctx, "source.hash"), newPhase(ctx, "source.encrypt")
+	shuffle := newPhase(ctx, "source.shuffle")
+	i := 0
+	defer func() {
+		hash.record()
+		encrypt.record()
+		shuffle.record()
+		span.SetAttributes(attribute.Int("mppj.rows", i))
+		EndSpan(span, err)
 	}()
 
-	return encRowsChan, nil
+	n := runtime.NumCPU()
+	if len(ncpu) > 0 && ncpu[0] > 0 {
+		n = ncpu[0]
+	}
+
+	type task struct {
+		row TableRow
+		rnd *Rand
+	}
+	tasks := make(chan task, n)
+	errs := make(chan error, n)
+	failed := make(chan struct{})
+	var once sync.Once
+	var wg sync.WaitGroup
+	for range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for task := range tasks {
+				if ctx.Err() != nil {
+					continue // drains the tasks
+				}
+				uid, err := s.norm.Apply(task.row.uid)
+				var cuid *Ciphertext
+				var cval []*Ciphertext
+				if err == nil {
+					err = es.addKey(uid)
+				}
+				if err == nil {
+					cuid, cval, err = s.processRow(uid, task.row.val, task.rnd, hash, encrypt)
+				}
+				if err == nil {
+					t := shuffle.begin()
+					err = es.add(EncRow{Cuid: cuid, Cval: cval}, task.rnd)
+					shuffle.done(t)
+				}
+				if err != nil {
+					errs <- err
+					once.Do(func() { close(failed) })
+					for range tasks {
+						// drains the tasks
+					}
+					return
+				}
+			}
+		}()
+	}
+
+	streams := s.rand.split()
+loop:
+	for uid, val := range rows {
+		select {
+		case tasks <- task{row: TableRow{uid: uid, val: val}, rnd: streams(i)}:
+			i++
+		case <-failed:
+			break loop
+		case <-ctx.Done():
+			break loop
+		}
+	}
+	close(tasks)
+	wg.Wait()
+	close(errs)
+	if err := <-errs; err != nil {
+		return err
+	}
+	if err := context.Cause(ctx); err != nil {
+		return err
+	}
+	return es.checkKeys()
 }
 
+// ProcessRow normalizes the uid, then hashes and encrypts it and encrypts the value towards the receiver.
 func (s *DataSource) ProcessRow(uid, val string) (cuid *Ciphertext, cval []*Ciphertext, err error) {
-	cuid = OPRFBlind(s.rpk.bpk, []byte(uid), s.sid)
-	cval, err = PKEEncryptVector(s.rpk.epk, []byte(val))
+	uid, err = s.norm.Apply(uid)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s.processRow(uid, val, s.rand, nil, nil)
+}
+
+// processRow is ProcessRow without the normalization, with the randomness taken from rnd. The hashing of
+// the uid and the encryption of the value are measured in the phases hash and encrypt.
+func (s *DataSource) processRow(uid, val string, rnd *Rand, hash, encrypt *phase) (cuid *Ciphertext, cval []*Ciphertext, err error) {
+	if s.pool != nil {
+		return s.processRowPrecomputed(uid, val, rnd, hash, encrypt)
+	}
+	t := hash.begin()
+	cuid = oprfBlind(s.rpk.bpk, []byte(uid), s.sid, rnd)
+	hash.done(t)
+	t = encrypt.begin()
+	cval, err = pkeEncryptVector([]byte(val), func(m *Message) (*Ciphertext, error) {
+		return pkeEncrypt(s.rpk.epk, m, rnd), nil
+	})
+	encrypt.done(t)
+	return
+}
+
+// processRowPrecomputed is processRow with the encryption randomness taken from the source's pool. The uid
+// is blinded as in OPRFBlind. Once the pool is exhausted, the randomness is taken from rnd.
+func (s *DataSource) processRowPrecomputed(uid, val string, rnd *Rand, hash, encrypt *phase) (cuid *Ciphertext, cval []*Ciphertext, err error) {
+	t := hash.begin()
+	cuid, err = s.pool.encrypt(poolBlind, s.rpk.bpk, HashToMessage([]byte(uid), s.sid), rnd)
+	hash.done(t)
+	if err != nil {
+		return nil, nil, err
+	}
+	t = encrypt.begin()
+	cval, err = pkeEncryptVector([]byte(val), func(m *Message) (*Ciphertext, error) {
+		return s.pool.encrypt(poolValue, s.rpk.epk, m, rnd)
+	})
+	encrypt.done(t)
 	return
 }
@@ -1,16 +1,25 @@
 package mppj
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"math/big"
-	"math/rand/v2"
 	"runtime"
+	"slices"
 	"sync"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Helper struct {
 	sid           []byte
+	sources       []SourceID
 	sourceIndices map[SourceID]int
+	nRows         int // per source
+	rand          *Rand
 
 	convK        *OPRFKey
 	padKeyShares []*Scalar
@@ -20,20 +29,25 @@ type Helper struct {
 
 // NewHelper creates a new Helper with the given key.
 func NewHelper(sid []byte, sources []SourceID, nRows int) *Helper {
-	c := &Helper{sid: sid, sourceIndices: make(map[SourceID]int)}
+	return NewHelperWithRand(sid, sources, nRows, SecureRand())
+}
+
+// NewHelperWithRand creates a new Helper which takes its randomness from r instead of crypto/rand, e.g., a
+// seeded Rand for reproducible runs.
+func NewHelperWithRand(sid []byte, sources []SourceID, nRows int, r *Rand) *Helper {
+	c := &Helper{sid: sid, sources: slices.Clone(sources), sourceIndices: make(map[SourceID]int), nRows: nRows, rand: r}
 	for i, source := range sources {
 		c.sourceIndices[source] = i
 	}
 	c.resetKey()
 	c.genNonces(len(sources))
-	c.rowPerm = rand.Perm(nRows * len(sources)) // TODO: proper RNG
+	c.rowPerm = r.Perm(nRows * len(sources))
 	return c
 }
 
 // resetKey generates a new  random key for the Helper.
 func (h *Helper) resetKey() {
-	k := OPRFKeyGen()
-	h.convK = k
+	h.convK = oprfKeyGen(h.rand)
 }
 
 func (h *Helper) getK() *OPRFKey {
@@ -46,7 +60,7 @@ func (h *Helper) genNonces(tableAmount int) {
 
 	nonces := make([]*Scalar, tableAmount)
 	for i := range tableAmount {
-		s := RandomScalar()
+		s := h.rand.Scalar()
 
 		nonces[i] = s
 		nonceSum = nonceSum.Add(s)
@@ -58,26 +72,45 @@ func (h *Helper) genNonces(tableAmount int) {
 }
 
 // blindAndHint produces an "ad" ciphertext, a blinded key, and a hint
-func (h *Helper) blindAndHint(rpk PublicKeyTuple, joinid *Ciphertext, value []*Ciphertext, tindex int) ([]byte, *Ciphertext, *Ciphertext, error) {
-
-	rp, key := RandomKeyFromPoint(h.sid)
+func (h *Helper) blindAndHint(rpk PublicKeyTuple, joinid *Ciphertext, value []*Ciphertext, tindex int, rnd *Rand) ([]byte, *Ciphertext, *Ciphertext, error) {
 
-	serialized, err := SerializeCiphertexts(ReRandVector(rpk.epk, value))
+	rp, ad, err := h.encryptValue(rpk, value, tindex, rnd)
 	if err != nil {
 		return nil, nil, nil, err
 	}
 
+	blindkey, hint := h.blindKeyAndHint(rpk, joinid, rp, tindex, rnd)
+
+	return ad, blindkey, hint, nil
+}
+
+// encryptValue re-randomizes the value and encrypts it with a key derived from a fresh random point rp.
+func (h *Helper) encryptValue(rpk PublicKeyTuple, value []*Ciphertext, tindex int, rnd *Rand) (*Point, []byte, error) {
+
+	rp, key := randomKeyFromPoint(h.sid, rnd)
+
+	serialized, err := SerializeCiphertexts(reRandVector(rpk.epk, value, rnd))
+	if err != nil {
+		return nil, nil, err
+	}
+
 	ad, err := SymmetricEncrypt(key, append([]byte{byte(tindex)}, serialized...)) // append the table pos for in order reconstruction
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, nil, err
 	}
 
-	blindkey := OPRFEval((*OPRFKey)(h.padKey), rpk.bpk, joinid) // ReRand internally
-	blindkey.c1 = Mul(blindkey.c1, rp)                          // blind the ephemeral point using joinid ^ s
+	return rp, ad, nil
+}
 
-	hint := OPRFEval((*OPRFKey)(h.padKeyShares[tindex]), rpk.bpk, joinid) // ReRand internally
+// blindKeyAndHint produces the blinded key for rp and the hint for the joinid.
+func (h *Helper) blindKeyAndHint(rpk PublicKeyTuple, joinid *Ciphertext, rp *Point, tindex int, rnd *Rand) (*Ciphertext, *Ciphertext) {
 
-	return ad, blindkey, hint, nil
+	blindkey := oprfEval((*OPRFKey)(h.padKey), rpk.bpk, joinid, rnd) // ReRand internally
+	blindkey.c1 = Mul(blindkey.c1, rp)                               // blind the ephemeral point using joinid ^ s
+
+	hint := oprfEval((*OPRFKey)(h.padKeyShares[tindex]), rpk.bpk, joinid, rnd) // ReRand internally
+
+	return blindkey, hint
 }
 
 // Convert performs DH-PRF on the hashed identifiers, blinds the data, then rerandomizes and shuffles all ciphertexts. GenNonces does not neet to be run before this function.
@@ -97,7 +130,7 @@ func (h *Helper) Convert(rpk PublicKeyTuple, tables map[SourceID]EncTable) (EncT
 		close(encRowsTasks)
 	}()
 
-	return h.ConvertTablesStream(rpk, encRowsTasks)
+	return h.ConvertTablesStream(context.Background(), rpk, encRowsTasks)
 }
 
 type TableIndex int
@@ -107,49 +140,155 @@ type ConvertRowTask struct {
 	TableIndex TableIndex
 }
 
-func (h *Helper) ConvertTablesStream(rpk PublicKeyTuple, encRowsTasks chan ConvertRowTask) (EncTableWithHint, error) {
+// ConvertTablesStream converts the incoming rows into a table in memory, see ConvertTablesStreamTo.
+func (h *Helper) ConvertTablesStream(ctx context.Context, rpk PublicKeyTuple, encRowsTasks chan ConvertRowTask) (EncTableWithHint, error) {
+	res := make(EncTableWithHint, len(h.rowPerm))
+	if err := h.ConvertTablesStreamTo(ctx, rpk, encRowsTasks, res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// NumRows returns the total number of rows expected by the helper, over all sources.
+func (h *Helper) NumRows() int {
+	return len(h.rowPerm)
+}
+
+// ConvertTablesStreamTo converts the incoming rows and puts them in the store at their permuted positions.
+// The store must have NumRows() positions, and each source must send the number of rows given to NewHelper.
+// The k-th row of the i-th source is put at a position which only depends on i and k, and not on how the
+// rows of the sources are interleaved. On the first error, the remaining rows are drained without being
+// converted, and the error is returned once encRowsTasks is closed. When ctx is done, the workers stop
+// without draining encRowsTasks, and the cause of the cancellation is returned.
+func (h *Helper) ConvertTablesStreamTo(ctx context.Context, rpk PublicKeyTuple, encRowsTasks chan ConvertRowTask, store RowStore) (err error) {
 
 	if h.padKey == nil || h.padKeyShares == nil {
-		return nil, errors.New("nonceerr, Nonces not generated. Please call GenNonces() before calling this function")
+		return errors.New("nonceerr, Nonces not generated. Please call GenNonces() before calling this function")
 	}
 
-	res := make(EncTableWithHint, len(h.rowPerm))
-	permIndex := 0
-	mu := new(sync.Mutex)
+	if store.Len() != len(h.rowPerm) {
+		return fmt.Errorf("store has %d positions, expected %d", store.Len(), len(h.rowPerm))
+	}
+
+	ctx, span := tracer.Start(ctx, "helper.convert", trace.WithAttributes(attribute.Int("mppj.rows", len(h.rowPerm))))
+	oprf, blind := newPhase(ctx, "helper.oprf_eval"), newPhase(ctx, "helper.blind")
+	shuffle := newPhase(ctx, "helper.shuffle") // puts the rows at their permuted positions
+	defer func() {
+		oprf.record()
+		blind.record()
+		shuffle.record()
+		EndSpan(span, err)
+	}()
+
+	var once sync.Once
+	var convErr error
+	var failed atomic.Bool
+	fail := func(err error) {
+		once.Do(func() { convErr = err })
+		failed.Store(true)
+	}
+
+	type task struct {
+		ConvertRowTask
+		pos int
+		rnd *Rand
+	}
+	tasks := make(chan task, runtime.NumCPU())
 
 	var wg sync.WaitGroup
 	for range runtime.NumCPU() {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			for encRow := range encRowsTasks {
-				convRow, err := h.ConvertRow(rpk, &encRow.EncRowMsg, int(encRow.TableIndex))
+			for task := range tasks {
+				if failed.Load() || ctx.Err() != nil {
+					continue // drains the tasks
+				}
+				convRow, err := h.convertRow(rpk, &task.EncRowMsg, int(task.TableIndex), task.rnd, oprf, blind)
 				if err != nil {
-					panic(err)
+					fail(err)
+					continue
 				}
-				mu.Lock()
-				if permIndex >= len(h.rowPerm) {
-					panic("conversion received more rows than expected")
+				t := shuffle.begin()
+				if err := store.Put(task.pos, *convRow); err != nil {
+					fail(err)
 				}
-				res[h.rowPerm[permIndex]] = *convRow
-				permIndex++
-				mu.Unlock()
+				shuffle.done(t)
 			}
 		}()
 	}
 
+	// the positions and the randomness are assigned in the order of the rows of each source
+	streams := h.rand.split()
+	counts := make([]int, len(h.padKeyShares))
+loop:
+	for {
+		var encRow ConvertRowTask
+		var ok bool
+		select {
+		case encRow, ok = <-encRowsTasks:
+		case <-ctx.Done():
+			break loop
+		}
+		if !ok {
+			break loop
+		}
+		if failed.Load() {
+			continue // drains the rows
+		}
+		tindex := int(encRow.TableIndex)
+		if tindex < 0 || tindex >= len(counts) {
+			fail(fmt.Errorf("%w: %d", ErrInvalidSourceIndex, tindex))
+			continue
+		}
+		if counts[tindex] >= h.nRows {
+			fail(fmt.Errorf("%w: the conversion expects %d rows per source", ErrTooManyRows, h.nRows))
+			continue
+		}
+		i := tindex*h.nRows + counts[tindex]
+		counts[tindex]++
+		tasks <- task{ConvertRowTask: encRow, pos: h.rowPerm[i], rnd: streams(i)}
+	}
+	close(tasks)
 	wg.Wait()
 
-	return res, nil
+	if convErr == nil && ctx.Err() != nil {
+		return context.Cause(ctx)
+	}
+	var n int
+	for _, c := range counts {
+		n += c
+	}
+	if convErr == nil && n < len(h.rowPerm) {
+		return fmt.Errorf("%w: the conversion expects %d rows, got %d", ErrTooFewRows, len(h.rowPerm), n)
+	}
+	return convErr
 }
 
 func (h *Helper) ConvertRow(rpk PublicKeyTuple, r *EncRow, rid int) (*EncRowWithHint, error) {
+	return h.convertRow(rpk, r, rid, h.rand, nil, nil)
+}
+
+// convertRow is ConvertRow with the randomness taken from rnd. The OPRF evaluation and the blinding are
+// measured in the phases oprf and blind.
+func (h *Helper) convertRow(rpk PublicKeyTuple, r *EncRow, rid int, rnd *Rand, oprf, blind *phase) (*EncRowWithHint, error) {
+
+	if rid < 0 || rid >= len(h.padKeyShares) {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidSourceIndex, rid)
+	}
+	if r.Cuid == nil || len(r.Cval) == 0 || slices.Contains(r.Cval, nil) {
+		return nil, fmt.Errorf("%w: missing ciphertexts", ErrInvalidRow)
+	}
 
-	joinid := *OPRFEval(h.convK, rpk.bpk, r.Cuid) // ReRand internally
+	t := oprf.begin()
+	joinid := *oprfEval(h.convK, rpk.bpk, r.Cuid, rnd) // ReRand internally
+	oprf.done(t)
 
-	ad, blindedkey, hint, err := h.blindAndHint(rpk, &joinid, r.Cval, rid)
+	t = blind.begin()
+	ad, blindedkey, hint, err := h.blindAndHint(rpk, &joinid, r.Cval, rid, rnd)
+	blind.done(t)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 	return &EncRowWithHint{Cnyme: joinid, CVal: ad, CValKey: *blindedkey, CHint: *hint}, nil
 }
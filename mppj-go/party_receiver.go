@@ -1,10 +1,15 @@
 package mppj
 
 import (
+	"context"
+	"encoding/binary"
+	"errors"
 	"fmt"
-	"log"
 	"runtime"
 	"sync"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type Receiver struct {
@@ -51,7 +56,7 @@ func (r *Receiver) getSK() SecretKeyTuple {
 	return r.recvSK
 }
 
-// JoinTables joins the tables using the MPPJ protocol.
+// JoinTables joins the tables using the MPPJ protocol, see JoinTablesStreamTo.
 func (r *Receiver) JoinTables(joinedTables EncTableWithHint, tableAmount int) (JoinTable, error) {
 
 	encrows := make(chan EncRowWithHint, len(joinedTables))
@@ -63,39 +68,229 @@ func (r *Receiver) JoinTables(joinedTables EncTableWithHint, tableAmount int) (J
 		}
 	}()
 
-	return r.JoinTablesStream(encrows, tableAmount)
+	return r.JoinTablesStream(context.Background(), encrows, tableAmount)
+
+}
 
+// JoinTablesStream joins the tables into a table in memory, see JoinTablesStreamTo. The number of skipped
+// groups is reported by the table's Skipped.
+func (r *Receiver) JoinTablesStream(ctx context.Context, in chan EncRowWithHint, numTable int) (JoinTable, error) {
+	join := NewJoinTable(r.sourceIDs)
+	_, skipped, err := r.JoinTablesStreamTo(ctx, in, &join)
+	if err != nil {
+		return JoinTable{}, err
+	}
+	join.skipped = skipped
+	return join, nil
 }
 
-func (r *Receiver) JoinTablesStream(in chan EncRowWithHint, numTable int) (JoinTable, error) {
+// JoinTablesStreamTo joins the tables and writes the joined rows to w as they are decrypted, so that the
+// result is not held in memory. It returns the number of joined rows, and of skipped groups.
+//
+// A group is decrypted as soon as it has one row per source, while the remaining rows are still being
+// received. This assumes that the keys of each source are unique (as for TablePlain), so that complete
+// groups cannot grow further. The incomplete groups are kept in memory until the input is closed, and the
+// PRF outputs of the complete groups until the join ends.
+//
+// A complete group with several rows of a source (whose keys are then not unique) cannot be decrypted, and is
+// skipped. A row received for a group which was already decrypted also reveals several rows of a source in
+// the group, which is then counted as skipped, although its joined row was already written to w and cannot be
+// taken back. The join of the other rows is then completed, and the skipped groups are counted rather than
+// reported by an error.
+//
+// When ctx is done, the workers stop without draining in, and the cause of the cancellation is returned.
+func (r *Receiver) JoinTablesStreamTo(ctx context.Context, in chan EncRowWithHint, w RowWriter) (n, skipped int, err error) {
+
+	if err := w.WriteHeader(r.sourceIDs); err != nil {
+		return 0, 0, err
+	}
+
+	ctx, span := tracer.Start(ctx, "receiver.join")
+	grouping, decrypt := newPhase(ctx, "receiver.group"), newPhase(ctx, "receiver.decrypt")
+	defer func() {
+		grouping.record()
+		decrypt.record()
+		span.SetAttributes(attribute.Int("mppj.rows", n))
+		EndSpan(span, err)
+	}()
+
+	decryptTasks := make(chan groupTask, runtime.NumCPU())
+	wait := r.decryptGroups(ctx, decryptTasks, w, decrypt)
 
 	groups := make(map[string][]EncRowWithHint)
+	dispatched := make(map[string]bool) // the complete groups, true once they are known to be skipped
+	mu := sync.Mutex{}
+	err = r.groupRows(ctx, in, func(prf []byte, row EncRowWithHint) error {
+		mu.Lock()
+		if _, ok := dispatched[string(prf)]; ok {
+			dispatched[string(prf)] = true // a further row of the group
+			mu.Unlock()
+			return nil
+		}
+		group := append(groups[string(prf)], row)
+		if len(group) < len(r.sourceIDs) {
+			groups[string(prf)] = group
+			mu.Unlock()
+			return nil
+		}
+		delete(groups, string(prf))
+		dispatched[string(prf)] = false
+		mu.Unlock()
+		decryptTasks <- groupTask{prf: string(prf), rows: group}
+		return nil
+	}, grouping)
+	close(decryptTasks)
+
+	n, skippedGroups, werr := wait()
+	if err != nil {
+		return n, 0, err
+	}
+	if werr != nil {
+		return n, 0, werr
+	}
+	if err := w.Flush(); err != nil {
+		return n, 0, err
+	}
+	for _, prf := range skippedGroups {
+		dispatched[prf] = true
+	}
+	for _, isSkipped := range dispatched {
+		if isSkipped {
+			skipped++
+		}
+	}
+	return n, skipped, nil
+}
+
+// groupTask is a complete group of rows with the same PRF output, to decrypt.
+type groupTask struct {
+	prf  string
+	rows []EncRowWithHint
+}
+
+// JoinTablesStreamToExternal joins the tables like JoinTablesStreamTo, but without holding all the rows in
+// memory. The rows are partitioned by a prefix of their PRF output into numPartitions temporary files in dir
+// (the system's default if empty), then the partitions are grouped and decrypted one at a time. Since rows
+// with the same PRF output land in the same partition, the memory needed is about the size of
+// n/numPartitions rows. The groups with several rows of a source are skipped and reported as in
+// JoinTablesStreamTo, but none of their rows is written since the groups are complete once the input is closed.
+func (r *Receiver) JoinTablesStreamToExternal(ctx context.Context, in chan EncRowWithHint, w RowWriter, dir string, numPartitions int) (n, skipped int, err error) {
+
+	partitions, err := newSpillFiles(dir, numPartitions)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer partitions.close()
+
+	ctx, span := tracer.Start(ctx, "receiver.join")
+	grouping, decrypt := newPhase(ctx, "receiver.group"), newPhase(ctx, "receiver.decrypt")
+	defer func() {
+		grouping.record()
+		decrypt.record()
+		span.SetAttributes(attribute.Int("mppj.rows", n))
+		EndSpan(span, err)
+	}()
+
+	if err := r.groupRows(ctx, in, func(prf []byte, row EncRowWithHint) error {
+		data, err := row.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		p := int(binary.BigEndian.Uint32(prf[:4]) % uint32(numPartitions)) // the PRF outputs are pseudorandom
+		return partitions.append(p, prf, data)
+	}, grouping); err != nil {
+		return 0, 0, err
+	}
 
+	if err := w.WriteHeader(r.sourceIDs); err != nil {
+		return 0, 0, err
+	}
+	for p := range numPartitions {
+		if err := context.Cause(ctx); err != nil {
+			return n, 0, err
+		}
+		groups := make(map[string][]EncRowWithHint)
+		if err := partitions.read(p, 2, func(fields [][]byte) error {
+			var row EncRowWithHint
+			if err := row.UnmarshalBinary(fields[1]); err != nil {
+				return err
+			}
+			groups[string(fields[0])] = append(groups[string(fields[0])], row)
+			return nil
+		}); err != nil {
+			return n, 0, err
+		}
+		if err := partitions.remove(p); err != nil {
+			return n, 0, err
+		}
+
+		np, sp, err := r.intersectHint(ctx, groups, w, decrypt)
+		n, skipped = n+np, skipped+sp
+		if err != nil {
+			return n, 0, err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return n, 0, err
+	}
+	return n, skipped, nil
+}
+
+// groupRows computes the PRF output of the incoming rows in parallel, and calls add for each row. On the
+// first error, the remaining rows are drained, and the error is returned once in is closed. When ctx is
+// done, the workers stop without draining in, and the cause of the cancellation is returned. The rows'
+// processing is measured in the phase grouping.
+func (r *Receiver) groupRows(ctx context.Context, in chan EncRowWithHint, add func(prf []byte, row EncRowWithHint) error, grouping *phase) error {
 	wg := sync.WaitGroup{}
-	mu := sync.Mutex{}
+	var once sync.Once
+	var groupErr error
+	var failed atomic.Bool
 	for range runtime.NumCPU() {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			for ciphertexts := range in {
+			for {
+				var ciphertexts EncRowWithHint
+				var ok bool
+				select {
+				case ciphertexts, ok = <-in:
+				case <-ctx.Done():
+					return
+				}
+				if !ok {
+					return
+				}
+				if failed.Load() {
+					continue // drains the rows
+				}
+				t := grouping.begin()
 				msgPRF, err := OPRFUnblind(r.recvSK.bsk, &ciphertexts.Cnyme).GetMessageBytes()
 				if err != nil {
-					log.Fatalf("Decryption error: %v", err)
+					err = fmt.Errorf("%w: invalid pseudonym: %v", ErrDecryption, err)
+				} else {
+					err = add(msgPRF, ciphertexts)
+				}
+				grouping.done(t)
+				if err != nil {
+					once.Do(func() { groupErr = err })
+					failed.Store(true)
 				}
-
-				mu.Lock()
-				groups[string(msgPRF)] = append(groups[string(msgPRF)], ciphertexts)
-				mu.Unlock()
 			}
 		}()
 	}
 	wg.Wait()
-
-	return r.intersectHint(groups)
+	if groupErr == nil {
+		return context.Cause(ctx)
+	}
+	return groupErr
 }
 
+// decryptGroup decrypts the values of a complete group. The rows of a source with the same key have the
+// same hint, so that a group with several rows of a source is detected before decrypting it, and ErrDuplicateKey
+// is returned.
 func (r *Receiver) decryptGroup(group []EncRowWithHint) (map[SourceID]string, error) {
 	decGroup := make([]EncValueWithHint, len(group))
+	hints := make([]*Point, len(group))
 
 	for i, ge := range group {
 		decGroup[i] = EncValueWithHint{
@@ -103,57 +298,101 @@ func (r *Receiver) decryptGroup(group []EncRowWithHint) (map[SourceID]string, er
 			blindedkey: *OPRFUnblind(r.recvSK.bsk, &ge.CValKey),
 			hint:       *OPRFUnblind(r.recvSK.bsk, &ge.CHint),
 		}
+		hints[i] = &decGroup[i].hint.m
+	}
+	if !distinctPoints(hints) {
+		return nil, fmt.Errorf("%w: several rows of a source in a group", ErrDuplicateKey)
 	}
 
 	mask := Identity()
-	for _, dge := range decGroup {
-		mask = Mul(mask, &dge.hint.m)
+	for _, hint := range hints {
+		mask = Mul(mask, hint)
 	}
 	invMask := mask.Invert()
 
 	out := make(map[SourceID]string, len(group))
 	for _, dge := range decGroup {
-		keyp := Mul(&dge.blindedkey.m, invMask)
-		key, err := KeyFromPoint(keyp, r.sid)
+		sourceID, val, err := r.decryptValue(dge, invMask)
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
-
-		encAttridValBytes, err := SymmetricDecrypt(key, dge.val)
-		if err != nil {
-			panic(err)
+		if _, ok := out[sourceID]; ok {
+			return nil, fmt.Errorf("%w: several rows of source %s in a group", ErrDecryption, sourceID)
 		}
+		out[sourceID] = val
+	}
+	return out, nil
+}
 
-		if len(encAttridValBytes) == 0 {
-			panic(fmt.Errorf("incorrect encrypted attribute value"))
-		}
+// decryptValue unmasks the value key with invMask, then decrypts the value and its source index.
+func (r *Receiver) decryptValue(dge EncValueWithHint, invMask *Point) (SourceID, string, error) {
+	keyp := Mul(&dge.blindedkey.m, invMask)
+	key, err := KeyFromPoint(keyp, r.sid)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: invalid value key: %v", ErrDecryption, err)
+	}
 
-		sourceIndex, encValBytes := int(encAttridValBytes[0]), encAttridValBytes[1:]
-		if sourceIndex < 0 || sourceIndex >= len(r.sourceIDs) {
-			panic(fmt.Errorf("invalid source index: %d", sourceIndex))
-		}
-		sourceID := r.sourceIDs[sourceIndex]
+	encAttridValBytes, err := SymmetricDecrypt(key, dge.val)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: %v", ErrDecryption, err)
+	}
 
-		encVal, err := DeserializeCiphertexts(encValBytes)
-		if err != nil {
-			panic(err)
-		}
+	if len(encAttridValBytes) == 0 {
+		return "", "", fmt.Errorf("%w: incorrect encrypted attribute value", ErrDecryption)
+	}
 
-		plantext_data, err := PKEDecryptVector(r.recvSK.esk, encVal)
-		if err != nil {
-			panic(err)
-		}
+	sourceIndex, encValBytes := int(encAttridValBytes[0]), encAttridValBytes[1:]
+	if sourceIndex < 0 || sourceIndex >= len(r.sourceIDs) {
+		return "", "", fmt.Errorf("%w: %d", ErrInvalidSourceIndex, sourceIndex)
+	}
+	sourceID := r.sourceIDs[sourceIndex]
 
-		out[sourceID] = string(plantext_data)
+	encVal, err := DeserializeCiphertexts(encValBytes)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: %v", ErrDecryption, err)
 	}
-	return out, nil
+
+	plantext_data, err := PKEDecryptVector(r.recvSK.esk, encVal)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: %v", ErrDecryption, err)
+	}
+
+	return sourceID, string(plantext_data), nil
 }
 
-func (r *Receiver) intersectHint(groups map[string][]EncRowWithHint) (JoinTable, error) {
+// intersectHint decrypts the complete groups of a partition, and writes the joined rows to w. It returns the
+// number of rows written, and of groups skipped for several rows of a source, including those with more rows
+// than sources.
+func (r *Receiver) intersectHint(ctx context.Context, groups map[string][]EncRowWithHint, w RowWriter, decrypt *phase) (n, skipped int, err error) {
+
+	decryptTasks := make(chan groupTask)
+	wait := r.decryptGroups(ctx, decryptTasks, w, decrypt)
+
+	var tooLarge int // the groups with more rows than sources, hence several rows of a source
+	for prf, group := range groups {
+		switch {
+		case len(group) == len(r.sourceIDs):
+			decryptTasks <- groupTask{prf: prf, rows: group}
+		case len(group) > len(r.sourceIDs):
+			tooLarge++
+		}
+	}
+	close(decryptTasks)
 
-	decryptTasks := make(chan []EncRowWithHint)
+	n, skippedGroups, err := wait()
+	return n, len(skippedGroups) + tooLarge, err
+}
 
-	join := NewJoinTable(r.sourceIDs)
+// decryptGroups starts the workers which decrypt the groups received from decryptTasks and write the joined
+// rows to w. The returned function waits for the workers to finish once decryptTasks is closed, and returns
+// the number of rows written and the PRF outputs of the groups skipped for several rows of a source. On the
+// first other error, or when ctx is done, the remaining groups are drained without being decrypted. The
+// decryption of the groups is measured in the phase decrypt.
+func (r *Receiver) decryptGroups(ctx context.Context, decryptTasks <-chan groupTask, w RowWriter, decrypt *phase) (wait func() (n int, skipped []string, err error)) {
+
+	var n int
+	var skipped []string
+	var werr error
 	mu := sync.Mutex{}
 
 	wg := sync.WaitGroup{}
@@ -163,27 +402,42 @@ func (r *Receiver) intersectHint(groups map[string][]EncRowWithHint) (JoinTable,
 			defer wg.Done()
 
 			for dectask := range decryptTasks {
-				vals, err := r.decryptGroup(dectask)
-				if err != nil {
-					panic(err)
+				mu.Lock()
+				failed := werr != nil || ctx.Err() != nil
+				mu.Unlock()
+				if failed {
+					continue // drains the groups
+				}
+
+				var row []string
+				t := decrypt.begin()
+				vals, err := r.decryptGroup(dectask.rows)
+				decrypt.done(t)
+				if err == nil {
+					row, err = rowFromValues(r.sourceIDs, vals)
 				}
 				mu.Lock()
-				if err := join.Insert(vals); err != nil {
-					panic(err)
+				if errors.Is(err, ErrDuplicateKey) {
+					skipped = append(skipped, dectask.prf)
+					err = nil
+				} else if werr == nil && err == nil {
+					if err = w.WriteRow(row); err == nil {
+						n++
+					}
+				}
+				if werr == nil {
+					werr = err
 				}
 				mu.Unlock()
 			}
 		}()
 	}
 
-	for _, group := range groups {
-		if len(group) == len(r.sourceIDs) {
-			decryptTasks <- group
+	return func() (int, []string, error) {
+		wg.Wait()
+		if werr == nil {
+			return n, skipped, context.Cause(ctx)
 		}
+		return n, skipped, werr
 	}
-	close(decryptTasks)
-
-	wg.Wait()
-
-	return join, nil
 }
@@ -0,0 +1,276 @@
+package mppj
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// EncryptionPool is a file of precomputed encryption randomness, i.e., pairs (g^r, pk^r) for the receiver's
+// public keys, which a source computes offline so that its online phase only hashes the keys and multiplies
+// the messages by pk^r. A pair reveals the messages encrypted with it, so the pool file must be kept as
+// secret as the source's data, and a pair must never be used twice. The pool thus marks the pairs as used on
+// disk, and overwrites them with zeros, before they are handed out: pairs might be lost in a crash, but not
+// reused. Note that overwriting a file does not guarantee the erasure of its previous contents on every
+// storage medium.
+type EncryptionPool struct {
+	mu   sync.Mutex
+	f    *os.File
+	bpk  []byte    // the blinding key the pairs were computed for
+	epk  []byte    // the value key the pairs were computed for
+	n    [2]int    // the number of pairs, for the blinding and value key
+	used [2]int    // the number of pairs handed out or buffered
+	buf  [2][]byte // the buffered serialized pairs, already marked as used on disk
+	err  error     // the first I/O error, after which the pool is not used anymore
+}
+
+const (
+	poolBlind = 0 // the pairs for the blinding key bpk
+	poolValue = 1 // the pairs for the value key epk
+)
+
+const (
+	poolMagic      = "MPPJPOOL"
+	poolVersion    = 1
+	poolKeySize    = 33                                       // compressed points
+	poolHeaderSize = len(poolMagic) + 1 + 2*poolKeySize + 4*8 // magic, version, keys, number of pairs, number of used pairs
+	poolPointSize  = 65                                       // uncompressed points, which are faster to load
+	poolPairSize   = 2 * poolPointSize                        //
+	poolChunk      = 1024                                     // the number of pairs read and erased at once
+)
+
+// Precompute generates the encryption randomness for numRows rows with values of at most maxValLen bytes, and
+// stores it in a new pool file at path, for use with UsePool. It fails if the file already exists.
+func (s *DataSource) Precompute(path string, numRows, maxValLen int) error {
+	valCts := maxValLen/PAYLOADSIZE + 1 // accounts for the padding
+	return createEncryptionPool(path, s.rpk, numRows, numRows*valCts, s.rand)
+}
+
+// UsePool makes the source take its encryption randomness from the pool, and encrypt as usual once the pool
+// is exhausted. The pool must have been generated for the source's receiver key.
+func (s *DataSource) UsePool(pool *EncryptionPool) error {
+	bpk, err := (*Point)(s.rpk.bpk).MarshalBinary()
+	if err != nil {
+		return err
+	}
+	epk, err := (*Point)(s.rpk.epk).MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(bpk, pool.bpk) || !bytes.Equal(epk, pool.epk) {
+		return errors.New("the pool was generated for another receiver key")
+	}
+	s.pool = pool
+	return nil
+}
+
+// CreateEncryptionPool generates a pool of nBlind pairs for the blinding key and nValue pairs for the value
+// key of rpk, and stores it in a new file at path. It fails if the file already exists.
+func CreateEncryptionPool(path string, rpk PublicKeyTuple, nBlind, nValue int) error {
+	return createEncryptionPool(path, rpk, nBlind, nValue, SecureRand())
+}
+
+func createEncryptionPool(path string, rpk PublicKeyTuple, nBlind, nValue int, rnd *Rand) (err error) {
+	if nBlind < 0 || nValue < 0 {
+		return errors.New("invalid pool size")
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err = errors.Join(err, f.Close())
+		if err != nil {
+			os.Remove(path)
+		}
+	}()
+
+	p := &EncryptionPool{f: f, n: [2]int{nBlind, nValue}}
+	if p.bpk, err = (*Point)(rpk.bpk).MarshalBinary(); err != nil {
+		return err
+	}
+	if p.epk, err = (*Point)(rpk.epk).MarshalBinary(); err != nil {
+		return err
+	}
+	if err := p.writeHeader(); err != nil {
+		return err
+	}
+
+	for kind, pk := range []*PublicKey{rpk.bpk, rpk.epk} {
+		streams := rnd.split()
+		for start := 0; start < p.n[kind]; start += poolChunk {
+			chunk := make([]byte, min(poolChunk, p.n[kind]-start)*poolPairSize)
+			err := parallelFor(len(chunk)/poolPairSize, func(i int) error {
+				r := streams(start + i).Scalar()
+				gr, err := BaseExp(r).p.MarshalBinary()
+				if err != nil {
+					return err
+				}
+				pkr, err := (*Point)(pk).ScalarExp(r).p.MarshalBinary()
+				if err != nil {
+					return err
+				}
+				copy(chunk[i*poolPairSize:], gr)
+				copy(chunk[i*poolPairSize+poolPointSize:], pkr)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if _, err := f.WriteAt(chunk, p.offset(kind, start)); err != nil {
+				return err
+			}
+		}
+	}
+	return f.Sync()
+}
+
+// OpenEncryptionPool opens an existing pool.
+func OpenEncryptionPool(path string) (*EncryptionPool, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, poolHeaderSize)
+	if _, err := io.ReadFull(f, header); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("invalid encryption pool header: %w", err)
+	}
+	if !bytes.HasPrefix(header, []byte(poolMagic)) {
+		f.Close()
+		return nil, errors.New("invalid encryption pool: bad magic")
+	}
+	h := header[len(poolMagic):]
+	if h[0] != poolVersion {
+		f.Close()
+		return nil, fmt.Errorf("unsupported encryption pool version: %d", h[0])
+	}
+	h = h[1:]
+	p := &EncryptionPool{f: f, bpk: h[:poolKeySize], epk: h[poolKeySize : 2*poolKeySize]}
+	h = h[2*poolKeySize:]
+	for kind := range p.n {
+		p.n[kind] = int(binary.BigEndian.Uint64(h[kind*8:]))
+		p.used[kind] = int(binary.BigEndian.Uint64(h[16+kind*8:]))
+		if p.used[kind] > p.n[kind] {
+			f.Close()
+			return nil, errors.New("invalid encryption pool: more pairs used than available")
+		}
+	}
+	return p, nil
+}
+
+func (p *EncryptionPool) writeHeader() error {
+	header := make([]byte, 0, poolHeaderSize)
+	header = append(header, poolMagic...)
+	header = append(header, poolVersion)
+	header = append(header, p.bpk...)
+	header = append(header, p.epk...)
+	for _, n := range p.n {
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+	for _, used := range p.used {
+		header = binary.BigEndian.AppendUint64(header, uint64(used))
+	}
+	_, err := p.f.WriteAt(header, 0)
+	return err
+}
+
+// offset returns the file offset of the i-th pair of the given kind.
+func (p *EncryptionPool) offset(kind, i int) int64 {
+	off := int64(poolHeaderSize) + int64(i)*int64(poolPairSize)
+	if kind == poolValue {
+		off += int64(p.n[poolBlind]) * int64(poolPairSize)
+	}
+	return off
+}
+
+// Remaining returns the number of pairs which were not handed out yet, for the blinding and value key.
+func (p *EncryptionPool) Remaining() (blind, value int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	remaining := func(kind int) int { return p.n[kind] - p.used[kind] + len(p.buf[kind])/poolPairSize }
+	return remaining(poolBlind), remaining(poolValue)
+}
+
+// take returns a serialized pair of the given kind, or nil if the pool is exhausted.
+func (p *EncryptionPool) take(kind int) ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return nil, p.err
+	}
+	if len(p.buf[kind]) == 0 {
+		if p.err = p.refill(kind); p.err != nil {
+			return nil, p.err
+		}
+		if len(p.buf[kind]) == 0 {
+			return nil, nil
+		}
+	}
+	pair := p.buf[kind][:poolPairSize]
+	p.buf[kind] = p.buf[kind][poolPairSize:]
+	return pair, nil
+}
+
+// refill reads the next chunk of pairs of the given kind into the buffer, after marking them as used and
+// erasing them on disk.
+func (p *EncryptionPool) refill(kind int) error {
+	k := min(poolChunk, p.n[kind]-p.used[kind])
+	if k == 0 {
+		return nil
+	}
+	off := p.offset(kind, p.used[kind])
+	chunk := make([]byte, k*poolPairSize)
+	if _, err := p.f.ReadAt(chunk, off); err != nil {
+		return err
+	}
+
+	p.used[kind] += k
+	if err := p.writeHeader(); err != nil {
+		return err
+	}
+	if _, err := p.f.WriteAt(make([]byte, len(chunk)), off); err != nil {
+		return err
+	}
+	if err := p.f.Sync(); err != nil {
+		return err
+	}
+
+	p.buf[kind] = chunk
+	return nil
+}
+
+// encrypt encrypts msg under pk, with a pair (g^r, pk^r) of the given kind if the pool is not exhausted, and
+// with randomness from rnd otherwise.
+func (p *EncryptionPool) encrypt(kind int, pk *PublicKey, msg *Message, rnd *Rand) (*Ciphertext, error) {
+	pair, err := p.take(kind)
+	if err != nil {
+		return nil, err
+	}
+	if pair == nil {
+		return pkeEncrypt(pk, msg, rnd), nil
+	}
+	gr, pkr := NewPoint(), NewPoint()
+	if err := gr.p.UnmarshalBinary(pair[:poolPointSize]); err != nil {
+		return nil, fmt.Errorf("invalid encryption pool pair: %w", err)
+	}
+	if err := pkr.p.UnmarshalBinary(pair[poolPointSize:]); err != nil {
+		return nil, fmt.Errorf("invalid encryption pool pair: %w", err)
+	}
+	return &Ciphertext{c0: gr, c1: Mul(&msg.m, pkr)}, nil
+}
+
+// Close erases the buffered pairs from memory, as they are already marked as used, and closes the pool's file.
+func (p *EncryptionPool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for kind := range p.buf {
+		clear(p.buf[kind])
+		p.buf[kind] = nil
+	}
+	return p.f.Close()
+}
@@ -0,0 +1,88 @@
+package mppj
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptionPool(t *testing.T) {
+
+	sourceIDs := []SourceID{"ds1", "ds2", "ds3"}
+
+	sid := NewSessionID(3, "helper", "receiver", sourceIDs)
+
+	helper := NewHelper(sid, sourceIDs, ROW_AMOUNT)
+	receiver := NewReceiver(sid, sourceIDs)
+	ds := NewDataSource(sid, receiver.GetPK())
+
+	// the pool covers only part of the rows, the others are encrypted online
+	path := filepath.Join(t.TempDir(), "ds.pool")
+	nRows := 2 * ROW_AMOUNT
+	require.NoError(t, ds.Precompute(path, nRows, 30))
+	require.Error(t, ds.Precompute(path, nRows, 30))
+
+	pool, err := OpenEncryptionPool(path)
+	require.NoError(t, err)
+	require.NoError(t, ds.UsePool(pool))
+	blind, value := pool.Remaining()
+	require.Equal(t, nRows, blind)
+	require.Equal(t, 2*nRows, value)
+
+	tables := GenTestTables(sourceIDs, ROW_AMOUNT, INTERSECTION_SIZE)
+	encTables := make(map[SourceID]EncTable, TABLE_AMOUNT)
+	numCts := 0
+	for sourceID, table := range tables {
+		prepTable, err := ds.Prepare(receiver.GetPK(), table)
+		require.NoError(t, err)
+		encTables[sourceID] = prepTable
+		for _, row := range prepTable {
+			numCts += len(row.Cval)
+		}
+	}
+
+	blind, value = pool.Remaining()
+	require.Equal(t, 0, blind)
+	require.Equal(t, max(0, 2*nRows-numCts), value)
+
+	joinedTables, err := helper.Convert(receiver.GetPK(), encTables)
+	require.NoError(t, err)
+	intersectionMPPJ, err := receiver.JoinTables(joinedTables, len(encTables))
+	require.NoError(t, err)
+
+	joinedTablesPlain := IntersectSimple(tables, sourceIDs)
+	require.True(t, joinedTablesPlain.EqualContents(&intersectionMPPJ))
+
+	require.NoError(t, pool.Close())
+
+	// the used pairs are persisted and erased
+	pool, err = OpenEncryptionPool(path)
+	require.NoError(t, err)
+	defer pool.Close()
+	blind, _ = pool.Remaining()
+	require.Equal(t, 0, blind)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	blindPairs := data[poolHeaderSize : poolHeaderSize+nRows*poolPairSize]
+	require.True(t, bytes.Equal(blindPairs, make([]byte, len(blindPairs))))
+}
+
+func TestEncryptionPoolWrongKey(t *testing.T) {
+	sid := []byte("sid")
+	_, rpk := GetTestKeys([]byte("seed"))
+	_, otherRPK := GetTestKeys([]byte("other seed"))
+
+	path := filepath.Join(t.TempDir(), "ds.pool")
+	require.NoError(t, CreateEncryptionPool(path, rpk, 1, 1))
+
+	pool, err := OpenEncryptionPool(path)
+	require.NoError(t, err)
+	defer pool.Close()
+
+	require.Error(t, NewDataSource(sid, otherRPK).UsePool(pool))
+	require.NoError(t, NewDataSource(sid, rpk).UsePool(pool))
+}
@@ -12,14 +12,21 @@ type OPRFKey Scalar
 
 // OPRFKeyGen generates a new random key for the DH-OPRF.
 func OPRFKeyGen() *OPRFKey {
-	k := RandomScalar()
-	return (*OPRFKey)(k)
+	return oprfKeyGen(secureRand)
+}
+
+func oprfKeyGen(rnd *Rand) *OPRFKey {
+	return (*OPRFKey)(rnd.Scalar())
 }
 
 // OPRFBlind computes the encryption of m using the public key bpk.
 func OPRFBlind(bpk *PublicKey, msg, sid []byte) *Ciphertext {
+	return oprfBlind(bpk, msg, sid, secureRand)
+}
+
+func oprfBlind(bpk *PublicKey, msg, sid []byte, rnd *Rand) *Ciphertext {
 	hmsg := HashToMessage(msg, sid)
-	return PKEEncrypt(bpk, hmsg)
+	return pkeEncrypt(bpk, hmsg, rnd)
 }
 
 // OPRFUnblind computes the decryption of the ciphertext using the secret key bsk.
@@ -29,10 +36,14 @@ func OPRFUnblind(bsk *SecretKey, ciphertext *Ciphertext) *Message {
 
 // OPRFEval computes the encryption of m^k. Computes ReRand internally.
 func OPRFEval(key *OPRFKey, bpk *PublicKey, ciphertext *Ciphertext) *Ciphertext {
+	return oprfEval(key, bpk, ciphertext, secureRand)
+}
+
+func oprfEval(key *OPRFKey, bpk *PublicKey, ciphertext *Ciphertext, rnd *Rand) *Ciphertext {
 	c0 := ciphertext.c0.ScalarExp((*Scalar)(key))
 	c1 := ciphertext.c1.ScalarExp((*Scalar)(key))
 
-	return ReRand(bpk, &Ciphertext{c0: c0, c1: c1})
+	return reRand(bpk, &Ciphertext{c0: c0, c1: c1}, rnd)
 }
 
 // NewSessionID generates a new session ID based on session participants and randomness.
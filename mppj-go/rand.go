@@ -0,0 +1,126 @@
+// This provides the source of randomness of the parties, which is a CSPRNG in production and can be seeded
+// for tests and debugging.
+package mppj
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"math/bits"
+	"sync"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// Rand is a source of randomness for the keys, nonces, encryptions and permutations of the parties. SecureRand
+// reads from crypto/rand. A seeded Rand (see NewSeededRand) is a deterministic XOF, which makes a protocol run
+// reproducible: the parties send the same messages in the same order when given the same seeds and inputs,
+// regardless of the scheduling of their workers. A seeded Rand must never be used in production.
+type Rand struct {
+	mu     sync.Mutex // guards xof
+	xof    io.Reader  // nil for SecureRand
+	seeded bool
+}
+
+var secureRand = &Rand{}
+
+// SecureRand returns the source of randomness backed by crypto/rand, which is the default of all parties.
+func SecureRand() *Rand {
+	return secureRand
+}
+
+// NewSeededRand returns a deterministic source of randomness, for tests and debugging only. Seeds longer than
+// 64 bytes are hashed first.
+func NewSeededRand(seed []byte) *Rand {
+	if len(seed) > blake2b.Size {
+		h := blake2b.Sum512(seed)
+		seed = h[:]
+	}
+	xof, err := blake2b.NewXOF(blake2b.OutputLengthUnknown, seed)
+	if err != nil {
+		panic(err) // the seed's length is checked above
+	}
+	return &Rand{xof: xof, seeded: true}
+}
+
+// Read fills p with random bytes. It is safe for concurrent use, but the bytes read by concurrent callers of
+// a seeded Rand depend on the scheduling (see split).
+func (r *Rand) Read(p []byte) (int, error) {
+	if !r.seeded {
+		return rand.Read(p)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return io.ReadFull(r.xof, p)
+}
+
+// Scalar returns a uniformly random scalar.
+func (r *Rand) Scalar() *Scalar {
+	return &Scalar{s: group.RandomScalar(r)}
+}
+
+// Point returns a uniformly random point.
+func (r *Rand) Point() *Point {
+	return BaseExp(r.Scalar()) // faster than group.RandomElement
+}
+
+// IntN returns a uniformly random integer in [0, n), without modulo bias. It panics if n <= 0.
+func (r *Rand) IntN(n int) int {
+	if n <= 0 {
+		panic("invalid argument to IntN")
+	}
+	var buf [8]byte
+	// Lemire's method: rejects the low products which would make some outputs more likely
+	bound := uint64(n)
+	threshold := -bound % bound
+	for {
+		if _, err := r.Read(buf[:]); err != nil {
+			panic(err) // as group.RandomScalar
+		}
+		hi, lo := bits.Mul64(binary.LittleEndian.Uint64(buf[:]), bound)
+		if lo >= threshold {
+			return int(hi)
+		}
+	}
+}
+
+// Shuffle shuffles n elements with the Fisher-Yates algorithm, where swap swaps the elements i and j.
+func (r *Rand) Shuffle(n int, swap func(i, j int)) {
+	for i := n - 1; i > 0; i-- {
+		swap(i, r.IntN(i+1))
+	}
+}
+
+// Perm returns a uniformly random permutation of [0, n).
+func (r *Rand) Perm(n int) []int {
+	p := make([]int, n)
+	for i := range p {
+		p[i] = i
+	}
+	r.Shuffle(n, func(i, j int) { p[i], p[j] = p[j], p[i] })
+	return p
+}
+
+// split returns independent sources of randomness for the tasks of a parallel computation, so that the
+// randomness of the i-th task does not depend on the order in which the tasks are run. For a seeded Rand,
+// the i-th source is an XOF keyed by a fresh key drawn from r, with input i. Otherwise, all tasks read from
+// crypto/rand.
+func (r *Rand) split() func(i int) *Rand {
+	if !r.seeded {
+		return func(int) *Rand { return r }
+	}
+	key := make([]byte, 32)
+	if _, err := r.Read(key); err != nil {
+		panic(err)
+	}
+	return func(i int) *Rand {
+		xof, err := blake2b.NewXOF(blake2b.OutputLengthUnknown, key)
+		if err != nil {
+			panic(err)
+		}
+		if _, err := xof.Write(binary.BigEndian.AppendUint64(nil, uint64(i))); err != nil {
+			panic(err)
+		}
+		return &Rand{xof: xof, seeded: true}
+	}
+}
@@ -0,0 +1,130 @@
+package mppj
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeededRand(t *testing.T) {
+	read := func(r *Rand) []byte {
+		buf := make([]byte, 64)
+		_, err := r.Read(buf)
+		require.NoError(t, err)
+		return buf
+	}
+
+	require.Equal(t, read(NewSeededRand([]byte("seed"))), read(NewSeededRand([]byte("seed"))))
+	require.NotEqual(t, read(NewSeededRand([]byte("seed"))), read(NewSeededRand([]byte("other seed"))))
+	long := []byte(strings.Repeat("a long seed ", 10))
+	require.Equal(t, read(NewSeededRand(long)), read(NewSeededRand(long)))
+	require.NotEqual(t, read(SecureRand()), read(SecureRand()))
+
+	// the streams of a split only depend on their index
+	streams1, streams2 := NewSeededRand([]byte("seed")).split(), NewSeededRand([]byte("seed")).split()
+	require.Equal(t, read(streams1(1)), read(streams2(1)))
+	require.Equal(t, read(streams1(0)), read(streams2(0)))
+	require.NotEqual(t, read(streams1(0)), read(streams1(1)))
+}
+
+func TestRandPerm(t *testing.T) {
+	for _, r := range []*Rand{SecureRand(), NewSeededRand([]byte("seed"))} {
+		for _, n := range []int{0, 1, 2, 100} {
+			perm := r.Perm(n)
+			slices.Sort(perm)
+			for i := range n {
+				require.Equal(t, i, perm[i])
+			}
+		}
+
+		// each element of [0, 3) should be drawn about a third of the time
+		counts := make([]int, 3)
+		for range 3000 {
+			counts[r.IntN(3)]++
+		}
+		for _, c := range counts {
+			require.InDelta(t, 1000, c, 150)
+		}
+		require.Panics(t, func() { r.IntN(0) })
+	}
+}
+
+func TestSeededRun(t *testing.T) {
+
+	sourceIDs := []SourceID{"ds1", "ds2", "ds3"}
+
+	sid := NewSessionID(3, "helper", "receiver", sourceIDs)
+	rsk, rpk := GetTestKeys([]byte("receiver"))
+	tables := GenTestTables(sourceIDs, ROW_AMOUNT, INTERSECTION_SIZE)
+
+	// run returns the serialized messages of the sources and the helper
+	run := func() (sent []string) {
+		encTables := make(map[SourceID]EncTable, len(sourceIDs))
+		for _, sourceID := range sourceIDs {
+			ds := NewDataSource(sid, rpk)
+			ds.UseRand(NewSeededRand([]byte(sourceID)))
+			encTable, err := ds.Prepare(rpk, tables[sourceID])
+			require.NoError(t, err)
+			for _, row := range encTable {
+				data, err := row.MarshalBinary()
+				require.NoError(t, err)
+				sent = append(sent, string(data))
+			}
+			encTables[sourceID] = encTable
+		}
+
+		helper := NewHelperWithRand(sid, sourceIDs, ROW_AMOUNT, NewSeededRand([]byte("helper")))
+		joinedTables, err := helper.Convert(rpk, encTables)
+		require.NoError(t, err)
+		for _, row := range joinedTables {
+			data, err := row.MarshalBinary()
+			require.NoError(t, err)
+			sent = append(sent, string(data))
+		}
+
+		receiver := NewReceiverWithKeys(sid, sourceIDs, rsk, rpk)
+		join, err := receiver.JoinTables(joinedTables, len(sourceIDs))
+		require.NoError(t, err)
+		joinedTablesPlain := IntersectSimple(tables, sourceIDs)
+		require.True(t, joinedTablesPlain.EqualContents(&join))
+		return sent
+	}
+
+	require.Equal(t, run(), run())
+}
+
+func TestSeededPrepareExternal(t *testing.T) {
+	_, rpk := GetTestKeys([]byte("seed"))
+
+	rows := func(yield func(string, string) bool) {
+		for i := range 100 {
+			if !yield(fmt.Sprintf("uid-%d", i), fmt.Sprintf("val-%d", i)) {
+				return
+			}
+		}
+	}
+
+	run := func() (sent []string) {
+		ds := NewDataSource([]byte("sid"), rpk)
+		ds.UseRand(NewSeededRand([]byte("ds")))
+		es, err := NewExternalShuffler(t.TempDir(), 4)
+		require.NoError(t, err)
+		defer es.Close()
+		es.UseRand(NewSeededRand([]byte("shuffler")))
+
+		require.NoError(t, ds.PrepareExternal(context.Background(), rows, es))
+		for row, err := range es.Rows() {
+			require.NoError(t, err)
+			data, err := row.MarshalBinary()
+			require.NoError(t, err)
+			sent = append(sent, string(data))
+		}
+		return sent
+	}
+
+	require.Equal(t, run(), run())
+}
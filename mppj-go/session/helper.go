@@ -0,0 +1,288 @@
+package session
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mppj"
+	"mppj/api"
+	"mppj/api/pb"
+	"mppj/transport"
+	"runtime"
+	"slices"
+	"sync"
+)
+
+// HelperSession is the helper of a session.
+type HelperSession struct {
+	p   Params
+	tr  transport.HelperTransport
+	opt *options
+}
+
+// NewHelper returns the helper of the session, which serves the other parties over tr. The options are
+// WithReceiverPK, WithRand, WithStore and WithBatchSize. As for NewSource, the receiver's public keys must be
+// set with WithReceiverPK unless tr authenticates the receiver's setup.
+func NewHelper(p Params, tr transport.HelperTransport, opts ...Option) (*HelperSession, error) {
+	if err := p.check(); err != nil {
+		return nil, err
+	}
+	opt := newOptions(opts)
+	if opt.batchSize <= 0 {
+		return nil, errors.New("the batch size must be positive")
+	}
+	if err := opt.checkReceiverPK(tr); err != nil {
+		return nil, err
+	}
+	if n := p.NumRows * len(p.Sources); opt.store != nil && opt.store.Len() != n {
+		return nil, fmt.Errorf("the store has %d positions, expected %d", opt.store.Len(), n)
+	}
+	if fileStore, ok := opt.store.(*mppj.FileRowStore); ok {
+		if err := fileStore.CheckSession(p.boundID(), p.Sources, p.NumRows*len(p.Sources)); err != nil {
+			return nil, err
+		}
+	}
+	return &HelperSession{p: p, tr: tr, opt: opt}, nil
+}
+
+// Run converts the rows of the sources, and sends them to the receiver. The conversion starts once the
+// receiver's public keys are known, from WithReceiverPK or the receiver's setup. Run returns once the receiver
+// pulled all the converted rows, on the first failure, or when ctx is done. As the rows already received
+// cannot be taken back, the failure of a source aborts the session.
+func (s *HelperSession) Run(ctx context.Context) error {
+	ctx, abort := context.WithCancelCause(ctx)
+	defer abort(nil)
+	h := newHelperHandler(ctx, abort, s.p, s.opt)
+	if s.opt.rpk != nil {
+		h.start(*s.opt.rpk)
+	}
+
+	serveCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	served := make(chan error, 1)
+	go func() { served <- s.tr.Serve(serveCtx, h) }()
+	select {
+	case <-h.done:
+		stop() // cancels the remaining streams
+		<-served
+		return nil
+	case err := <-served:
+		if isDone(h.done) { // the transport ended once the rows were pulled, as for files
+			return nil
+		}
+		if err == nil {
+			err = errors.New("the transport stopped before the rows were pulled")
+		}
+		abort(err)
+	case <-ctx.Done():
+		stop()
+		<-served
+	}
+	return fmt.Errorf("session aborted: %w", context.Cause(ctx))
+}
+
+// isDone returns whether the channel is closed.
+func isDone(c chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
+
+// helperHandler is the transport's handler of the helper.
+type helperHandler struct {
+	ctx   context.Context         // the session's context, which is done when the session is aborted
+	abort context.CancelCauseFunc // aborts the session
+	p     Params
+	opt   *options
+
+	setupOnce sync.Once
+	in        chan mppj.ConvertRowTask
+	converted chan struct{} // closed once the rows are converted into store
+	store     mppj.RowStore
+
+	mu      sync.Mutex
+	pending map[mppj.SourceID]bool // the sources which did not push their rows yet
+	left    int                    // the number of sources which did not push all their rows
+
+	doneOnce sync.Once
+	done     chan struct{} // closed once the receiver pulled the converted rows
+}
+
+func newHelperHandler(ctx context.Context, abort context.CancelCauseFunc, p Params, opt *options) *helperHandler {
+	h := &helperHandler{
+		ctx:       ctx,
+		abort:     abort,
+		p:         p,
+		opt:       opt,
+		in:        make(chan mppj.ConvertRowTask, 16*runtime.NumCPU()),
+		converted: make(chan struct{}),
+		store:     opt.store,
+		pending:   make(map[mppj.SourceID]bool, len(p.Sources)),
+		left:      len(p.Sources),
+		done:      make(chan struct{}),
+	}
+	if h.store == nil {
+		h.store = make(mppj.EncTableWithHint, p.NumRows*len(p.Sources))
+	}
+	for _, id := range p.Sources {
+		h.pending[id] = true
+	}
+	return h
+}
+
+// start starts the conversion of the rows for the receiver's public keys, once.
+func (h *helperHandler) start(rpk mppj.PublicKeyTuple) {
+	h.setupOnce.Do(func() {
+		rnd := h.opt.rand
+		if rnd == nil {
+			rnd = mppj.SecureRand()
+		}
+		helper := mppj.NewHelperWithRand(h.p.boundID(), h.p.Sources, h.p.NumRows, rnd)
+		go func() {
+			if err := helper.ConvertTablesStreamTo(h.ctx, rpk, h.in, h.store); err != nil {
+				h.abort(fmt.Errorf("failed to convert the rows: %w", err))
+				return
+			}
+			if fileStore, ok := h.store.(*mppj.FileRowStore); ok {
+				if err := fileStore.Commit(); err != nil {
+					h.abort(fmt.Errorf("failed to commit the store: %w", err))
+					return
+				}
+			}
+			close(h.converted)
+		}()
+	})
+}
+
+// HandleSetup implements transport.Handler. The setup must be that of the session, with the receiver's public
+// keys set with WithReceiverPK if any.
+func (h *helperHandler) HandleSetup(_ context.Context, setup api.Setup) error {
+	if !bytes.Equal(setup.SessionID, h.p.ID) {
+		return errors.New("the setup is for another session")
+	}
+	if h.opt.rpk != nil {
+		rpk, err := setup.ReceiverPK.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		expected, err := h.opt.rpk.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(rpk, expected) {
+			return errors.New("the setup has other receiver keys than those of the session")
+		}
+	}
+	h.start(setup.ReceiverPK)
+	return nil
+}
+
+// HandlePush implements transport.Handler. Any failure aborts the session.
+func (h *helperHandler) HandlePush(ctx context.Context, source mppj.SourceID, rows transport.RowReceiver[*pb.EncRow]) (err error) {
+	h.mu.Lock()
+	if !h.pending[source] {
+		h.mu.Unlock()
+		return fmt.Errorf("%w: %s", transport.ErrUnexpectedSource, source)
+	}
+	delete(h.pending, source)
+	h.mu.Unlock()
+	defer func() {
+		if err != nil {
+			h.abort(fmt.Errorf("failed to receive the rows of source %s: %w", source, err))
+		}
+	}()
+
+	if n := rows.NumRows(); n != h.p.NumRows {
+		errCount := mppj.ErrTooManyRows
+		if n < h.p.NumRows {
+			errCount = mppj.ErrTooFewRows
+		}
+		return fmt.Errorf("%w: source %s announced %d rows, expected %d", errCount, source, n, h.p.NumRows)
+	}
+
+	tindex := mppj.TableIndex(slices.Index(h.p.Sources, source))
+	var rc int
+	for {
+		msgs, err := rows.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if rc += len(msgs); rc > h.p.NumRows {
+			return fmt.Errorf("%w: source %s sent more than %d rows", mppj.ErrTooManyRows, source, h.p.NumRows)
+		}
+		for _, msg := range msgs {
+			encRow, err := api.GetEncRowFromMsg(msg)
+			if err != nil {
+				return err
+			}
+			select {
+			case h.in <- mppj.ConvertRowTask{EncRowMsg: encRow, TableIndex: tindex}:
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-h.ctx.Done():
+				return fmt.Errorf("%w: %v", transport.ErrAborted, context.Cause(h.ctx))
+			}
+		}
+	}
+	if rc < h.p.NumRows {
+		return fmt.Errorf("%w: source %s sent %d rows, expected %d", mppj.ErrTooFewRows, source, rc, h.p.NumRows)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.left--; h.left == 0 {
+		close(h.in)
+	}
+	return nil
+}
+
+// HandlePull implements transport.Handler. It sends the converted rows once they are all converted.
+func (h *helperHandler) HandlePull(ctx context.Context, open func(numRows int) (transport.RowSender[*pb.EncRowWithHint], error)) error {
+	select {
+	case <-h.converted:
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-h.ctx.Done():
+		return fmt.Errorf("%w: %v", transport.ErrAborted, context.Cause(h.ctx))
+	}
+
+	rows, err := open(h.store.Len())
+	if err != nil {
+		return err
+	}
+	batch := make([]*pb.EncRowWithHint, 0, h.opt.batchSize)
+	for row, err := range h.store.Rows() {
+		if err != nil {
+			return err
+		}
+		msg, err := api.GetEncRowWithHintMsg(row)
+		if err != nil {
+			return err
+		}
+		if batch = append(batch, msg); len(batch) < h.opt.batchSize {
+			continue
+		}
+		if err := rows.Send(batch); err != nil {
+			return err
+		}
+		batch = batch[:0]
+	}
+	if len(batch) > 0 {
+		if err := rows.Send(batch); err != nil {
+			return err
+		}
+	}
+	if err := rows.Close(); err != nil { // waits for the receiver to receive the rows
+		return err
+	}
+	h.doneOnce.Do(func() { close(h.done) })
+	return nil
+}
@@ -0,0 +1,137 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mppj"
+	"mppj/api"
+	"mppj/api/pb"
+	"mppj/transport"
+	"runtime"
+	"sync"
+)
+
+// ReceiverSession is the receiver of a session.
+type ReceiverSession struct {
+	p   Params
+	tr  transport.Transport
+	opt *options
+	r   *mppj.Receiver
+}
+
+// NewReceiver returns the receiver of the session, which sends its setup and pulls the converted rows over tr.
+// The options are WithReceiverKeys, without which the receiver's keys are generated, and WithSpillDir.
+func NewReceiver(p Params, tr transport.Transport, opts ...Option) (*ReceiverSession, error) {
+	if err := p.check(); err != nil {
+		return nil, err
+	}
+	opt := newOptions(opts)
+	var r *mppj.Receiver
+	if opt.rsk != nil {
+		r = mppj.NewReceiverWithKeys(p.boundID(), p.Sources, *opt.rsk, *opt.rpk)
+	} else {
+		r = mppj.NewReceiver(p.boundID(), p.Sources)
+	}
+	return &ReceiverSession{p: p, tr: tr, opt: opt, r: r}, nil
+}
+
+// PublicKey returns the receiver's public keys.
+func (s *ReceiverSession) PublicKey() mppj.PublicKeyTuple {
+	return s.r.GetPK()
+}
+
+// Setup sends the receiver's setup, from which the helper and the sources take its public keys if the transport
+// authenticates it (see transport.SetupAuthenticator). Otherwise, the setup is not authenticated, and the helper
+// and the sources only check it against the keys set with WithReceiverPK: the receiver must then share its
+// public keys (see PublicKey) over an authenticated channel, e.g., the manifest.
+func (s *ReceiverSession) Setup(ctx context.Context) error {
+	if err := s.tr.SendSetup(ctx, api.Setup{SessionID: s.p.ID, ReceiverPK: s.r.GetPK()}); err != nil {
+		return fmt.Errorf("failed to send the setup: %w", err)
+	}
+	return nil
+}
+
+// Join pulls the converted rows from the helper, and writes the joined rows to w as they are decrypted. It
+// returns the number of joined rows and of the groups skipped for several rows of a source (see
+// mppj.Receiver.JoinTablesStreamTo), once all the rows are received and joined, or when ctx is done.
+func (s *ReceiverSession) Join(ctx context.Context, w mppj.RowWriter) (n, skipped int, err error) {
+	ctx, abort := context.WithCancelCause(ctx) // aborts the join on the first reception error
+	defer abort(nil)
+	rows, err := s.tr.PullRows(ctx)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to open the stream: %w", err)
+	}
+	numRows := rows.NumRows()
+	if expected := s.p.NumRows * len(s.p.Sources); numRows != expected {
+		rows.Close()
+		return 0, 0, fmt.Errorf("the helper announced %d rows, expected %d", numRows, expected)
+	}
+
+	// the rows are received in a goroutine, and decoded in parallel. The queues are bounded, so that the
+	// reception waits for the join rather than buffering the rows, and are left once the join is aborted.
+	queueSize := 16 * runtime.NumCPU()
+	msgs := make(chan *pb.EncRowWithHint, queueSize)
+	go func() {
+		defer close(msgs)
+		defer rows.Close()
+		var rc int
+		for {
+			batch, err := rows.Recv()
+			if err == io.EOF {
+				if rc < numRows {
+					abort(fmt.Errorf("%w: received %d rows, expected %d", mppj.ErrTooFewRows, rc, numRows))
+				}
+				return
+			}
+			if err != nil {
+				abort(fmt.Errorf("failed to receive the rows: %w", err))
+				return
+			}
+			if rc += len(batch); rc > numRows {
+				abort(fmt.Errorf("%w: received more than %d rows", mppj.ErrTooManyRows, numRows))
+				return
+			}
+			for _, msg := range batch {
+				select {
+				case msgs <- msg:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	in := make(chan mppj.EncRowWithHint, queueSize)
+	var wg sync.WaitGroup
+	for range runtime.NumCPU() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for msg := range msgs {
+				row, err := api.GetEncRowWithHintFromMsg(msg)
+				if err != nil {
+					abort(fmt.Errorf("failed to decode a row: %w", err))
+					continue // drains the rows
+				}
+				select {
+				case in <- row:
+				case <-ctx.Done(): // the join stopped reading the rows
+				}
+			}
+		}()
+	}
+	go func() { wg.Wait(); close(in) }()
+
+	if s.opt.spillDir != nil {
+		n, skipped, err = s.r.JoinTablesStreamToExternal(ctx, in, w, *s.opt.spillDir, s.opt.spillParts)
+	} else {
+		n, skipped, err = s.r.JoinTablesStreamTo(ctx, in, w)
+	}
+	if cause := context.Cause(ctx); cause != nil {
+		err = cause
+	}
+	if err != nil {
+		return n, 0, fmt.Errorf("failed to join the rows: %w", err)
+	}
+	return n, skipped, nil
+}
@@ -0,0 +1,131 @@
+// Package session runs the parties of the protocol over a transport (see package transport), so that
+// applications embed a party without wiring the protocol's steps themselves:
+//
+//   - the receiver sends its public keys to the helper in its setup (ReceiverSession.Setup), and later joins
+//     the converted rows (ReceiverSession.Join);
+//   - each source receives the setup, prepares its table and pushes its rows (SourceSession.Push);
+//   - the helper converts the rows of the sources, and sends them to the receiver (HelperSession.Run).
+//
+// The parties share the parameters of the session (Params), e.g., from a session manifest (FromManifest).
+// Unless the transport authenticates the setup, as the local and file transports do, the sources and the
+// helper must know the receiver's public keys beforehand (WithReceiverPK).
+package session
+
+import (
+	"errors"
+	"fmt"
+	"mppj"
+	"mppj/transport"
+	"slices"
+)
+
+// defaultBatchSize is the number of rows passed at once to the transport, unless set with WithBatchSize.
+const defaultBatchSize = 64
+
+// Params are the parameters of a session, on which all its parties must agree.
+type Params struct {
+	ID            []byte             // the session ID, e.g., from mppj.NewSessionID or mppj.Manifest.SessionID
+	Sources       []mppj.SourceID    // in the order of their tables
+	NumRows       int                // the number of rows of each source
+	Normalization mppj.Normalization // the normalization of the join keys, if any
+}
+
+// FromManifest returns the parameters of the session declared by a manifest, which is validated.
+func FromManifest(m *mppj.Manifest) (Params, error) {
+	if err := m.Validate(); err != nil {
+		return Params{}, err
+	}
+	norm, err := m.Normalization()
+	if err != nil {
+		return Params{}, fmt.Errorf("%w: %w", mppj.ErrInvalidManifest, err)
+	}
+	return Params{ID: m.SessionID(), Sources: m.Sources(), NumRows: m.Limits.RowsPerSource, Normalization: norm}, nil
+}
+
+// check checks the parameters.
+func (p Params) check() error {
+	switch {
+	case len(p.ID) == 0:
+		return errors.New("no session ID")
+	case len(p.Sources) == 0:
+		return errors.New("no sources")
+	case p.NumRows <= 0:
+		return errors.New("the number of rows must be positive")
+	}
+	for i, id := range p.Sources {
+		if slices.Contains(p.Sources[:i], id) {
+			return fmt.Errorf("duplicate source %s", id)
+		}
+	}
+	return nil
+}
+
+// boundID returns the session ID bound to the normalization, which the parties use in the protocol.
+func (p Params) boundID() []byte {
+	return p.Normalization.BindSessionID(p.ID)
+}
+
+// Option configures a party. The options which do not apply to the party's role are ignored.
+type Option func(*options)
+
+type options struct {
+	rpk        *mppj.PublicKeyTuple
+	rsk        *mppj.SecretKeyTuple
+	rand       *mppj.Rand
+	store      mppj.RowStore
+	batchSize  int
+	spillDir   *string
+	spillParts int
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{batchSize: defaultBatchSize}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithReceiverPK sets the receiver's public keys, which the sources and the helper otherwise take from the
+// receiver's setup. A setup with other keys is then rejected. It is required over the transports which do not
+// authenticate the setup (see transport.SetupAuthenticator), such as gRPC.
+func WithReceiverPK(rpk mppj.PublicKeyTuple) Option {
+	return func(o *options) { o.rpk = &rpk }
+}
+
+// checkReceiverPK checks that the receiver's public keys are set, or else taken from a setup authenticated by
+// the transport tr, as the rows would otherwise be prepared for the keys of whoever sent the setup.
+func (o *options) checkReceiverPK(tr any) error {
+	if o.rpk == nil && !transport.AuthenticatesSetup(tr) {
+		return errors.New("the receiver's public keys must be set with WithReceiverPK, as the transport does not authenticate the setup")
+	}
+	return nil
+}
+
+// WithReceiverKeys sets the receiver's keys, which are otherwise generated.
+func WithReceiverKeys(rsk mppj.SecretKeyTuple, rpk mppj.PublicKeyTuple) Option {
+	return func(o *options) { o.rsk, o.rpk = &rsk, &rpk }
+}
+
+// WithRand makes the source or the helper take its randomness from r instead of crypto/rand, e.g., a seeded
+// Rand for reproducible runs.
+func WithRand(r *mppj.Rand) Option {
+	return func(o *options) { o.rand = r }
+}
+
+// WithStore makes the helper store the converted rows in store (e.g., a mppj.FileRowStore) instead of in
+// memory. The store must have a position for each row of the session.
+func WithStore(store mppj.RowStore) Option {
+	return func(o *options) { o.store = store }
+}
+
+// WithBatchSize sets the number of rows which the source and the helper pass at once to the transport.
+func WithBatchSize(n int) Option {
+	return func(o *options) { o.batchSize = n }
+}
+
+// WithSpillDir makes the receiver group the rows in numPartitions temporary files in dir (the system's default
+// if empty) instead of in memory, see mppj.Receiver.JoinTablesStreamToExternal.
+func WithSpillDir(dir string, numPartitions int) Option {
+	return func(o *options) { o.spillDir, o.spillParts = &dir, numPartitions }
+}
@@ -0,0 +1,298 @@
+package session
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"mppj"
+	"mppj/transport"
+	"mppj/transport/transporttest"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+const (
+	testRows     = 20
+	testJoinSize = 5
+)
+
+func testParams() Params {
+	sources := []mppj.SourceID{"ds1", "ds2", "ds3"}
+	return Params{ID: mppj.NewSessionID(len(sources), "helper", "receiver", sources), Sources: sources, NumRows: testRows}
+}
+
+// checkJoin checks the joined table against the plaintext join of the tables.
+func checkJoin(t *testing.T, p Params, tables map[mppj.SourceID]mppj.TablePlain, joined mppj.JoinTable) {
+	t.Helper()
+	expected := mppj.IntersectSimple(tables, p.Sources)
+	if joined.Len() != testJoinSize || !expected.EqualContents(&joined) {
+		t.Fatalf("unexpected join of %d rows", joined.Len())
+	}
+}
+
+// runSession runs the parties of a session concurrently, with the transports of the helper, the sources and
+// the receiver.
+func runSession(t *testing.T, p Params, helper transport.HelperTransport, source func() transport.Transport, receiver transport.Transport, opts ...Option) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	tables := mppj.GenTestTables(p.Sources, p.NumRows, testJoinSize)
+
+	r, err := NewReceiver(p, receiver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !transport.AuthenticatesSetup(helper) { // the keys are otherwise taken from the setup
+		opts = append(opts, WithReceiverPK(r.PublicKey()))
+	}
+	h, err := NewHelper(p, helper, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	helped := make(chan error, 1)
+	go func() { helped <- h.Run(ctx) }()
+
+	if err := r.Setup(ctx); err != nil {
+		t.Fatalf("Setup failed: %v", err)
+	}
+	pushed := make(chan error, len(p.Sources))
+	for _, id := range p.Sources {
+		s, err := NewSource(p, id, source(), opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func() { pushed <- s.Push(ctx, tables[id]) }()
+	}
+	joined := mppj.NewJoinTable(p.Sources)
+	if _, _, err := r.Join(ctx, &joined); err != nil {
+		t.Fatalf("Join failed: %v", err)
+	}
+	for range p.Sources {
+		if err := <-pushed; err != nil {
+			t.Fatalf("Push failed: %v", err)
+		}
+	}
+	if err := <-helped; err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	checkJoin(t, p, tables, joined)
+}
+
+func TestSessionLocal(t *testing.T) {
+	tr := transport.NewLocal()
+	runSession(t, testParams(), tr, func() transport.Transport { return tr }, tr)
+}
+
+func TestSessionNormalization(t *testing.T) {
+	p := testParams()
+	var err error
+	if p.Normalization, err = mppj.ParseNormalization("trim,lower"); err != nil {
+		t.Fatal(err)
+	}
+	tr := transport.NewLocal()
+	runSession(t, p, tr, func() transport.Transport { return tr }, tr, WithBatchSize(7))
+}
+
+func TestSessionGRPC(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dial := func() transport.Transport {
+		tr, err := transport.NewGRPC(lis.Addr().String(), 8, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { tr.Close() })
+		return tr
+	}
+	runSession(t, testParams(), transport.NewGRPCHelper(lis), dial, dial())
+}
+
+func TestSessionFiles(t *testing.T) {
+	p := testParams()
+	files := transporttest.Files(t, p.ID, p.Sources)
+
+	// the parties run one after the other, each reading the files written before
+	ctx := context.Background()
+	tables := mppj.GenTestTables(p.Sources, p.NumRows, testJoinSize)
+	r, err := NewReceiver(p, files("receiver"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Setup(ctx); err != nil {
+		t.Fatalf("Setup failed: %v", err)
+	}
+	for _, id := range p.Sources {
+		s, err := NewSource(p, id, files(string(id)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Push(ctx, tables[id]); err != nil {
+			t.Fatalf("Push failed: %v", err)
+		}
+	}
+	h, err := NewHelper(p, files("helper"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Run(ctx); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	joined := mppj.NewJoinTable(p.Sources)
+	if _, _, err := r.Join(ctx, &joined); err != nil {
+		t.Fatalf("Join failed: %v", err)
+	}
+	checkJoin(t, p, tables, joined)
+}
+
+func TestSessionErrors(t *testing.T) {
+	p := testParams()
+	tr := transport.NewLocal()
+	if _, err := NewSource(p, "ds4", tr); err == nil {
+		t.Error("expected an error for a source which is not in the session")
+	}
+	if _, err := NewHelper(Params{ID: p.ID, Sources: p.Sources}, tr); err == nil {
+		t.Error("expected an error for a session without rows")
+	}
+	store, err := mppj.CreateFileRowStore(filepath.Join(t.TempDir(), "rows.store"), testParams().ID, p.Sources, p.NumRows*len(p.Sources), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if _, err := NewHelper(p, tr, WithStore(store)); err == nil {
+		t.Error("expected an error for the store of another session")
+	}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	grpcTr, err := transport.NewGRPC(lis.Addr().String(), 1, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer grpcTr.Close()
+	if _, err := NewSource(p, "ds1", grpcTr); err == nil {
+		t.Error("expected an error for a source without the receiver's keys over gRPC")
+	}
+	if _, err := NewHelper(p, transport.NewGRPCHelper(lis)); err == nil {
+		t.Error("expected an error for a helper without the receiver's keys over gRPC")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	tables := mppj.GenTestTables(p.Sources, p.NumRows-1, 0)
+	s, err := NewSource(p, "ds1", tr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Push(ctx, tables["ds1"]); !errors.Is(err, mppj.ErrTooFewRows) {
+		t.Errorf("expected ErrTooFewRows, got %v", err)
+	}
+
+	// the helper rejects the setup of another session, and a source which pushes too few rows aborts it
+	h, err := NewHelper(p, tr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	helped := make(chan error, 1)
+	go func() { helped <- h.Run(ctx) }()
+	other := testParams()
+	r, err := NewReceiver(other, tr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Setup(ctx); err == nil {
+		t.Error("expected an error for the setup of another session")
+	}
+	rows, err := tr.PushRows(ctx, "ds1", p.NumRows)
+	if err != nil {
+		t.Fatalf("PushRows failed: %v", err)
+	}
+	if err := rows.Close(); !errors.Is(err, mppj.ErrTooFewRows) {
+		t.Errorf("expected ErrTooFewRows, got %v", err)
+	}
+	if err := <-helped; !errors.Is(err, mppj.ErrTooFewRows) {
+		t.Errorf("expected the session to be aborted with ErrTooFewRows, got %v", err)
+	}
+}
+
+func TestFromManifest(t *testing.T) {
+	rsk, rpk := mppj.ReceiverKeyGen()
+	pk, err := rpk.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := mppj.NewManifest()
+	m.Parties = []mppj.Party{
+		{ID: "helper", Role: mppj.RoleHelper, Address: "localhost:40000"},
+		{ID: "receiver", Role: mppj.RoleReceiver, PublicKey: pk},
+		{ID: "ds1", Role: mppj.RoleSource},
+		{ID: "ds2", Role: mppj.RoleSource},
+	}
+	m.Join.Normalize = "trim,lower"
+	m.Values.MaxLength = 30
+	m.Limits.RowsPerSource = testRows
+	p, err := FromManifest(m)
+	if err != nil {
+		t.Fatalf("FromManifest failed: %v", err)
+	}
+	if !bytes.Equal(p.ID, m.SessionID()) || len(p.Sources) != 2 || p.NumRows != testRows || p.Normalization.String() != "trim,lower" {
+		t.Fatalf("unexpected parameters %+v", p)
+	}
+
+	// the sources and the helper take the receiver's keys from the manifest
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	tr := transport.NewLocal()
+	manifestPK := func() Option {
+		rpk, err := m.ReceiverPK()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return WithReceiverPK(rpk)
+	}
+	h, err := NewHelper(p, tr, manifestPK())
+	if err != nil {
+		t.Fatal(err)
+	}
+	helped := make(chan error, 1)
+	go func() { helped <- h.Run(ctx) }()
+	tables := mppj.GenTestTables(p.Sources, p.NumRows, testJoinSize)
+	pushed := make(chan error, len(p.Sources))
+	for _, id := range p.Sources {
+		s, err := NewSource(p, id, tr, manifestPK())
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func() { pushed <- s.Push(ctx, tables[id]) }()
+	}
+	r, err := NewReceiver(p, tr, WithReceiverKeys(rsk, rpk))
+	if err != nil {
+		t.Fatal(err)
+	}
+	joined := mppj.NewJoinTable(p.Sources)
+	if _, _, err := r.Join(ctx, &joined); err != nil {
+		t.Fatalf("Join failed: %v", err)
+	}
+	for range p.Sources {
+		if err := <-pushed; err != nil {
+			t.Fatalf("Push failed: %v", err)
+		}
+	}
+	if err := <-helped; err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	checkJoin(t, p, tables, joined)
+
+	m.Limits.RowsPerSource = 0
+	if _, err := FromManifest(m); !errors.Is(err, mppj.ErrInvalidManifest) {
+		t.Errorf("expected ErrInvalidManifest, got %v", err)
+	}
+}
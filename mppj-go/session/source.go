@@ -0,0 +1,115 @@
+package session
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"mppj"
+	"mppj/api"
+	"mppj/api/pb"
+	"mppj/transport"
+	"slices"
+)
+
+// SourceSession is a source of a session.
+type SourceSession struct {
+	p   Params
+	id  mppj.SourceID
+	tr  transport.Transport
+	opt *options
+}
+
+// NewSource returns the source id of the session, which pushes its rows over tr. The options are
+// WithReceiverPK, WithRand and WithBatchSize. The rows are prepared for the receiver's public keys, which are
+// taken from the receiver's setup only if tr authenticates it (see transport.SetupAuthenticator), and must
+// otherwise be set with WithReceiverPK.
+func NewSource(p Params, id mppj.SourceID, tr transport.Transport, opts ...Option) (*SourceSession, error) {
+	if err := p.check(); err != nil {
+		return nil, err
+	}
+	if !slices.Contains(p.Sources, id) {
+		return nil, fmt.Errorf("%s is not a source of the session", id)
+	}
+	opt := newOptions(opts)
+	if opt.batchSize <= 0 {
+		return nil, errors.New("the batch size must be positive")
+	}
+	if err := opt.checkReceiverPK(tr); err != nil {
+		return nil, err
+	}
+	return &SourceSession{p: p, id: id, tr: tr, opt: opt}, nil
+}
+
+// receiverPK returns the receiver's public keys, which are received in the receiver's setup unless they were
+// set with WithReceiverPK.
+func (s *SourceSession) receiverPK(ctx context.Context) (mppj.PublicKeyTuple, error) {
+	if s.opt.rpk != nil {
+		return *s.opt.rpk, nil
+	}
+	setup, err := s.tr.RecvSetup(ctx)
+	if err != nil {
+		return mppj.PublicKeyTuple{}, fmt.Errorf("failed to receive the setup: %w", err)
+	}
+	if !bytes.Equal(setup.SessionID, s.p.ID) {
+		return mppj.PublicKeyTuple{}, errors.New("the setup is for another session")
+	}
+	return setup.ReceiverPK, nil
+}
+
+// Push prepares the table of the source for the receiver, and pushes its rows to the helper. It returns once
+// the helper received all the rows, or when ctx is done.
+func (s *SourceSession) Push(ctx context.Context, table mppj.TablePlain) error {
+	if n := len(table); n != s.p.NumRows {
+		errCount := mppj.ErrTooManyRows
+		if n < s.p.NumRows {
+			errCount = mppj.ErrTooFewRows
+		}
+		return fmt.Errorf("%w: the table has %d rows, expected %d", errCount, n, s.p.NumRows)
+	}
+	rpk, err := s.receiverPK(ctx)
+	if err != nil {
+		return err
+	}
+	ds := mppj.NewDataSourceWithNormalization(s.p.ID, rpk, s.p.Normalization)
+	if s.opt.rand != nil {
+		ds.UseRand(s.opt.rand)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // stops the preparation, and aborts the stream if it is not closed
+	encRows, wait, err := ds.PrepareStream(ctx, rpk, table)
+	if err != nil {
+		return err
+	}
+	rows, err := s.tr.PushRows(ctx, s.id, len(table))
+	if err != nil {
+		return fmt.Errorf("failed to open the stream: %w", err)
+	}
+	batch := make([]*pb.EncRow, 0, s.opt.batchSize)
+	for encRow := range encRows {
+		msg, err := api.GetEncRowMsg(encRow)
+		if err != nil {
+			return err
+		}
+		if batch = append(batch, msg); len(batch) < s.opt.batchSize {
+			continue
+		}
+		if err := rows.Send(batch); err != nil {
+			return fmt.Errorf("failed to send the rows: %w", err)
+		}
+		batch = batch[:0]
+	}
+	if err := wait(); err != nil {
+		return fmt.Errorf("failed to prepare the rows: %w", err)
+	}
+	if len(batch) > 0 {
+		if err := rows.Send(batch); err != nil {
+			return fmt.Errorf("failed to send the rows: %w", err)
+		}
+	}
+	if err := rows.Close(); err != nil {
+		return fmt.Errorf("failed to send the rows: %w", err)
+	}
+	return nil
+}
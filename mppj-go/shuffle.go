@@ -0,0 +1,186 @@
+package mppj
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"iter"
+	"slices"
+	"sync"
+)
+
+// ExternalShuffler shuffles encrypted rows that do not fit in memory. The rows are first
+// written to uniformly random buckets backed by temporary files, then each bucket is loaded
+// and shuffled in memory. Since each row lands in a uniformly random bucket and each bucket
+// is uniformly shuffled, the concatenation of the buckets is a uniformly random permutation.
+// Only (randomized) ciphertexts are written to disk.
+//
+// The normalized keys of the rows are checked for duplicates with a second set of temporary files,
+// partitioned by a MAC of the keys under a random key of the shuffler, so that the files do not reveal the
+// keys, and only a partition is held in memory at a time.
+type ExternalShuffler struct {
+	mu      sync.Mutex
+	buckets *spillFiles
+	keys    *spillFiles // the MACs of the normalized keys
+	macKey  []byte
+	n       int
+	closed  bool
+	rand    *Rand
+}
+
+// NewExternalShuffler creates a shuffler with numBuckets buckets in the directory dir. The
+// memory needed to shuffle n rows is about the size of n/numBuckets rows.
+func NewExternalShuffler(dir string, numBuckets int) (*ExternalShuffler, error) {
+	if numBuckets <= 0 {
+		return nil, errors.New("number of buckets must be positive")
+	}
+	buckets, err := newSpillFiles(dir, numBuckets)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := newSpillFiles(dir, numBuckets)
+	if err != nil {
+		buckets.close()
+		return nil, err
+	}
+	macKey := make([]byte, 32)
+	if _, err := SecureRand().Read(macKey); err != nil {
+		buckets.close()
+		keys.close()
+		return nil, err
+	}
+	return &ExternalShuffler{buckets: buckets, keys: keys, macKey: macKey, rand: SecureRand()}, nil
+}
+
+// UseRand makes the shuffler take its randomness from r instead of crypto/rand, e.g., a seeded Rand for
+// reproducible runs.
+func (es *ExternalShuffler) UseRand(r *Rand) {
+	es.rand = r
+}
+
+// Add adds a row to a random bucket. It is safe for concurrent use.
+func (es *ExternalShuffler) Add(row EncRow) error {
+	return es.add(row, es.rand)
+}
+
+// add adds a row to a bucket chosen with rnd.
+func (es *ExternalShuffler) add(row EncRow, rnd *Rand) error {
+	data, err := row.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	es.mu.Lock()
+	if es.closed {
+		es.mu.Unlock()
+		return errors.New("shuffler is closed")
+	}
+	es.n++
+	es.mu.Unlock()
+
+	b := rnd.IntN(es.buckets.len())
+	return es.buckets.append(b, data)
+}
+
+// addKey records the normalized key of a row, for checkKeys.
+func (es *ExternalShuffler) addKey(uid string) error {
+	es.mu.Lock()
+	closed := es.closed
+	es.mu.Unlock()
+	if closed {
+		return errors.New("shuffler is closed")
+	}
+
+	mac := hmac.New(sha256.New, es.macKey)
+	mac.Write([]byte(uid))
+	sum := mac.Sum(nil)
+	p := int(binary.BigEndian.Uint32(sum[:4]) % uint32(es.keys.len())) // the MACs are pseudorandom
+	return es.keys.append(p, sum)
+}
+
+// checkKeys returns ErrDuplicateKey if the same normalized key was recorded for several rows. It reads the
+// partitions of the keys one at a time.
+func (es *ExternalShuffler) checkKeys() error {
+	for p := range es.keys.len() {
+		seen := make(map[string]bool)
+		var dup bool
+		if err := es.keys.read(p, 1, func(fields [][]byte) error {
+			dup = dup || seen[string(fields[0])]
+			seen[string(fields[0])] = true
+			return nil
+		}); err != nil {
+			return err
+		}
+		if dup {
+			return fmt.Errorf("%w: several rows have the same normalized key", ErrDuplicateKey)
+		}
+	}
+	return nil
+}
+
+// Len returns the number of rows added to the shuffler.
+func (es *ExternalShuffler) Len() int {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	return es.n
+}
+
+// Rows returns an iterator over the shuffled rows, which reads the buckets one at a time. The
+// iteration stops at the first error, which is yielded along with an empty row. No rows must be
+// added once the iteration has started.
+func (es *ExternalShuffler) Rows() iter.Seq2[EncRow, error] {
+	return func(yield func(EncRow, error) bool) {
+		for b := range es.buckets.len() {
+			bucket, err := es.readBucket(b)
+			if err != nil {
+				yield(EncRow{}, err)
+				return
+			}
+			es.rand.Shuffle(len(bucket), func(i, j int) { bucket[i], bucket[j] = bucket[j], bucket[i] })
+			for _, row := range bucket {
+				if !yield(row, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+func (es *ExternalShuffler) readBucket(b int) ([]EncRow, error) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	if es.closed {
+		return nil, errors.New("shuffler is closed")
+	}
+
+	records := make([][]byte, 0)
+	if err := es.buckets.read(b, 1, func(fields [][]byte) error {
+		records = append(records, fields[0])
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	if es.rand.seeded {
+		// the rows are appended concurrently, so their order in the bucket is not reproducible
+		slices.SortFunc(records, bytes.Compare)
+	}
+
+	bucket := make([]EncRow, len(records))
+	for i, data := range records {
+		if err := bucket[i].UnmarshalBinary(data); err != nil {
+			return nil, err
+		}
+	}
+	return bucket, nil
+}
+
+// Close removes the temporary files of the shuffler.
+func (es *ExternalShuffler) Close() error {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	es.closed = true
+	return errors.Join(es.buckets.close(), es.keys.close())
+}
@@ -0,0 +1,89 @@
+package mppj
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncRowMarshalBinary(t *testing.T) {
+	_, rpk := GetTestKeys([]byte("seed"))
+	ds := NewDataSource([]byte("sid"), rpk)
+
+	cuid, cval, err := ds.ProcessRow("uid", "a value which spans over two ciphertexts")
+	require.NoError(t, err)
+	require.Len(t, cval, 2)
+
+	data, err := EncRow{Cuid: cuid, Cval: cval}.MarshalBinary()
+	require.NoError(t, err)
+
+	var row EncRow
+	require.NoError(t, row.UnmarshalBinary(data))
+	require.True(t, row.Cuid.Equals(cuid))
+	require.Len(t, row.Cval, 2)
+	for i := range cval {
+		require.True(t, row.Cval[i].Equals(cval[i]))
+	}
+
+	require.Error(t, row.UnmarshalBinary(data[:len(data)-1]))
+}
+
+func TestExternalShuffler(t *testing.T) {
+	dir := t.TempDir()
+	es, err := NewExternalShuffler(dir, 4)
+	require.NoError(t, err)
+
+	_, rpk := GetTestKeys([]byte("seed"))
+	ds := NewDataSource([]byte("sid"), rpk)
+
+	n := 100
+	rows := func(yield func(string, string) bool) {
+		for i := range n {
+			if !yield(fmt.Sprintf("uid-%d", i), fmt.Sprintf("val-%d", i)) {
+				return
+			}
+		}
+	}
+	require.NoError(t, ds.PrepareExternal(context.Background(), rows, es))
+	require.Equal(t, n, es.Len())
+
+	seen := make(map[string]struct{})
+	for row, err := range es.Rows() {
+		require.NoError(t, err)
+		cuid, err := row.Cuid.Serialize()
+		require.NoError(t, err)
+		seen[string(cuid)] = struct{}{}
+	}
+	require.Len(t, seen, n)
+
+	require.NoError(t, es.Close())
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Empty(t, files)
+}
+
+func TestExternalShufflerDuplicateKey(t *testing.T) {
+	dir := t.TempDir()
+	es, err := NewExternalShuffler(dir, 4)
+	require.NoError(t, err)
+	defer es.Close()
+
+	_, rpk := GetTestKeys([]byte("seed"))
+	norm, err := ParseNormalization("lower")
+	require.NoError(t, err)
+	ds := NewDataSourceWithNormalization([]byte("sid"), rpk, norm)
+
+	n := 100
+	rows := func(yield func(string, string) bool) {
+		for i := range n {
+			if !yield(fmt.Sprintf("uid-%d", i), fmt.Sprintf("val-%d", i)) {
+				return
+			}
+		}
+		yield("UID-42", "dup") // the same key as uid-42 once normalized
+	}
+	require.ErrorIs(t, ds.PrepareExternal(context.Background(), rows, es), ErrDuplicateKey)
+}
@@ -0,0 +1,118 @@
+package mppj
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// spillFiles is a set of temporary files to which records are appended concurrently, and from which they
+// are read back one file at a time. A record is a fixed number of length-prefixed fields.
+type spillFiles struct {
+	mu      []sync.Mutex
+	files   []*os.File
+	writers []*bufio.Writer
+}
+
+// newSpillFiles creates n temporary files in the directory dir (the system's default if empty).
+func newSpillFiles(dir string, n int) (*spillFiles, error) {
+	if n <= 0 {
+		return nil, errors.New("number of spill files must be positive")
+	}
+	sf := &spillFiles{
+		mu:      make([]sync.Mutex, n),
+		files:   make([]*os.File, 0, n),
+		writers: make([]*bufio.Writer, 0, n),
+	}
+	for range n {
+		f, err := os.CreateTemp(dir, "mppj-spill-*")
+		if err != nil {
+			sf.close()
+			return nil, err
+		}
+		sf.files = append(sf.files, f)
+		sf.writers = append(sf.writers, bufio.NewWriter(f))
+	}
+	return sf, nil
+}
+
+func (sf *spillFiles) len() int {
+	return len(sf.files)
+}
+
+// append appends a record to the i-th file.
+func (sf *spillFiles) append(i int, fields ...[]byte) error {
+	size := 0
+	for _, field := range fields {
+		size += binary.MaxVarintLen64 + len(field)
+	}
+	record := make([]byte, 0, size)
+	for _, field := range fields {
+		record = binary.AppendUvarint(record, uint64(len(field)))
+		record = append(record, field...)
+	}
+
+	sf.mu[i].Lock()
+	defer sf.mu[i].Unlock()
+	_, err := sf.writers[i].Write(record)
+	return err
+}
+
+// read calls fn on each record of the i-th file, in order. The records must have numFields fields.
+func (sf *spillFiles) read(i, numFields int, fn func(fields [][]byte) error) error {
+	sf.mu[i].Lock()
+	defer sf.mu[i].Unlock()
+	if err := sf.writers[i].Flush(); err != nil {
+		return err
+	}
+	f := sf.files[i]
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	r := bufio.NewReader(f)
+	for {
+		fields := make([][]byte, numFields)
+		for j := range fields {
+			l, err := binary.ReadUvarint(r)
+			if err == io.EOF && j == 0 {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("truncated spill file: %w", err)
+			}
+			fields[j] = make([]byte, l)
+			if _, err := io.ReadFull(r, fields[j]); err != nil {
+				return fmt.Errorf("truncated spill file: %w", err)
+			}
+		}
+		if err := fn(fields); err != nil {
+			return err
+		}
+	}
+}
+
+// remove removes the i-th file, once it is not needed anymore.
+func (sf *spillFiles) remove(i int) error {
+	sf.mu[i].Lock()
+	defer sf.mu[i].Unlock()
+	if sf.files[i] == nil {
+		return nil
+	}
+	err := errors.Join(sf.files[i].Close(), os.Remove(sf.files[i].Name()))
+	sf.files[i], sf.writers[i] = nil, nil
+	return err
+}
+
+// close removes all the files.
+func (sf *spillFiles) close() error {
+	var errs []error
+	for i := range sf.files {
+		errs = append(errs, sf.remove(i))
+	}
+	return errors.Join(errs...)
+}
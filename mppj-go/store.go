@@ -0,0 +1,240 @@
+package mppj
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"os"
+)
+
+// RowStore stores the converted rows of the helper at their permuted positions, and reads them back in
+// position order.
+type RowStore interface {
+	// Put stores the row at position pos. It is safe for concurrent use with distinct positions.
+	Put(pos int, row EncRowWithHint) error
+	// Len returns the number of positions of the store.
+	Len() int
+	// Rows returns an iterator over the rows in position order. The iteration stops at the first error,
+	// which is yielded along with an empty row.
+	Rows() iter.Seq2[EncRowWithHint, error]
+}
+
+// Put implements RowStore for the in-memory table.
+func (t EncTableWithHint) Put(pos int, row EncRowWithHint) error {
+	if pos < 0 || pos >= len(t) {
+		return fmt.Errorf("position %d out of range", pos)
+	}
+	t[pos] = row
+	return nil
+}
+
+// Len implements RowStore for the in-memory table.
+func (t EncTableWithHint) Len() int {
+	return len(t)
+}
+
+// Rows implements RowStore for the in-memory table.
+func (t EncTableWithHint) Rows() iter.Seq2[EncRowWithHint, error] {
+	return func(yield func(EncRowWithHint, error) bool) {
+		for _, row := range t {
+			if !yield(row, nil) {
+				return
+			}
+		}
+	}
+}
+
+const (
+	fileStoreMagic      = "MPPJROWS"
+	fileStoreVersion    = 2
+	fileStoreHeaderSize = len(fileStoreMagic) + 1 + 1 + 8 + 4 + sha256.Size // magic, version, complete, number of rows, slot size, session hash
+	fileStoreLenSize    = 4                                                 // the length prefix of each slot
+)
+
+// FileRowStore is a RowStore backed by a file, for conversions which do not fit in the helper's memory.
+// Each position is a fixed-size slot, so that the rows can be written at their permuted position as they
+// are converted. Once the conversion is complete, the store is committed, and can be re-opened with
+// OpenFileRowStore, e.g., after a restart of the helper. The header holds a hash of the session, which
+// CheckSession checks before the rows are served again.
+type FileRowStore struct {
+	f        *os.File
+	nRows    int
+	slotSize int
+	complete bool
+	session  []byte // the hash of the session, see fileStoreSessionHash
+}
+
+// fileStoreSessionHash returns the hash of the session sid with the sources sourceIDs.
+func fileStoreSessionHash(sid []byte, sourceIDs []SourceID) []byte {
+	h := sha256.New()
+	h.Write(binary.AppendUvarint(nil, uint64(len(sid))))
+	h.Write(sid)
+	for _, id := range sourceIDs {
+		h.Write(binary.AppendUvarint(nil, uint64(len(id))))
+		h.Write([]byte(id))
+	}
+	return h.Sum(nil)
+}
+
+// FileRowStoreSlotSize returns the slot size for rows whose values are encrypted with at most maxValCts
+// ciphertexts.
+func FileRowStoreSlotSize(maxValCts int) int {
+	ctLen := 2 * int(group.Params().CompressedElementLength)
+	return fileStoreLenSize + 3*ctLen + 1 + maxValCts*ctLen // the value is prefixed with the source index
+}
+
+// CreateFileRowStore creates a store of nRows rows at path for the session sid (as bound by the helper) with
+// the sources sourceIDs, for rows whose values are encrypted with at most maxValCts ciphertexts. It fails if
+// the file already exists.
+func CreateFileRowStore(path string, sid []byte, sourceIDs []SourceID, nRows, maxValCts int) (*FileRowStore, error) {
+	if nRows < 0 || maxValCts <= 0 {
+		return nil, errors.New("invalid store dimensions")
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, err
+	}
+	s := &FileRowStore{f: f, nRows: nRows, slotSize: FileRowStoreSlotSize(maxValCts), session: fileStoreSessionHash(sid, sourceIDs)}
+	if err := s.writeHeader(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Truncate(int64(fileStoreHeaderSize) + int64(nRows)*int64(s.slotSize)); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// OpenFileRowStore opens an existing store. Its session must then be checked with CheckSession.
+func OpenFileRowStore(path string) (*FileRowStore, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, fileStoreHeaderSize)
+	if _, err := io.ReadFull(f, header); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("invalid row store header: %w", err)
+	}
+	if !bytes.HasPrefix(header, []byte(fileStoreMagic)) {
+		f.Close()
+		return nil, errors.New("invalid row store: bad magic")
+	}
+	h := header[len(fileStoreMagic):]
+	if h[0] != fileStoreVersion {
+		f.Close()
+		return nil, fmt.Errorf("unsupported row store version: %d", h[0])
+	}
+	s := &FileRowStore{
+		f:        f,
+		complete: h[1] == 1,
+		nRows:    int(binary.BigEndian.Uint64(h[2:10])),
+		slotSize: int(binary.BigEndian.Uint32(h[10:14])),
+		session:  bytes.Clone(h[14 : 14+sha256.Size]),
+	}
+	return s, nil
+}
+
+// CheckSession returns an error if the store was not created for the session sid (as bound by the helper)
+// with the sources sourceIDs, or does not have nRows rows.
+func (s *FileRowStore) CheckSession(sid []byte, sourceIDs []SourceID, nRows int) error {
+	if !bytes.Equal(s.session, fileStoreSessionHash(sid, sourceIDs)) {
+		return errors.New("the row store is for another session")
+	}
+	if s.nRows != nRows {
+		return fmt.Errorf("the row store has %d rows, expected %d", s.nRows, nRows)
+	}
+	return nil
+}
+
+func (s *FileRowStore) writeHeader() error {
+	header := make([]byte, 0, fileStoreHeaderSize)
+	header = append(header, fileStoreMagic...)
+	header = append(header, fileStoreVersion)
+	if s.complete {
+		header = append(header, 1)
+	} else {
+		header = append(header, 0)
+	}
+	header = binary.BigEndian.AppendUint64(header, uint64(s.nRows))
+	header = binary.BigEndian.AppendUint32(header, uint32(s.slotSize))
+	header = append(header, s.session...)
+	_, err := s.f.WriteAt(header, 0)
+	return err
+}
+
+// Put implements RowStore.
+func (s *FileRowStore) Put(pos int, row EncRowWithHint) error {
+	if pos < 0 || pos >= s.nRows {
+		return fmt.Errorf("position %d out of range", pos)
+	}
+	data, err := row.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if len(data) > s.slotSize-fileStoreLenSize {
+		return fmt.Errorf("row of %d bytes does not fit in the store's slots", len(data))
+	}
+	slot := make([]byte, s.slotSize)
+	binary.BigEndian.PutUint32(slot, uint32(len(data)))
+	copy(slot[fileStoreLenSize:], data)
+	_, err = s.f.WriteAt(slot, int64(fileStoreHeaderSize)+int64(pos)*int64(s.slotSize))
+	return err
+}
+
+// Len implements RowStore.
+func (s *FileRowStore) Len() int {
+	return s.nRows
+}
+
+// Complete returns whether the store was committed.
+func (s *FileRowStore) Complete() bool {
+	return s.complete
+}
+
+// Commit marks the store as complete and syncs it to disk.
+func (s *FileRowStore) Commit() error {
+	s.complete = true
+	if err := s.writeHeader(); err != nil {
+		return err
+	}
+	return s.f.Sync()
+}
+
+// Rows implements RowStore. It returns an error for the positions at which no row was stored.
+func (s *FileRowStore) Rows() iter.Seq2[EncRowWithHint, error] {
+	return func(yield func(EncRowWithHint, error) bool) {
+		r := bufio.NewReader(io.NewSectionReader(s.f, int64(fileStoreHeaderSize), int64(s.nRows)*int64(s.slotSize)))
+		slot := make([]byte, s.slotSize)
+		for pos := range s.nRows {
+			if _, err := io.ReadFull(r, slot); err != nil {
+				yield(EncRowWithHint{}, err)
+				return
+			}
+			l := int(binary.BigEndian.Uint32(slot))
+			if l == 0 || l > s.slotSize-fileStoreLenSize {
+				yield(EncRowWithHint{}, fmt.Errorf("no row stored at position %d", pos))
+				return
+			}
+			var row EncRowWithHint
+			if err := row.UnmarshalBinary(slot[fileStoreLenSize : fileStoreLenSize+l]); err != nil {
+				yield(EncRowWithHint{}, err)
+				return
+			}
+			if !yield(row, nil) {
+				return
+			}
+		}
+	}
+}
+
+// Close closes the store's file.
+func (s *FileRowStore) Close() error {
+	return s.f.Close()
+}
@@ -0,0 +1,97 @@
+package mppj
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileRowStore(t *testing.T) {
+
+	sourceIDs := []SourceID{"ds1", "ds2", "ds3"}
+
+	sid := NewSessionID(3, "helper", "receiver", sourceIDs)
+
+	helper := NewHelper(sid, sourceIDs, ROW_AMOUNT)
+	receiver := NewReceiver(sid, sourceIDs)
+	ds := NewDataSource(sid, receiver.GetPK())
+
+	tables := GenTestTables(sourceIDs, ROW_AMOUNT, INTERSECTION_SIZE)
+
+	path := filepath.Join(t.TempDir(), "rows.store")
+	store, err := CreateFileRowStore(path, sid, sourceIDs, helper.NumRows(), 1)
+	require.NoError(t, err)
+	require.Equal(t, helper.NumRows(), store.Len())
+	require.False(t, store.Complete())
+
+	_, err = CreateFileRowStore(path, sid, sourceIDs, helper.NumRows(), 1)
+	require.ErrorIs(t, err, os.ErrExist)
+
+	tasks := make(chan ConvertRowTask)
+	go func() {
+		for i, sourceID := range sourceIDs {
+			prepTable, err := ds.Prepare(receiver.GetPK(), tables[sourceID])
+			if err != nil {
+				panic(err)
+			}
+			for _, row := range prepTable {
+				tasks <- ConvertRowTask{EncRowMsg: EncRow{Cuid: row.Cuid, Cval: row.Cval}, TableIndex: TableIndex(i)}
+			}
+		}
+		close(tasks)
+	}()
+	require.NoError(t, helper.ConvertTablesStreamTo(context.Background(), receiver.GetPK(), tasks, store))
+	require.NoError(t, store.Commit())
+	require.NoError(t, store.Close())
+
+	store, err = OpenFileRowStore(path)
+	require.NoError(t, err)
+	defer store.Close()
+	require.True(t, store.Complete())
+	require.Equal(t, helper.NumRows(), store.Len())
+	require.NoError(t, store.CheckSession(sid, sourceIDs, helper.NumRows()))
+	require.ErrorContains(t, store.CheckSession(sid, sourceIDs[:2], helper.NumRows()), "another session")
+	require.ErrorContains(t, store.CheckSession(NewSessionID(3, "helper", "receiver", sourceIDs), sourceIDs, helper.NumRows()), "another session")
+	require.ErrorContains(t, store.CheckSession(sid, sourceIDs, helper.NumRows()+1), "rows")
+
+	encrows := make(chan EncRowWithHint, store.Len())
+	for row, err := range store.Rows() {
+		require.NoError(t, err)
+		encrows <- row
+	}
+	close(encrows)
+
+	intersectionMPPJ, err := receiver.JoinTablesStream(context.Background(), encrows, len(sourceIDs))
+	require.NoError(t, err)
+
+	joinedTablesPlain := IntersectSimple(tables, sourceIDs)
+	require.True(t, joinedTablesPlain.EqualContents(&intersectionMPPJ))
+}
+
+func TestFileRowStoreMissingRow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rows.store")
+	store, err := CreateFileRowStore(path, []byte("sid"), []SourceID{"ds1", "ds2"}, 2, 1)
+	require.NoError(t, err)
+	defer store.Close()
+
+	require.Error(t, store.Put(2, EncRowWithHint{}))
+
+	var err2 error
+	for _, err := range store.Rows() {
+		err2 = err
+	}
+	require.ErrorContains(t, err2, "no row stored at position 0")
+}
+
+func TestOpenFileRowStoreInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rows.store")
+	require.NoError(t, os.WriteFile(path, []byte("not a row store"), 0600))
+	_, err := OpenFileRowStore(path)
+	require.Error(t, err)
+
+	_, err = OpenFileRowStore(filepath.Join(t.TempDir(), "missing"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
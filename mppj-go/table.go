@@ -1,7 +1,6 @@
 package mppj
 
 import (
-	"bytes"
 	"encoding/csv"
 	"fmt"
 	"math/big"
@@ -46,28 +45,59 @@ type EncValueWithHint struct {
 type JoinTable struct {
 	sourceids []SourceID
 	values    [][]string
+	skipped   int // the groups skipped by the receiver's join
 }
 
 func (t JoinTable) Len() int {
 	return len(t.values)
 }
 
+// Skipped returns the number of groups skipped by the receiver's join for several rows of a source, whose keys
+// were then not unique (see ErrDuplicateKey).
+func (t JoinTable) Skipped() int {
+	return t.skipped
+}
+
+// MarshalBinary serializes the row as the concatenation of its ciphertexts.
 func (er EncRow) MarshalBinary() ([]byte, error) {
-	var buf bytes.Buffer
-	cuidBytes, err := er.Cuid.Serialize()
+	return SerializeCiphertexts(append([]*Ciphertext{er.Cuid}, er.Cval...))
+}
+
+// UnmarshalBinary deserializes a row serialized with MarshalBinary.
+func (er *EncRow) UnmarshalBinary(data []byte) error {
+	cts, err := DeserializeCiphertexts(data)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	if len(er.Cval) > 1 {
-		return nil, fmt.Errorf("multiple ciphertext values not supported")
+	if len(cts) < 2 {
+		return fmt.Errorf("invalid encrypted row: expected at least 2 ciphertexts, got %d", len(cts))
 	}
-	cvalBytes, err := er.Cval[0].Serialize()
+	er.Cuid, er.Cval = cts[0], cts[1:]
+	return nil
+}
+
+// MarshalBinary serializes the row as the concatenation of its ciphertexts, followed by the value ciphertext.
+func (er EncRowWithHint) MarshalBinary() ([]byte, error) {
+	cts, err := SerializeCiphertexts([]*Ciphertext{&er.Cnyme, &er.CValKey, &er.CHint})
 	if err != nil {
 		return nil, err
 	}
-	buf.Write(cuidBytes)
-	buf.Write(cvalBytes)
-	return buf.Bytes(), nil
+	return append(cts, er.CVal...), nil
+}
+
+// UnmarshalBinary deserializes a row serialized with MarshalBinary.
+func (er *EncRowWithHint) UnmarshalBinary(data []byte) error {
+	ctLen := 2 * int(group.Params().CompressedElementLength)
+	if len(data) < 3*ctLen {
+		return fmt.Errorf("invalid encrypted row with hint: expected at least %d bytes, got %d", 3*ctLen, len(data))
+	}
+	cts, err := DeserializeCiphertexts(data[:3*ctLen])
+	if err != nil {
+		return err
+	}
+	er.Cnyme, er.CValKey, er.CHint = *cts[0], *cts[1], *cts[2]
+	er.CVal = slices.Clone(data[3*ctLen:])
+	return nil
 }
 
 // NewTablePlain creates a new Table from a UID list and optional values.
@@ -94,18 +124,78 @@ func NewJoinTable(sourceIDs []SourceID) JoinTable {
 }
 
 func (t *JoinTable) Insert(values map[SourceID]string) error {
-	row := make([]string, len(t.sourceids))
+	row, err := rowFromValues(t.sourceids, values)
+	if err != nil {
+		return err
+	}
+	t.values = append(t.values, row)
+	return nil
+}
+
+// rowFromValues orders the values of a joined row according to sourceIDs.
+func rowFromValues(sourceIDs []SourceID, values map[SourceID]string) ([]string, error) {
+	row := make([]string, len(sourceIDs))
 	for sourceID, value := range values {
-		col := slices.Index(t.sourceids, sourceID)
+		col := slices.Index(sourceIDs, sourceID)
 		if col == -1 {
-			return fmt.Errorf("source ID %s not found", sourceID)
+			return nil, fmt.Errorf("source ID %s not found", sourceID)
 		}
 		row[col] = value
 	}
-	t.values = append(t.values, row)
+	return row, nil
+}
+
+// SourceIDs returns the source IDs of the table's columns.
+func (t JoinTable) SourceIDs() []SourceID {
+	return slices.Clone(t.sourceids)
+}
+
+// RowWriter is a sink for the rows of a join result.
+type RowWriter interface {
+	// WriteHeader writes the header, with one column per source.
+	WriteHeader(sourceIDs []SourceID) error
+	// WriteRow writes a row, with the values ordered as the header's source IDs.
+	WriteRow(values []string) error
+	// Flush writes any buffered data to the underlying writer.
+	Flush() error
+}
+
+// WriteHeader implements RowWriter for collecting the rows of a join result in memory. The source IDs
+// must match the table's.
+func (t *JoinTable) WriteHeader(sourceIDs []SourceID) error {
+	if !slices.Equal(t.sourceids, sourceIDs) {
+		return fmt.Errorf("source IDs %v do not match the table's %v", sourceIDs, t.sourceids)
+	}
+	return nil
+}
+
+// WriteRow implements RowWriter by appending a copy of the row to the table.
+func (t *JoinTable) WriteRow(values []string) error {
+	if len(values) != len(t.sourceids) {
+		return fmt.Errorf("row has %d values, expected %d", len(values), len(t.sourceids))
+	}
+	t.values = append(t.values, slices.Clone(values))
 	return nil
 }
 
+// Flush implements RowWriter and does nothing.
+func (t *JoinTable) Flush() error {
+	return nil
+}
+
+// WriteRows writes the table to a RowWriter.
+func (t JoinTable) WriteRows(w RowWriter) error {
+	if err := w.WriteHeader(t.sourceids); err != nil {
+		return err
+	}
+	for _, row := range t.values {
+		if err := w.WriteRow(row); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
 func (t JoinTable) WriteTo(w *csv.Writer) error {
 	sourceIDsStr := make([]string, len(t.sourceids))
 	for i, sid := range t.sourceids {
@@ -0,0 +1,90 @@
+// This provides the tracing of the protocol's phases with OpenTelemetry. The parties record their spans with
+// the global tracer provider, which does nothing unless the application sets one (see otel.SetTracerProvider).
+package mppj
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("mppj")
+
+// phase measures a phase of the protocol whose work is split into many short tasks, which are run by parallel
+// workers and interleaved with the tasks of other phases (e.g., the helper's OPRF evaluation and blinding of
+// each row). Its span goes from the start of the first task to the end of the last one, and records the time
+// spent in the tasks across all workers. A nil phase measures nothing.
+type phase struct {
+	ctx  context.Context // the context of the parent span
+	name string
+
+	mu         sync.Mutex
+	start, end time.Time
+	busy       time.Duration
+	n          int
+}
+
+// newPhase returns a phase whose span is a child of the span of ctx, or nil if that span is not recorded.
+func newPhase(ctx context.Context, name string) *phase {
+	if !trace.SpanFromContext(ctx).IsRecording() {
+		return nil
+	}
+	return &phase{ctx: ctx, name: name}
+}
+
+// begin starts a task of the phase, and returns its start time to pass to done.
+func (p *phase) begin() time.Time {
+	if p == nil {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// done ends the task that started at start.
+func (p *phase) done(start time.Time) {
+	if p == nil {
+		return
+	}
+	end := time.Now()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.n == 0 || start.Before(p.start) {
+		p.start = start
+	}
+	if end.After(p.end) {
+		p.end = end
+	}
+	p.busy += end.Sub(start)
+	p.n++
+}
+
+// record records the span of the phase, if it had any task.
+func (p *phase) record() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.n == 0 {
+		return
+	}
+	_, span := tracer.Start(p.ctx, p.name, trace.WithTimestamp(p.start), trace.WithAttributes(
+		attribute.Float64("mppj.busy_seconds", p.busy.Seconds()),
+		attribute.Int("mppj.tasks", p.n),
+	))
+	span.End(trace.WithTimestamp(p.end))
+}
+
+// EndSpan ends span, with the error status if err is not nil.
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,72 @@
+package mppj
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracePhases(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(tp)
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	sourceIDs := []SourceID{"ds1", "ds2"}
+	sid := NewSessionID(2, "helper", "receiver", sourceIDs)
+	rsk, rpk := GetTestKeys([]byte("receiver"))
+	tables := GenTestTables(sourceIDs, 20, 10)
+
+	ctx, span := tp.Tracer("test").Start(context.Background(), "run")
+	helper := NewHelper(sid, sourceIDs, 20)
+	in := make(chan ConvertRowTask, 40)
+	for i, sourceID := range sourceIDs {
+		encRows, wait, err := NewDataSource(sid, rpk).PrepareStream(ctx, rpk, tables[sourceID])
+		require.NoError(t, err)
+		for encRow := range encRows {
+			in <- ConvertRowTask{EncRowMsg: encRow, TableIndex: TableIndex(i)}
+		}
+		require.NoError(t, wait())
+	}
+	close(in)
+	converted, err := helper.ConvertTablesStream(ctx, rpk, in)
+	require.NoError(t, err)
+
+	out := make(chan EncRowWithHint, len(converted))
+	for _, row := range converted {
+		out <- row
+	}
+	close(out)
+	receiver := NewReceiverWithKeys(sid, sourceIDs, rsk, rpk)
+	_, err = receiver.JoinTablesStream(ctx, out, len(sourceIDs))
+	require.NoError(t, err)
+	span.End()
+
+	parents := make(map[string]string)
+	for _, s := range recorder.Ended() {
+		parents[s.Name()] = ""
+		for _, p := range recorder.Ended() {
+			if p.SpanContext().SpanID() == s.Parent().SpanID() {
+				parents[s.Name()] = p.Name()
+			}
+		}
+	}
+	require.Equal(t, map[string]string{
+		"run":              "",
+		"source.prepare":   "run",
+		"source.hash":      "source.prepare",
+		"source.encrypt":   "source.prepare",
+		"helper.convert":   "run",
+		"helper.oprf_eval": "helper.convert",
+		"helper.blind":     "helper.convert",
+		"helper.shuffle":   "helper.convert",
+		"receiver.join":    "run",
+		"receiver.group":   "receiver.join",
+		"receiver.decrypt": "receiver.join",
+	}, parents)
+}
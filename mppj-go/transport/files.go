@@ -0,0 +1,283 @@
+package transport
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"mppj"
+	"mppj/api"
+	"mppj/api/pb"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+)
+
+// fileBatchSize is the maximum number of messages returned by the receivers of files.
+const fileBatchSize = 64
+
+// Files is the transport over the signed files of the parties (see api.CreateFile), for air-gapped
+// deployments whose parties exchange the files on removable media: the receiver writes the setup file, the
+// sources write the files of their rows, the helper converts the sources' files into its file, and the
+// receiver joins the rows of the helper's file. The files which a party reads must have been written before.
+type Files struct {
+	SessionID []byte
+	Party     string // the id of the party, which writes the files
+	// SigningKey signs the files written by the party.
+	SigningKey ed25519.PrivateKey
+	// VerifyingKey returns the key of a file read by the party given its header, after checking the kind,
+	// session and writer of the file.
+	VerifyingKey func(api.FileHeader) (ed25519.PublicKey, error)
+
+	SetupPath  string          // the receiver's setup file
+	SourcePath string          // the file of a source's rows
+	SourceDir  string          // the directory of the sources' files, read by the helper
+	Sources    []mppj.SourceID // the sources whose file the helper expects in SourceDir
+	HelperPath string          // the helper's file of converted rows
+}
+
+var (
+	_ Transport          = (*Files)(nil)
+	_ HelperTransport    = (*Files)(nil)
+	_ SetupAuthenticator = (*Files)(nil)
+)
+
+// create creates the file at path for the rows of the party.
+func (t *Files) create(path string, kind api.FileKind, party string, numRows int) (*api.FileWriter, error) {
+	if path == "" {
+		return nil, fmt.Errorf("no path for the %s", kind)
+	}
+	if len(t.SigningKey) != ed25519.PrivateKeySize {
+		return nil, errors.New("no key to sign the files")
+	}
+	header := api.FileHeader{Kind: kind, SessionID: t.SessionID, Party: party, NumRows: numRows}
+	return api.CreateFile(path, header, t.SigningKey)
+}
+
+// open opens the file at path, whose signature is verified.
+func (t *Files) open(path string, kind api.FileKind) (*api.FileReader, error) {
+	if path == "" {
+		return nil, fmt.Errorf("no path for the %s", kind)
+	}
+	return api.OpenFile(path, t.VerifyingKey)
+}
+
+// AuthenticatesSetup implements SetupAuthenticator. The setup is authenticated by the signature of the setup
+// file, provided that VerifyingKey only accepts the receiver's key for it.
+func (t *Files) AuthenticatesSetup() bool {
+	return true
+}
+
+// SendSetup implements Transport. It writes the setup file.
+func (t *Files) SendSetup(_ context.Context, setup api.Setup) error {
+	fw, err := t.create(t.SetupPath, api.SetupFile, t.Party, 1)
+	if err != nil {
+		return err
+	}
+	defer fw.Abort()
+	if err := fw.WriteSetup(setup); err != nil {
+		return err
+	}
+	return fw.Close()
+}
+
+// RecvSetup implements Transport. It reads the setup file.
+func (t *Files) RecvSetup(_ context.Context) (api.Setup, error) {
+	fr, err := t.open(t.SetupPath, api.SetupFile)
+	if err != nil {
+		return api.Setup{}, err
+	}
+	defer fr.Close()
+	return fr.ReadSetup()
+}
+
+// PushRows implements Transport. It writes the source's file, which is removed unless the stream is closed
+// before ctx is done.
+func (t *Files) PushRows(ctx context.Context, source mppj.SourceID, numRows int) (RowSender[*pb.EncRow], error) {
+	fw, err := t.create(t.SourcePath, api.SourceFile, string(source), numRows)
+	if err != nil {
+		return nil, err
+	}
+	return newFileSender(ctx, fw, fw.WriteEncRowMsgs), nil
+}
+
+// PullRows implements Transport. It reads the helper's file.
+func (t *Files) PullRows(_ context.Context) (RowReceiver[*pb.EncRowWithHint], error) {
+	fr, err := t.open(t.HelperPath, api.HelperFile)
+	if err != nil {
+		return nil, err
+	}
+	return newFileReceiver(fr.Header().NumRows, fr.EncRowWithHintMsgs(), fr.Close), nil
+}
+
+// Close implements Transport.
+func (t *Files) Close() error {
+	return nil
+}
+
+// Serve implements HelperTransport. It passes the setup file to h if there is one, then the files of the
+// sources, and writes the helper's file with the rows sent by h. It returns once the helper's file is
+// written.
+func (t *Files) Serve(ctx context.Context, h Handler) error {
+	if t.SetupPath != "" {
+		setup, err := t.RecvSetup(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to read the setup: %w", err)
+		}
+		if err := h.HandleSetup(ctx, setup); err != nil {
+			return err
+		}
+	}
+
+	files, err := t.openSourceFiles()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, fr := range files {
+			fr.Close()
+		}
+	}()
+
+	pushCtx, abort := context.WithCancelCause(ctx)
+	defer abort(nil)
+	var wg sync.WaitGroup
+	for _, fr := range files {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rows := newFileReceiver(fr.Header().NumRows, fr.EncRowMsgs(), func() error { return nil })
+			defer rows.Close() // the files are closed once all are handled
+			if err := h.HandlePush(pushCtx, mppj.SourceID(fr.Header().Party), rows); err != nil {
+				abort(fmt.Errorf("failed to handle the file of %s: %w", fr.Header().Party, err))
+			}
+		}()
+	}
+	wg.Wait()
+	if err := context.Cause(pushCtx); err != nil {
+		return err
+	}
+
+	return h.HandlePull(ctx, func(numRows int) (RowSender[*pb.EncRowWithHint], error) {
+		fw, err := t.create(t.HelperPath, api.HelperFile, t.Party, numRows)
+		if err != nil {
+			return nil, err
+		}
+		return newFileSender(ctx, fw, fw.WriteEncRowWithHintMsgs), nil
+	})
+}
+
+// openSourceFiles opens the files of the sources in the source directory, whose signatures are verified.
+// There must be exactly one file per source.
+func (t *Files) openSourceFiles() ([]*api.FileReader, error) {
+	entries, err := os.ReadDir(t.SourceDir)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]*api.FileReader, len(t.Sources))
+	closeAll := func() {
+		for _, fr := range files {
+			if fr != nil {
+				fr.Close()
+			}
+		}
+	}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		fr, err := t.open(filepath.Join(t.SourceDir, entry.Name()), api.SourceFile)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		i := slices.Index(t.Sources, mppj.SourceID(fr.Header().Party))
+		if i < 0 || files[i] != nil {
+			fr.Close()
+			closeAll()
+			if i < 0 {
+				return nil, fmt.Errorf("%w: %s", ErrUnexpectedSource, fr.Header().Party)
+			}
+			return nil, fmt.Errorf("several files of source %s", t.Sources[i])
+		}
+		files[i] = fr
+	}
+	for i, fr := range files {
+		if fr == nil {
+			closeAll()
+			return nil, fmt.Errorf("no file of source %s in %s", t.Sources[i], t.SourceDir)
+		}
+	}
+	return files, nil
+}
+
+// fileSender writes the messages of a stream to a file, which is removed if ctx is done before the stream is
+// closed.
+type fileSender[M any] struct {
+	ctx   context.Context
+	fw    *api.FileWriter
+	write func([]M) error
+	abort func()      // removes the file, once
+	stop  func() bool // stops the removal of the file when ctx is done
+}
+
+func newFileSender[M any](ctx context.Context, fw *api.FileWriter, write func([]M) error) *fileSender[M] {
+	abort := sync.OnceFunc(fw.Abort)
+	return &fileSender[M]{ctx: ctx, fw: fw, write: write, abort: abort, stop: context.AfterFunc(ctx, abort)}
+}
+
+func (s *fileSender[M]) Send(msgs []M) error {
+	if err := context.Cause(s.ctx); err != nil {
+		return err
+	}
+	return s.write(msgs)
+}
+
+func (s *fileSender[M]) Close() error {
+	if !s.stop() {
+		s.abort() // waits for the removal
+		return context.Cause(s.ctx)
+	}
+	return s.fw.Close()
+}
+
+// fileReceiver reads the messages of a stream from a file.
+type fileReceiver[M any] struct {
+	numRows int
+	next    func() (M, error, bool)
+	stop    func()
+	close   func() error
+}
+
+func newFileReceiver[M any](numRows int, msgs iter.Seq2[M, error], close func() error) *fileReceiver[M] {
+	next, stop := iter.Pull2(msgs)
+	return &fileReceiver[M]{numRows: numRows, next: next, stop: stop, close: close}
+}
+
+func (r *fileReceiver[M]) NumRows() int { return r.numRows }
+
+func (r *fileReceiver[M]) Recv() ([]M, error) {
+	var msgs []M
+	for len(msgs) < fileBatchSize {
+		msg, err, ok := r.next()
+		if !ok {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, msg)
+	}
+	if len(msgs) == 0 {
+		return nil, io.EOF
+	}
+	return msgs, nil
+}
+
+func (r *fileReceiver[M]) Close() error {
+	r.stop()
+	return r.close()
+}
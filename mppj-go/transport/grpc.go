@@ -0,0 +1,364 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mppj"
+	"mppj/api"
+	"mppj/api/pb"
+	"net"
+	"strconv"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// numRowsKey is the metadata key of the number of rows of a stream, which the sources send in their request
+// and the helper sends in the header of its response.
+const numRowsKey = "num_rows"
+
+// MaxBatchSize is the maximum number of rows per message of the batched streams, so that the messages of rows
+// with values of up to a few hundred bytes stay below gRPC's default maximum message size of 4 MiB.
+const MaxBatchSize = 1024
+
+// GRPC is the transport of a source or of the receiver to the helper's gRPC server.
+type GRPC struct {
+	conn      *grpc.ClientConn
+	client    pb.MPPJHelperClient
+	batchSize int
+}
+
+var _ Transport = (*GRPC)(nil)
+
+// NewGRPC returns the transport to the helper's server at addr, which sends and receives the rows in batches
+// of batchSize rows per message (at most MaxBatchSize), or with the single-row messages if batchSize is 1.
+func NewGRPC(addr string, batchSize int, opts ...grpc.DialOption) (*GRPC, error) {
+	if batchSize <= 0 || batchSize > MaxBatchSize {
+		return nil, fmt.Errorf("batch size must be between 1 and %d", MaxBatchSize)
+	}
+	conn, err := grpc.NewClient(addr, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to helper: %w", err)
+	}
+	return &GRPC{conn: conn, client: pb.NewMPPJHelperClient(conn), batchSize: batchSize}, nil
+}
+
+// SendSetup implements Transport.
+func (t *GRPC) SendSetup(ctx context.Context, setup api.Setup) error {
+	msg, err := api.GetSetupMsg(setup)
+	if err != nil {
+		return err
+	}
+	_, err = t.client.SendSetup(ctx, msg)
+	return err
+}
+
+// RecvSetup implements Transport. It waits for the helper to be ready.
+func (t *GRPC) RecvSetup(ctx context.Context) (api.Setup, error) {
+	msg, err := t.client.GetSetup(ctx, &pb.Void{}, grpc.WaitForReady(true))
+	if err != nil {
+		return api.Setup{}, err
+	}
+	return api.GetSetupFromMsg(msg)
+}
+
+// PushRows implements Transport.
+func (t *GRPC) PushRows(ctx context.Context, source mppj.SourceID, numRows int) (RowSender[*pb.EncRow], error) {
+	ctx = mppj.SourceIDToOutgoingContext(ctx, source)
+	ctx = metadata.AppendToOutgoingContext(ctx, numRowsKey, strconv.Itoa(numRows))
+	if t.batchSize == 1 {
+		stream, err := t.client.PushRows(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return &grpcRowSender[*pb.EncRow]{
+			batchSize: 1,
+			send:      func(msgs []*pb.EncRow) error { return stream.Send(msgs[0]) },
+			close: func() error {
+				_, err := stream.CloseAndRecv()
+				return err
+			},
+		}, nil
+	}
+	stream, err := t.client.PushRowBatches(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &grpcRowSender[*pb.EncRow]{
+		batchSize: t.batchSize,
+		send:      func(msgs []*pb.EncRow) error { return stream.Send(&pb.EncRowBatch{Rows: msgs}) },
+		close: func() error {
+			_, err := stream.CloseAndRecv()
+			return err
+		},
+	}, nil
+}
+
+// PullRows implements Transport. The number of rows is read from the header of the helper's response, which
+// is sent once the rows are converted.
+func (t *GRPC) PullRows(ctx context.Context) (RowReceiver[*pb.EncRowWithHint], error) {
+	ctx, cancel := context.WithCancel(ctx) // closing the receiver cancels the stream, which ends the helper's
+	var stream grpc.ClientStream
+	var recv func() ([]*pb.EncRowWithHint, error)
+	if t.batchSize == 1 {
+		s, err := t.client.PullRows(ctx, &pb.Void{})
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		stream, recv = s, func() ([]*pb.EncRowWithHint, error) {
+			msg, err := s.Recv()
+			if err != nil {
+				return nil, err
+			}
+			return []*pb.EncRowWithHint{msg}, nil
+		}
+	} else {
+		s, err := t.client.PullRowBatches(ctx, &pb.BatchRequest{BatchSize: uint32(t.batchSize)})
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		stream, recv = s, func() ([]*pb.EncRowWithHint, error) {
+			msg, err := s.Recv()
+			if err != nil {
+				return nil, err
+			}
+			return msg.Rows, nil
+		}
+	}
+	md, err := stream.Header()
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to get stream header: %w", err)
+	}
+	numRows, err := readNumRows(md)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	var received int // the helper ends the stream once the receiver closes it, after the announced rows
+	counted := func() ([]*pb.EncRowWithHint, error) {
+		if received >= numRows {
+			return nil, io.EOF
+		}
+		msgs, err := recv()
+		if err == io.EOF {
+			return nil, fmt.Errorf("%w: received %d of the %d rows", mppj.ErrTooFewRows, received, numRows)
+		}
+		received += len(msgs)
+		return msgs, err
+	}
+	return &grpcRowReceiver[*pb.EncRowWithHint]{numRows: numRows, recv: counted, close: func() error {
+		err := stream.CloseSend()
+		cancel()
+		return err
+	}}, nil
+}
+
+// Close implements Transport.
+func (t *GRPC) Close() error {
+	return t.conn.Close()
+}
+
+// readNumRows reads the number of rows of a stream from its metadata.
+func readNumRows(md metadata.MD) (int, error) {
+	vals := md.Get(numRowsKey)
+	if len(vals) == 0 {
+		return 0, fmt.Errorf("no %s in the stream's metadata", numRowsKey)
+	}
+	numRows, err := strconv.Atoi(vals[0])
+	if err != nil || numRows < 0 {
+		return 0, fmt.Errorf("invalid %s in the stream's metadata: %q", numRowsKey, vals[0])
+	}
+	return numRows, nil
+}
+
+// grpcRowSender sends the messages of a stream in batches of batchSize messages, the last batch being sent
+// when the stream is closed.
+type grpcRowSender[M any] struct {
+	batchSize int
+	send      func([]M) error
+	close     func() error
+	batch     []M // the messages waiting for a full batch
+}
+
+func (s *grpcRowSender[M]) Send(msgs []M) error {
+	s.batch = append(s.batch, msgs...)
+	for len(s.batch) >= s.batchSize {
+		if err := s.send(s.batch[:s.batchSize]); err != nil {
+			return err
+		}
+		s.batch = s.batch[s.batchSize:]
+	}
+	return nil
+}
+
+func (s *grpcRowSender[M]) Close() error {
+	if len(s.batch) > 0 {
+		if err := s.send(s.batch); err != nil {
+			return err
+		}
+		s.batch = nil
+	}
+	return s.close()
+}
+
+// grpcRowReceiver receives the messages of a stream.
+type grpcRowReceiver[M any] struct {
+	numRows int
+	recv    func() ([]M, error)
+	close   func() error
+}
+
+func (r *grpcRowReceiver[M]) NumRows() int       { return r.numRows }
+func (r *grpcRowReceiver[M]) Recv() ([]M, error) { return r.recv() }
+func (r *grpcRowReceiver[M]) Close() error       { return r.close() }
+
+// GRPCHelper is the transport of the helper, which serves the MPPJHelper service.
+type GRPCHelper struct {
+	lis  net.Listener
+	opts []grpc.ServerOption
+}
+
+var _ HelperTransport = (*GRPCHelper)(nil)
+
+// NewGRPCHelper returns the transport which serves the MPPJHelper service on lis.
+func NewGRPCHelper(lis net.Listener, opts ...grpc.ServerOption) *GRPCHelper {
+	return &GRPCHelper{lis: lis, opts: opts}
+}
+
+// Serve implements HelperTransport. It serves h until ctx is done, and then stops the server, which cancels
+// the remaining streams.
+func (t *GRPCHelper) Serve(ctx context.Context, h Handler) error {
+	srv := grpc.NewServer(t.opts...)
+	pb.RegisterMPPJHelperServer(srv, &grpcServer{h: h, setup: newSetupRelay()})
+	errc := make(chan error, 1)
+	go func() { errc <- srv.Serve(t.lis) }()
+	select {
+	case err := <-errc:
+		return fmt.Errorf("error during serve: %w", err)
+	case <-ctx.Done():
+		srv.Stop()
+		return nil
+	}
+}
+
+// grpcServer is the MPPJHelper service, which passes the messages to the handler.
+type grpcServer struct {
+	h     Handler
+	setup *setupRelay
+	pb.UnimplementedMPPJHelperServer
+}
+
+func (s *grpcServer) SendSetup(ctx context.Context, msg *pb.Setup) (*pb.Void, error) {
+	if err := s.setup.send(ctx, s.h, msg); err != nil {
+		return nil, toStatus(err)
+	}
+	return &pb.Void{}, nil
+}
+
+func (s *grpcServer) GetSetup(ctx context.Context, _ *pb.Void) (*pb.Setup, error) {
+	msg, err := s.setup.recv(ctx)
+	return msg, toStatus(err)
+}
+
+func (s *grpcServer) PushRows(stream pb.MPPJHelper_PushRowsServer) error {
+	return s.handlePush(stream.Context(), func() ([]*pb.EncRow, error) {
+		msg, err := stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+		return []*pb.EncRow{msg}, nil
+	}, func() error { return stream.SendAndClose(&pb.Void{}) })
+}
+
+func (s *grpcServer) PushRowBatches(stream pb.MPPJHelper_PushRowBatchesServer) error {
+	return s.handlePush(stream.Context(), func() ([]*pb.EncRow, error) {
+		msg, err := stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+		return msg.Rows, nil
+	}, func() error { return stream.SendAndClose(&pb.Void{}) })
+}
+
+// handlePush passes the rows of a source to the handler, and calls done once they are all received.
+func (s *grpcServer) handlePush(ctx context.Context, recv func() ([]*pb.EncRow, error), done func() error) error {
+	source, ok := mppj.SourceIDFromIncomingContext(ctx)
+	if !ok {
+		return status.Error(codes.Unauthenticated, "missing source ID")
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	numRows, err := readNumRows(md)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	rows := &grpcRowReceiver[*pb.EncRow]{numRows: numRows, recv: recv, close: func() error { return nil }}
+	if err := s.h.HandlePush(ctx, source, rows); err != nil {
+		return toStatus(err)
+	}
+	return done()
+}
+
+func (s *grpcServer) PullRows(_ *pb.Void, stream grpc.ServerStreamingServer[pb.EncRowWithHint]) error {
+	return s.handlePull(stream, 1, func(msgs []*pb.EncRowWithHint) error { return stream.Send(msgs[0]) })
+}
+
+func (s *grpcServer) PullRowBatches(req *pb.BatchRequest, stream grpc.ServerStreamingServer[pb.EncRowWithHintBatch]) error {
+	if req.BatchSize == 0 {
+		return status.Error(codes.InvalidArgument, "batch size must be positive")
+	}
+	batchSize := min(int(req.BatchSize), MaxBatchSize) // bounds the messages whatever the receiver requests
+	return s.handlePull(stream, batchSize, func(msgs []*pb.EncRowWithHint) error {
+		return stream.Send(&pb.EncRowWithHintBatch{Rows: msgs})
+	})
+}
+
+// handlePull lets the handler send the converted rows, in batches of batchSize rows sent with send. Closing
+// the stream waits for the receiver to close it.
+func (s *grpcServer) handlePull(stream grpc.ServerStream, batchSize int, send func([]*pb.EncRowWithHint) error) error {
+	ctx := stream.Context()
+	err := s.h.HandlePull(ctx, func(numRows int) (RowSender[*pb.EncRowWithHint], error) {
+		if err := stream.SendHeader(metadata.Pairs(numRowsKey, strconv.Itoa(numRows))); err != nil {
+			return nil, err
+		}
+		return &grpcRowSender[*pb.EncRowWithHint]{
+			batchSize: batchSize,
+			send:      send,
+			close: func() error {
+				<-ctx.Done() // waits for the receiver to close
+				return nil
+			},
+		}, nil
+	})
+	return toStatus(err)
+}
+
+// toStatus returns the gRPC status error of a handler's error.
+func toStatus(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	code := codes.Unknown
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return status.FromContextError(err).Err()
+	case errors.Is(err, ErrUnexpectedSource):
+		code = codes.NotFound
+	case errors.Is(err, ErrAborted):
+		code = codes.Aborted
+	case errors.Is(err, api.ErrMalformedMessage), errors.Is(err, api.ErrUnsupportedVersion),
+		errors.Is(err, mppj.ErrTooManyRows), errors.Is(err, mppj.ErrTooFewRows),
+		errors.Is(err, mppj.ErrInvalidRow):
+		code = codes.InvalidArgument
+	}
+	return status.Error(code, err.Error())
+}
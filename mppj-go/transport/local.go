@@ -0,0 +1,250 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mppj"
+	"mppj/api"
+	"mppj/api/pb"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// localQueueSize is the number of batches of messages which can wait in the channel of a stream.
+const localQueueSize = 16
+
+// Local is the in-process transport of parties which run in the same process, and exchange their messages
+// over channels. It is the transport of the sources and the receiver, as well as that of the helper.
+type Local struct {
+	once     sync.Once
+	ready    chan struct{} // closed once the helper serves
+	h        Handler
+	serveCtx context.Context
+	setup    *setupRelay
+}
+
+var (
+	_ Transport          = (*Local)(nil)
+	_ HelperTransport    = (*Local)(nil)
+	_ SetupAuthenticator = (*Local)(nil)
+)
+
+// NewLocal returns a new in-process transport.
+func NewLocal() *Local {
+	return &Local{ready: make(chan struct{}), setup: newSetupRelay()}
+}
+
+// Serve implements HelperTransport. It passes the messages to h until ctx is done, which aborts the remaining
+// streams.
+func (t *Local) Serve(ctx context.Context, h Handler) error {
+	served := false
+	t.once.Do(func() {
+		t.h, t.serveCtx = h, ctx
+		close(t.ready)
+		served = true
+	})
+	if !served {
+		return errors.New("the transport is already served")
+	}
+	<-ctx.Done()
+	return nil
+}
+
+// handler waits for the helper to serve, and returns its handler with the context of a stream, which is
+// cancelled once the helper stops.
+func (t *Local) handler(ctx context.Context) (Handler, context.Context, context.CancelFunc, error) {
+	select {
+	case <-t.ready:
+	case <-ctx.Done():
+		return nil, nil, nil, context.Cause(ctx)
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	stop := context.AfterFunc(t.serveCtx, func() { cancel(fmt.Errorf("%w: the helper stopped", ErrAborted)) })
+	return t.h, ctx, func() { stop(); cancel(nil) }, nil
+}
+
+// AuthenticatesSetup implements SetupAuthenticator. The setup is authenticated, as the parties run in the
+// same process.
+func (t *Local) AuthenticatesSetup() bool {
+	return true
+}
+
+// SendSetup implements Transport. It waits for the helper to serve.
+func (t *Local) SendSetup(ctx context.Context, setup api.Setup) error {
+	h, ctx, cancel, err := t.handler(ctx)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+	msg, err := api.GetSetupMsg(setup)
+	if err != nil {
+		return err
+	}
+	return t.setup.send(ctx, h, msg)
+}
+
+// RecvSetup implements Transport.
+func (t *Local) RecvSetup(ctx context.Context) (api.Setup, error) {
+	msg, err := t.setup.recv(ctx)
+	if err != nil {
+		return api.Setup{}, err
+	}
+	return api.GetSetupFromMsg(msg)
+}
+
+// PushRows implements Transport. It waits for the helper to serve.
+func (t *Local) PushRows(ctx context.Context, source mppj.SourceID, numRows int) (RowSender[*pb.EncRow], error) {
+	h, ctx, cancel, err := t.handler(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p := newPipe[*pb.EncRow](ctx, numRows)
+	go func() {
+		defer cancel()
+		p.finish(h.HandlePush(ctx, source, pipeReceiver[*pb.EncRow]{p: p}))
+	}()
+	return pipeSender[*pb.EncRow]{p}, nil
+}
+
+// PullRows implements Transport. It waits for the helper to serve.
+func (t *Local) PullRows(ctx context.Context) (RowReceiver[*pb.EncRowWithHint], error) {
+	h, ctx, cancel, err := t.handler(ctx)
+	if err != nil {
+		return nil, err
+	}
+	opened := make(chan *pipe[*pb.EncRowWithHint], 1)
+	failed := make(chan error, 1)
+	go func() {
+		defer cancel()
+		var p *pipe[*pb.EncRowWithHint]
+		err := h.HandlePull(ctx, func(numRows int) (RowSender[*pb.EncRowWithHint], error) {
+			if p != nil {
+				return nil, errors.New("the stream is already open")
+			}
+			p = newPipe[*pb.EncRowWithHint](ctx, numRows)
+			opened <- p
+			return pipeSender[*pb.EncRowWithHint]{p}, nil
+		})
+		switch {
+		case p == nil && err == nil:
+			failed <- errors.New("the helper sent no rows")
+		case p == nil:
+			failed <- err
+		case err == nil && !p.closed.Load():
+			p.finish(errors.New("the helper did not send all the rows"))
+		case err != nil:
+			p.finish(err)
+		}
+	}()
+	select {
+	case p := <-opened:
+		return pipeReceiver[*pb.EncRowWithHint]{p: p, ends: true}, nil
+	case err := <-failed:
+		return nil, err
+	case <-ctx.Done():
+		return nil, context.Cause(ctx)
+	}
+}
+
+// Close implements Transport.
+func (t *Local) Close() error {
+	return nil
+}
+
+// pipe is a stream of messages between the goroutines of two parties.
+type pipe[M any] struct {
+	ctx     context.Context
+	numRows int
+	msgs    chan []M
+	closed  atomic.Bool   // whether the sender closed the stream
+	done    chan struct{} // closed once the stream ends, with err
+	err     error
+	end     sync.Once
+}
+
+func newPipe[M any](ctx context.Context, numRows int) *pipe[M] {
+	return &pipe[M]{ctx: ctx, numRows: numRows, msgs: make(chan []M, localQueueSize), done: make(chan struct{})}
+}
+
+// finish ends the stream with err, which is nil once the receiver got all the messages.
+func (p *pipe[M]) finish(err error) {
+	p.end.Do(func() {
+		p.err = err
+		close(p.done)
+	})
+}
+
+// failure returns the error of a stream which ended before all its messages were received.
+func (p *pipe[M]) failure() error {
+	if p.err != nil {
+		return p.err
+	}
+	return errors.New("the stream was closed by the other party")
+}
+
+// cause returns the error of a stream whose context is done, unless the stream ended meanwhile.
+func (p *pipe[M]) cause() error {
+	select {
+	case <-p.done:
+		return p.err
+	default:
+		return context.Cause(p.ctx)
+	}
+}
+
+// pipeSender is the sending end of a pipe.
+type pipeSender[M any] struct{ p *pipe[M] }
+
+func (s pipeSender[M]) Send(msgs []M) error {
+	select {
+	case s.p.msgs <- slices.Clone(msgs): // the caller may reuse msgs
+		return nil
+	case <-s.p.done:
+		return s.p.failure()
+	case <-s.p.ctx.Done():
+		return s.p.cause()
+	}
+}
+
+func (s pipeSender[M]) Close() error {
+	s.p.closed.Store(true)
+	close(s.p.msgs)
+	select {
+	case <-s.p.done:
+		return s.p.err
+	case <-s.p.ctx.Done():
+		return s.p.cause()
+	}
+}
+
+// pipeReceiver is the receiving end of a pipe.
+type pipeReceiver[M any] struct {
+	p    *pipe[M]
+	ends bool // whether closing the receiver ends the stream, which otherwise ends once the handler returns
+}
+
+func (r pipeReceiver[M]) NumRows() int { return r.p.numRows }
+
+func (r pipeReceiver[M]) Recv() ([]M, error) {
+	select {
+	case msgs, ok := <-r.p.msgs:
+		if !ok {
+			return nil, io.EOF
+		}
+		return msgs, nil
+	case <-r.p.done:
+		return nil, r.p.failure()
+	case <-r.p.ctx.Done():
+		return nil, r.p.cause()
+	}
+}
+
+func (r pipeReceiver[M]) Close() error {
+	if r.ends {
+		r.p.finish(nil)
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+// Package transport carries the messages of the protocol between the parties, so that the same code runs the
+// parties over gRPC (GRPC and GRPCHelper), within a process (Local), or over signed files for air-gapped
+// deployments (Files). The sources and the receiver use a Transport, and the helper serves a Handler with a
+// HelperTransport.
+//
+// The rows are carried as their messages (see api.GetEncRowMsg and api.GetEncRowWithHintMsg), which the
+// parties encode and decode, possibly in parallel.
+package transport
+
+import (
+	"context"
+	"errors"
+	"mppj"
+	"mppj/api"
+	"mppj/api/pb"
+	"sync"
+)
+
+// The errors returned by handlers, which the transports report to the other party.
+var (
+	// ErrUnexpectedSource is returned for the rows of a source which the helper does not expect.
+	ErrUnexpectedSource = errors.New("unexpected source")
+	// ErrAborted is returned once the session is aborted.
+	ErrAborted = errors.New("session aborted")
+)
+
+// RowSender sends a stream of row messages.
+type RowSender[M any] interface {
+	// Send sends the messages.
+	Send(msgs []M) error
+	// Close ends the stream once all the messages are sent, and returns once the other party received them.
+	Close() error
+}
+
+// RowReceiver receives a stream of row messages.
+type RowReceiver[M any] interface {
+	// NumRows returns the number of rows of the stream, as announced by the other party.
+	NumRows() int
+	// Recv receives the next messages, and returns io.EOF at the end of the stream.
+	Recv() ([]M, error)
+	// Close releases the stream, and tells the other party that the messages were received.
+	Close() error
+}
+
+// Transport carries the messages of a source or of the receiver.
+type Transport interface {
+	// SendSetup sends the receiver's setup message to the helper, which relays it to the sources.
+	SendSetup(ctx context.Context, setup api.Setup) error
+	// RecvSetup receives the receiver's setup message, once it was sent.
+	RecvSetup(ctx context.Context) (api.Setup, error)
+	// PushRows opens the stream of the numRows rows of a source to the helper.
+	PushRows(ctx context.Context, source mppj.SourceID, numRows int) (RowSender[*pb.EncRow], error)
+	// PullRows opens the stream of the converted rows from the helper.
+	PullRows(ctx context.Context) (RowReceiver[*pb.EncRowWithHint], error)
+	// Close releases the transport.
+	Close() error
+}
+
+// Handler handles the messages received by the helper.
+type Handler interface {
+	// HandleSetup checks the receiver's setup message, which is relayed to the sources if it returns nil.
+	HandleSetup(ctx context.Context, setup api.Setup) error
+	// HandlePush receives the rows of a source, and returns once they were all received.
+	HandlePush(ctx context.Context, source mppj.SourceID, rows RowReceiver[*pb.EncRow]) error
+	// HandlePull sends the converted rows to the receiver, with the stream opened by open for their number.
+	HandlePull(ctx context.Context, open func(numRows int) (RowSender[*pb.EncRowWithHint], error)) error
+}
+
+// HelperTransport carries the messages of the helper.
+type HelperTransport interface {
+	// Serve passes the messages of the other parties to h, until ctx is done or the transport has no more
+	// messages.
+	Serve(ctx context.Context, h Handler) error
+}
+
+// SetupAuthenticator is implemented by the transports which authenticate the receiver's setup, so that the
+// helper and the sources can take the receiver's public keys from it. Over the other transports, anyone who
+// reaches the helper can send a setup with their own keys, which the parties must then know beforehand.
+type SetupAuthenticator interface {
+	// AuthenticatesSetup returns whether the setup received over the transport was sent by the receiver.
+	AuthenticatesSetup() bool
+}
+
+// AuthenticatesSetup returns whether the transport t authenticates the receiver's setup.
+func AuthenticatesSetup(t any) bool {
+	a, ok := t.(SetupAuthenticator)
+	return ok && a.AuthenticatesSetup()
+}
+
+// setupRelay relays the setup message of the receiver to the sources, once the handler accepted it. The
+// message is kept encoded, and decoded for each source, as the keys of a setup must not be shared between
+// goroutines.
+type setupRelay struct {
+	mu   sync.Mutex
+	msg  *pb.Setup
+	done chan struct{} // closed once the setup is accepted
+}
+
+func newSetupRelay() *setupRelay {
+	return &setupRelay{done: make(chan struct{})}
+}
+
+// send passes the setup to h, and relays it if h accepts it. The setup is sent at most once.
+func (r *setupRelay) send(ctx context.Context, h Handler, msg *pb.Setup) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.msg != nil {
+		return errors.New("the setup was already sent")
+	}
+	setup, err := api.GetSetupFromMsg(msg)
+	if err != nil {
+		return err
+	}
+	if err := h.HandleSetup(ctx, setup); err != nil {
+		return err
+	}
+	r.msg = msg
+	close(r.done)
+	return nil
+}
+
+// recv returns the setup message once it is accepted, or the cause of ctx once ctx is done.
+func (r *setupRelay) recv(ctx context.Context) (*pb.Setup, error) {
+	select {
+	case <-r.done:
+		return r.msg, nil
+	case <-ctx.Done():
+		return nil, context.Cause(ctx)
+	}
+}
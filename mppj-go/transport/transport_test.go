@@ -0,0 +1,400 @@
+package transport_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mppj"
+	"mppj/api"
+	"mppj/api/pb"
+	"mppj/transport"
+	"mppj/transport/transporttest"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+const testRows = 20
+
+var testSources = []mppj.SourceID{"ds1", "ds2"}
+
+// testMsg returns the message of the i-th row of a source, whose contents identify the row.
+func testMsg(source mppj.SourceID, i int) *pb.EncRow {
+	return &pb.EncRow{Cuid: &pb.Ciphertext{C0: fmt.Appendf(nil, "%s/%d", source, i)}}
+}
+
+// relayHandler is a helper which does not convert the rows, but sends the rows pushed by the sources back to
+// the receiver, in the order of the sources.
+type relayHandler struct {
+	sid    []byte
+	mu     sync.Mutex
+	pushed map[mppj.SourceID][]*pb.EncRow // the rows of the sources which started pushing
+	left   int                            // the number of sources which did not push all their rows
+	done   chan struct{}                  // closed once all the sources pushed their rows
+}
+
+func newRelayHandler(sid []byte) *relayHandler {
+	return &relayHandler{sid: sid, pushed: make(map[mppj.SourceID][]*pb.EncRow), left: len(testSources), done: make(chan struct{})}
+}
+
+func (h *relayHandler) HandleSetup(_ context.Context, setup api.Setup) error {
+	if !bytes.Equal(setup.SessionID, h.sid) {
+		return errors.New("unexpected setup")
+	}
+	return nil
+}
+
+func (h *relayHandler) HandlePush(_ context.Context, source mppj.SourceID, rows transport.RowReceiver[*pb.EncRow]) error {
+	h.mu.Lock()
+	_, pushed := h.pushed[source]
+	if !slices.Contains(testSources, source) || pushed {
+		h.mu.Unlock()
+		return fmt.Errorf("%w: %s", transport.ErrUnexpectedSource, source)
+	}
+	h.pushed[source] = nil
+	h.mu.Unlock()
+	if rows.NumRows() != testRows {
+		return fmt.Errorf("%w: %d rows", mppj.ErrTooManyRows, rows.NumRows())
+	}
+	var received []*pb.EncRow
+	for {
+		msgs, err := rows.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		received = append(received, msgs...)
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.pushed[source] = received
+	if h.left--; h.left == 0 {
+		close(h.done)
+	}
+	return nil
+}
+
+func (h *relayHandler) HandlePull(ctx context.Context, open func(numRows int) (transport.RowSender[*pb.EncRowWithHint], error)) error {
+	select {
+	case <-h.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	var msgs []*pb.EncRowWithHint
+	for _, id := range testSources {
+		for _, msg := range h.pushed[id] {
+			msgs = append(msgs, &pb.EncRowWithHint{CVal: msg.GetCuid().GetC0()})
+		}
+	}
+	rows, err := open(len(msgs))
+	if err != nil {
+		return err
+	}
+	for chunk := range slices.Chunk(msgs, 7) {
+		if err := rows.Send(chunk); err != nil {
+			return err
+		}
+	}
+	return rows.Close()
+}
+
+// pushRows receives the setup of the session sid, and pushes the rows of a source.
+func pushRows(ctx context.Context, tr transport.Transport, sid []byte, source mppj.SourceID) error {
+	setup, err := tr.RecvSetup(ctx)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(setup.SessionID, sid) {
+		return errors.New("received the setup of another session")
+	}
+	rows, err := tr.PushRows(ctx, source, testRows)
+	if err != nil {
+		return err
+	}
+	msgs := make([]*pb.EncRow, testRows)
+	for i := range msgs {
+		msgs[i] = testMsg(source, i)
+	}
+	for chunk := range slices.Chunk(msgs, 3) {
+		if err := rows.Send(chunk); err != nil {
+			return err
+		}
+	}
+	return rows.Close()
+}
+
+// pullRows pulls the rows relayed by the helper, and checks them against the rows pushed by the sources.
+func pullRows(ctx context.Context, tr transport.Transport) error {
+	rows, err := tr.PullRows(ctx)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	var received []*pb.EncRowWithHint
+	for {
+		msgs, err := rows.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		received = append(received, msgs...)
+	}
+	if n := len(testSources) * testRows; rows.NumRows() != n || len(received) != n {
+		return fmt.Errorf("received %d rows, announced %d, expected %d", len(received), rows.NumRows(), n)
+	}
+	for i, msg := range received {
+		expected := testMsg(testSources[i/testRows], i%testRows).GetCuid().GetC0()
+		if !bytes.Equal(msg.GetCVal(), expected) {
+			return fmt.Errorf("row %d is %q, expected %q", i, msg.GetCVal(), expected)
+		}
+	}
+	return nil
+}
+
+// runRelay runs the parties concurrently, with the transports of the helper, the sources and the receiver:
+// the receiver sends its setup, which the sources receive before pushing their rows, and pulls the rows.
+func runRelay(t *testing.T, helper transport.HelperTransport, source func(mppj.SourceID) transport.Transport, receiver transport.Transport) {
+	t.Helper()
+	sid := mppj.NewSessionID(2, "helper", "receiver", testSources)
+	_, rpk := mppj.ReceiverKeyGen()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	serveCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	served := make(chan error, 1)
+	go func() { served <- helper.Serve(serveCtx, newRelayHandler(sid)) }()
+
+	pushed := make(chan error, len(testSources))
+	for _, id := range testSources {
+		tr := source(id)
+		go func() { pushed <- pushRows(ctx, tr, sid, id) }()
+	}
+	if err := receiver.SendSetup(ctx, api.Setup{SessionID: sid, ReceiverPK: rpk}); err != nil {
+		t.Fatalf("SendSetup failed: %v", err)
+	}
+	if err := receiver.SendSetup(ctx, api.Setup{SessionID: sid, ReceiverPK: rpk}); err == nil {
+		t.Fatal("expected an error for a second setup")
+	}
+	if err := pullRows(ctx, receiver); err != nil {
+		t.Fatalf("failed to pull the rows: %v", err)
+	}
+	for range testSources {
+		if err := <-pushed; err != nil {
+			t.Fatalf("failed to push the rows: %v", err)
+		}
+	}
+	stop()
+	if err := <-served; err != nil {
+		t.Fatalf("Serve failed: %v", err)
+	}
+}
+
+func TestLocal(t *testing.T) {
+	tr := transport.NewLocal()
+	runRelay(t, tr, func(mppj.SourceID) transport.Transport { return tr }, tr)
+}
+
+func TestGRPC(t *testing.T) {
+	for _, batchSize := range []int{1, 8} {
+		t.Run(fmt.Sprintf("batch=%d", batchSize), func(t *testing.T) {
+			lis, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			dial := func() transport.Transport {
+				tr, err := transport.NewGRPC(lis.Addr().String(), batchSize, grpc.WithTransportCredentials(insecure.NewCredentials()))
+				if err != nil {
+					t.Fatal(err)
+				}
+				t.Cleanup(func() { tr.Close() })
+				return tr
+			}
+			runRelay(t, transport.NewGRPCHelper(lis), func(mppj.SourceID) transport.Transport { return dial() }, dial())
+		})
+	}
+}
+
+func TestGRPCErrors(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sid := mppj.NewSessionID(2, "helper", "receiver", testSources)
+	_, rpk := mppj.ReceiverKeyGen()
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	go transport.NewGRPCHelper(lis).Serve(ctx, newRelayHandler(sid))
+
+	tr, err := transport.NewGRPC(lis.Addr().String(), 1, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tr.Close()
+
+	otherSID := mppj.NewSessionID(2, "helper", "receiver", []mppj.SourceID{"ds1", "ds3"})
+	if err := tr.SendSetup(ctx, api.Setup{SessionID: otherSID, ReceiverPK: rpk}); err == nil {
+		t.Fatal("expected an error for the setup of another session")
+	}
+
+	for _, c := range []struct {
+		source  mppj.SourceID
+		numRows int
+		code    codes.Code
+	}{
+		{"ds3", testRows, codes.NotFound},
+		{"ds1", testRows + 1, codes.InvalidArgument},
+	} {
+		rows, err := tr.PushRows(ctx, c.source, c.numRows)
+		if err != nil {
+			t.Fatalf("PushRows failed: %v", err)
+		}
+		if err := rows.Close(); status.Code(err) != c.code {
+			t.Errorf("source %s with %d rows: expected code %v, got %v", c.source, c.numRows, c.code, err)
+		}
+	}
+}
+
+// pullHandler is a helper which only sends numRows empty rows to the receiver, in a single batch.
+type pullHandler struct {
+	transport.Handler
+	numRows int
+}
+
+func (h pullHandler) HandlePull(_ context.Context, open func(numRows int) (transport.RowSender[*pb.EncRowWithHint], error)) error {
+	rows, err := open(h.numRows)
+	if err != nil {
+		return err
+	}
+	msgs := make([]*pb.EncRowWithHint, h.numRows)
+	for i := range msgs {
+		msgs[i] = &pb.EncRowWithHint{}
+	}
+	if err := rows.Send(msgs); err != nil {
+		return err
+	}
+	return rows.Close()
+}
+
+func TestGRPCMaxBatchSize(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	numRows := 2*transport.MaxBatchSize + 1
+	go transport.NewGRPCHelper(lis).Serve(ctx, pullHandler{numRows: numRows})
+
+	if _, err := transport.NewGRPC(lis.Addr().String(), transport.MaxBatchSize+1, grpc.WithTransportCredentials(insecure.NewCredentials())); err == nil {
+		t.Fatal("expected an error for a batch size above MaxBatchSize")
+	}
+
+	// the helper sends at most MaxBatchSize rows per message, whatever the receiver requests
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	stream, err := pb.NewMPPJHelperClient(conn).PullRowBatches(ctx, &pb.BatchRequest{BatchSize: uint32(numRows)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sizes []int
+	for {
+		batch, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to pull the rows: %v", err)
+		}
+		sizes = append(sizes, len(batch.Rows))
+		if len(sizes) == 3 {
+			break // the stream ends once the receiver closes it
+		}
+	}
+	if !slices.Equal(sizes, []int{transport.MaxBatchSize, transport.MaxBatchSize, 1}) {
+		t.Fatalf("unexpected batches of %v rows", sizes)
+	}
+}
+
+func TestFiles(t *testing.T) {
+	sid := mppj.NewSessionID(2, "helper", "receiver", testSources)
+	_, rpk := mppj.ReceiverKeyGen()
+	files := transporttest.Files(t, sid, testSources)
+
+	// the parties run one after the other, each reading the files written before
+	ctx := context.Background()
+	if err := files("receiver").SendSetup(ctx, api.Setup{SessionID: sid, ReceiverPK: rpk}); err != nil {
+		t.Fatalf("SendSetup failed: %v", err)
+	}
+	for _, id := range testSources {
+		if err := pushRows(ctx, files(string(id)), sid, id); err != nil {
+			t.Fatalf("failed to push the rows of %s: %v", id, err)
+		}
+	}
+	if err := files("helper").Serve(ctx, newRelayHandler(sid)); err != nil {
+		t.Fatalf("Serve failed: %v", err)
+	}
+	if err := pullRows(ctx, files("receiver")); err != nil {
+		t.Fatalf("failed to pull the rows: %v", err)
+	}
+
+	// a cancelled push leaves no file
+	cctx, cancel := context.WithCancel(ctx)
+	tr := files("ds1")
+	tr.SourcePath = filepath.Join(t.TempDir(), "cancelled.mppj")
+	rows, err := tr.PushRows(cctx, "ds1", testRows)
+	if err != nil {
+		t.Fatalf("PushRows failed: %v", err)
+	}
+	cancel()
+	if err := rows.Close(); err == nil {
+		t.Fatal("expected an error for a cancelled push")
+	}
+	if _, err := os.Stat(tr.SourcePath); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected the file to be removed, got %v", err)
+	}
+}
+
+func TestAuthenticatesSetup(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	tr, err := transport.NewGRPC(lis.Addr().String(), 1, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tr.Close()
+	for _, c := range []struct {
+		tr       any
+		expected bool
+	}{
+		{transport.NewLocal(), true},
+		{&transport.Files{}, true},
+		{tr, false},
+		{transport.NewGRPCHelper(lis), false},
+	} {
+		if got := transport.AuthenticatesSetup(c.tr); got != c.expected {
+			t.Errorf("%T: expected %v, got %v", c.tr, c.expected, got)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+// Package transporttest provides the transports of the parties of test sessions, for the tests of the
+// transports and of the sessions.
+package transporttest
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+	"mppj"
+	"mppj/api"
+	"mppj/transport"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Files returns the file transport of each party of the session sid, given its id: the sources, "helper" or
+// "receiver". The files are written in a temporary directory, and signed with keys generated for the parties.
+func Files(tb testing.TB, sid []byte, sources []mppj.SourceID) func(party string) *transport.Files {
+	tb.Helper()
+	dir := tb.TempDir()
+	keys := make(map[string]ed25519.PrivateKey)
+	parties := []string{"helper", "receiver"}
+	for _, id := range sources {
+		parties = append(parties, string(id))
+	}
+	for _, party := range parties {
+		_, sk, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		keys[party] = sk
+	}
+	if err := os.Mkdir(filepath.Join(dir, "sources"), 0755); err != nil {
+		tb.Fatal(err)
+	}
+	return func(party string) *transport.Files {
+		return &transport.Files{
+			SessionID:  sid,
+			Party:      party,
+			SigningKey: keys[party],
+			VerifyingKey: func(h api.FileHeader) (ed25519.PublicKey, error) {
+				sk, ok := keys[h.Party]
+				if !ok || !bytes.Equal(h.SessionID, sid) {
+					return nil, errors.New("unexpected file")
+				}
+				return sk.Public().(ed25519.PublicKey), nil
+			},
+			SetupPath:  filepath.Join(dir, "setup.mppj"),
+			SourcePath: filepath.Join(dir, "sources", party+".mppj"),
+			SourceDir:  filepath.Join(dir, "sources"),
+			Sources:    sources,
+			HelperPath: filepath.Join(dir, "helper.mppj"),
+		}
+	}
+}
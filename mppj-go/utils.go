@@ -15,7 +15,7 @@ type contextKey string
 const sourceIDContextKey = contextKey("source-id")
 
 func SourceIDToOutgoingContext(ctx context.Context, id SourceID) context.Context {
-	return metadata.AppendToOutgoingContext(context.Background(), string(sourceIDContextKey), string(id))
+	return metadata.AppendToOutgoingContext(ctx, string(sourceIDContextKey), string(id))
 }
 
 func SourceIDFromIncomingContext(ctx context.Context) (SourceID, bool) {
@@ -30,6 +30,20 @@ func SourceIDFromIncomingContext(ctx context.Context) (SourceID, bool) {
 	return SourceID(id[0]), true
 }
 
+// SourceIDFromOutgoingContext returns the source ID set by SourceIDToOutgoingContext, e.g., for the client-side
+// statistics of a source.
+func SourceIDFromOutgoingContext(ctx context.Context) (SourceID, bool) {
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if !ok {
+		return "", false
+	}
+	id := md.Get(string(sourceIDContextKey))
+	if len(id) == 0 {
+		return "", false
+	}
+	return SourceID(id[0]), true
+}
+
 type SourceList []SourceID
 
 func (s *SourceList) String() string {